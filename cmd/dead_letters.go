@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/urfave/cli/v2"
+)
+
+// newDeadLettersCommand returns the "dead-letters" command, for inspecting and requeuing
+// webhook events that failed too many times.
+//
+// Each provider gets its own instance, since the CLI framework mutates commands while setting them up.
+func newDeadLettersCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "dead-letters",
+		Usage: "Inspect and requeue webhook events that failed too many times",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      FlagServerQueuePath,
+				Usage:     "Path to the SQLite file the server stores webhook events in",
+				Required:  true,
+				TakesFile: true,
+				EnvVars: []string{
+					"SCM_ENGINE_QUEUE_PATH",
+				},
+			},
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the dead letters",
+				Action: DeadLettersList,
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the payload of a dead letter",
+				Args:      true,
+				ArgsUsage: " event_id",
+				Action:    DeadLettersShow,
+			},
+			{
+				Name:      "requeue",
+				Usage:     "Move dead letters back to the queue, with a fresh set of attempts",
+				Args:      true,
+				ArgsUsage: " [event_id, event_id, ...]",
+				Action:    DeadLettersRequeue,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete dead letters",
+				Args:      true,
+				ArgsUsage: " [event_id, event_id, ...]",
+				Action:    DeadLettersDelete,
+			},
+		},
+	}
+}
+
+func DeadLettersList(cCtx *cli.Context) error {
+	store, err := eventstore.Open(cCtx.Context, cCtx.String(FlagServerQueuePath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	events, err := store.List(cCtx.Context, eventstore.StatusDead)
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		fmt.Fprintln(cCtx.App.Writer, "No dead letters")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cCtx.App.Writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tPROVIDER\tEVENT TYPE\tATTEMPTS\tRECEIVED AT\tLAST ERROR")
+
+	for _, event := range events {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			event.ID,
+			event.Provider,
+			event.EventType,
+			event.Attempts,
+			event.ReceivedAt.Format(time.RFC3339),
+			// Keep every dead letter on a single line
+			strings.Join(strings.Fields(event.LastError), " "),
+		)
+	}
+
+	return w.Flush()
+}
+
+func DeadLettersShow(cCtx *cli.Context) error {
+	if cCtx.NArg() != 1 {
+		return errors.New("expected exactly one event ID")
+	}
+
+	ids, err := parseEventIDs(cCtx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	store, err := eventstore.Open(cCtx.Context, cCtx.String(FlagServerQueuePath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	event, err := store.Get(cCtx.Context, ids[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cCtx.App.Writer, string(event.Payload))
+
+	return nil
+}
+
+func DeadLettersRequeue(cCtx *cli.Context) error {
+	return eachDeadLetter(cCtx, "Requeued", (*eventstore.Store).Requeue)
+}
+
+func DeadLettersDelete(cCtx *cli.Context) error {
+	return eachDeadLetter(cCtx, "Deleted", (*eventstore.Store).DeleteDead)
+}
+
+// eachDeadLetter applies fn to every dead letter ID provided as argument, carrying on past failures
+func eachDeadLetter(cCtx *cli.Context, verb string, fn func(*eventstore.Store, context.Context, int64) error) error {
+	if cCtx.NArg() == 0 {
+		return errors.New("expected at least one event ID")
+	}
+
+	ids, err := parseEventIDs(cCtx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	store, err := eventstore.Open(cCtx.Context, cCtx.String(FlagServerQueuePath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var errs []error
+
+	for _, id := range ids {
+		if err := fn(store, cCtx.Context, id); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		fmt.Fprintf(cCtx.App.Writer, "%s event %d\n", verb, id)
+	}
+
+	return errors.Join(errs...)
+}
+
+func parseEventIDs(args []string) ([]int64, error) {
+	ids := make([]int64, 0, len(args))
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event ID %q: %w", arg, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
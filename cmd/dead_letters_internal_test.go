@@ -0,0 +1,68 @@
+//nolint:testpackage // the dead-letters command is built from an unexported constructor
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runDeadLetters runs the dead-letters command against the event store at path, and returns its output
+func runDeadLetters(t *testing.T, path string, args ...string) (string, error) {
+	t.Helper()
+
+	var output bytes.Buffer
+
+	app := &cli.App{
+		Writer:   &output,
+		Commands: []*cli.Command{newDeadLettersCommand()},
+	}
+
+	err := app.RunContext(t.Context(), append([]string{"scm-engine", "dead-letters", "--" + FlagServerQueuePath, path}, args...))
+
+	return output.String(), err
+}
+
+func TestDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	store, err := eventstore.Open(t.Context(), path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { store.Close() })
+
+	output, err := runDeadLetters(t, path, "list")
+	require.NoError(t, err)
+	require.Equal(t, "No dead letters\n", output)
+
+	event := eventstore.Event{Provider: "gitlab", EventType: "merge_request", Payload: []byte(`{"event_type":"merge_request"}`)}
+	require.NoError(t, store.Insert(t.Context(), &event))
+	require.NoError(t, store.Bury(t.Context(), event.ID, 5, "could not update pipeline:\n502 Bad Gateway"))
+
+	output, err = runDeadLetters(t, path, "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "ID  PROVIDER  EVENT TYPE     ATTEMPTS")
+	require.Contains(t, output, "could not update pipeline: 502 Bad Gateway", "errors are kept on a single line")
+
+	output, err = runDeadLetters(t, path, "show", "1")
+	require.NoError(t, err)
+	require.Equal(t, "{\"event_type\":\"merge_request\"}\n", output)
+
+	// The server is still running (the store is open), yet the event can be requeued
+	output, err = runDeadLetters(t, path, "requeue", "1", "2")
+	require.ErrorIs(t, err, eventstore.ErrNotFound, "event 2 does not exist")
+	require.Equal(t, "Requeued event 1\n", output)
+
+	pending, err := store.List(t.Context(), eventstore.StatusPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	_, err = runDeadLetters(t, path, "requeue", "nope")
+	require.ErrorContains(t, err, `invalid event ID "nope"`)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// withEvaluationRecord makes ProcessMR record what it decided and did, when the evaluation history is enabled.
+//
+// The evaluation history is built from the same [evaluationResult] as the admin API, which is reused when
+// already asked for by [withEvaluationResult].
+func withEvaluationRecord(ctx context.Context) context.Context {
+	if history.FromContext(ctx) == nil {
+		return ctx
+	}
+
+	if _, ok := evaluationResultFromContext(ctx); ok {
+		return ctx
+	}
+
+	ctx, _ = withEvaluationResult(ctx)
+
+	return ctx
+}
+
+// saveEvaluationRecord stores the evaluation in the context in the evaluation history, with the error it ended with.
+//
+// Failing to store the record is logged rather than failing the evaluation, which already happened.
+func saveEvaluationRecord(ctx context.Context, err error) {
+	store := history.FromContext(ctx)
+	if store == nil {
+		return
+	}
+
+	result, ok := evaluationResultFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	record := newEvaluationRecord(ctx, result)
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	// Not inheriting cancellation, so evaluations stopped by a shutdown are still recorded
+	if err := store.Insert(context.WithoutCancel(ctx), record); err != nil {
+		slogctx.Error(ctx, "Could not record evaluation in the history", slog.Any("error", err))
+	}
+}
+
+// newEvaluationRecord converts the result of the evaluation in the context into its evaluation history record
+func newEvaluationRecord(ctx context.Context, result *evaluationResult) *history.Record {
+	record := &history.Record{
+		EvaluationID:    state.EvaluationID(ctx),
+		Provider:        state.Provider(ctx),
+		ProjectID:       state.ProjectID(ctx),
+		MergeRequestID:  state.MergeRequestID(ctx),
+		CommitSHA:       state.CommitSHA(ctx),
+		Trigger:         state.Trigger(ctx),
+		ConfigSourceRef: result.configSourceRef,
+		DryRun:          state.IsDryRun(ctx),
+		Actions:         result.executedActions,
+		StartedAt:       state.StartTime(ctx),
+		Duration:        time.Since(state.StartTime(ctx)),
+	}
+
+	// The configuration file may change the dry-run mode, which the result knows once the labels were evaluated
+	if len(result.EvaluationID) > 0 {
+		record.DryRun = result.DryRun
+	}
+
+	for _, label := range result.Labels {
+		if label.Matched {
+			record.MatchedLabels = append(record.MatchedLabels, label.Name)
+		} else {
+			record.UnmatchedLabels = append(record.UnmatchedLabels, label.Name)
+		}
+	}
+
+	if result.Update == nil || reflect.DeepEqual(result.Update, &scm.UpdateMergeRequestOptions{}) {
+		return record
+	}
+
+	payload, err := json.Marshal(result.Update)
+	if err != nil {
+		slogctx.Warn(ctx, "Could not encode the update payload for the evaluation history", slog.Any("error", err))
+
+		return record
+	}
+
+	record.Update = payload
+
+	return record
+}
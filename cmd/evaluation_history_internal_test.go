@@ -0,0 +1,160 @@
+//nolint:testpackage // the evaluation history is recorded by unexported helpers
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// newHistoryContext returns a context for evaluating jippi/scm-engine!1, recording into a fresh evaluation history
+func newHistoryContext(t *testing.T) (context.Context, *history.Store) {
+	t.Helper()
+
+	store, err := history.Open(t.Context(), "", 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { store.Close() })
+
+	ctx := history.WithStore(t.Context(), store)
+	ctx = state.WithProvider(ctx, "gitlab")
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "1")
+	ctx = state.WithCommitSHA(ctx, "abc123")
+	ctx = state.WithDryRun(ctx, false)
+	ctx = state.WithTrigger(ctx, "merge_request")
+
+	return ctx, store
+}
+
+func timeline(t *testing.T, store *history.Store) []history.Record {
+	t.Helper()
+
+	records, err := store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+
+	return records
+}
+
+func TestEvaluationRecord(t *testing.T) {
+	t.Parallel()
+
+	ctx, store := newHistoryContext(t)
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithEvaluationID(ctx, "eval")
+	ctx = withEvaluationRecord(ctx)
+
+	recordConfigSource(ctx, "HEAD")
+	recordEvaluationResult(state.WithDryRun(ctx, true), []scm.EvaluationResult{{Name: "bug", Matched: true}, {Name: "feature"}}, nil)
+
+	client := newFakeClient()
+	client.applyErr = errors.New("boom")
+
+	actions := config.Actions{
+		{Name: "close", Group: "state", Then: []config.ActionStep{{"action": "close"}}},
+	}
+
+	update := &scm.UpdateMergeRequestOptions{AddLabels: &scm.LabelOptions{"bug"}}
+
+	require.ErrorContains(t, runActions(ctx, newEvalContextStub(), client, update, actions), "boom")
+	recordEvaluationUpdate(ctx, update)
+	saveEvaluationRecord(ctx, errors.New("boom"))
+
+	records := timeline(t, store)
+	require.Len(t, records, 1)
+
+	record := records[0]
+	require.Equal(t, "eval", record.EvaluationID)
+	require.Equal(t, "abc123", record.CommitSHA)
+	require.Equal(t, "merge_request", record.Trigger)
+	require.Equal(t, "HEAD", record.ConfigSourceRef)
+	require.True(t, record.DryRun, "the configuration file may turn on dry-run mode")
+	require.Equal(t, []string{"bug"}, record.MatchedLabels)
+	require.Equal(t, []string{"feature"}, record.UnmatchedLabels)
+	require.Equal(t, []history.Action{
+		{Name: "close", Group: "state", Steps: []map[string]any{{"action": "close"}}, Error: "boom"},
+	}, record.Actions)
+	require.JSONEq(t, `{"add_labels":["bug"]}`, string(record.Update))
+	require.Equal(t, "boom", record.Error)
+}
+
+func TestEvaluationRecord_emptyUpdateIsNotRecorded(t *testing.T) {
+	t.Parallel()
+
+	ctx, store := newHistoryContext(t)
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithEvaluationID(ctx, "eval")
+	ctx = withEvaluationRecord(ctx)
+
+	recordEvaluationUpdate(ctx, &scm.UpdateMergeRequestOptions{})
+	saveEvaluationRecord(ctx, nil)
+
+	records := timeline(t, store)
+	require.Len(t, records, 1)
+	require.Nil(t, records[0].Update)
+	require.Empty(t, records[0].Error)
+}
+
+func TestEvaluationRecord_disabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := state.WithEvaluationID(t.Context(), "eval")
+	ctx = withEvaluationRecord(ctx)
+
+	_, ok := evaluationResultFromContext(ctx)
+	require.False(t, ok)
+
+	// Recording without a history is a no-op
+	recordConfigSource(ctx, "HEAD")
+	saveEvaluationRecord(ctx, nil)
+}
+
+// The evaluation history is built from the result the admin API asked for, rather than a second recording
+func TestEvaluationRecord_reusesEvaluationResult(t *testing.T) {
+	t.Parallel()
+
+	ctx, store := newHistoryContext(t)
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithEvaluationID(ctx, "eval")
+
+	ctx, result := withEvaluationResult(ctx)
+	ctx = withEvaluationRecord(ctx)
+
+	recordedResult, ok := evaluationResultFromContext(ctx)
+	require.True(t, ok)
+	require.Same(t, result, recordedResult)
+
+	recordEvaluationResult(ctx, []scm.EvaluationResult{{Name: "bug", Matched: true}}, nil)
+	saveEvaluationRecord(ctx, nil)
+
+	records := timeline(t, store)
+	require.Len(t, records, 1)
+	require.Equal(t, []string{"bug"}, records[0].MatchedLabels)
+	require.False(t, records[0].DryRun)
+}
+
+// Evaluations that fail before anything was evaluated are recorded too
+func TestProcessMR_recordsFailedEvaluation(t *testing.T) {
+	t.Parallel()
+
+	ctx, store := newHistoryContext(t)
+	ctx = state.WithConfigFilePath(ctx, ".scm-engine.yml")
+	ctx = state.WithGlobalConfigFilePath(ctx, "")
+
+	err := ProcessMR(ctx, newFakeClient(), nil, nil)
+	require.ErrorIs(t, err, errNotImplemented)
+
+	records := timeline(t, store)
+	require.Len(t, records, 1)
+	require.NotEmpty(t, records[0].EvaluationID)
+	require.Equal(t, "merge_request", records[0].Trigger)
+	require.Equal(t, errNotImplemented.Error(), records[0].Error)
+	require.Empty(t, records[0].MatchedLabels)
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+)
+
+const (
+	evaluationStateWaitingForLock = "waiting_for_lock"
+	evaluationStateEvaluating     = "evaluating"
+)
+
+// inFlightEvaluations tracks the evaluations of this process, for the admin API
+var inFlightEvaluations = newEvaluationRegistry()
+
+// inFlightEvaluation is an evaluation waiting for the lock on its Merge Request, or running
+type inFlightEvaluation struct {
+	EvaluationID   string    `json:"eval_id"`
+	Provider       string    `json:"provider"`
+	ProjectID      string    `json:"project_id"`
+	MergeRequestID string    `json:"merge_request_id"`
+	CommitSHA      string    `json:"commit_sha"`
+	StartedAt      time.Time `json:"started_at"`
+	State          string    `json:"state"`
+}
+
+// evaluationRegistry keeps track of in-flight evaluations by their evaluation ID
+type evaluationRegistry struct {
+	mu          sync.Mutex
+	evaluations map[string]*inFlightEvaluation
+}
+
+func newEvaluationRegistry() *evaluationRegistry {
+	return &evaluationRegistry{evaluations: map[string]*inFlightEvaluation{}}
+}
+
+// Start tracks the evaluation in the context until the returned function is called
+func (r *evaluationRegistry) Start(ctx context.Context) func() {
+	id := state.EvaluationID(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evaluations[id] = &inFlightEvaluation{
+		EvaluationID:   id,
+		Provider:       state.Provider(ctx),
+		ProjectID:      state.ProjectID(ctx),
+		MergeRequestID: state.MergeRequestID(ctx),
+		CommitSHA:      state.CommitSHA(ctx),
+		StartedAt:      state.StartTime(ctx).UTC(),
+		State:          evaluationStateWaitingForLock,
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.evaluations, id)
+	}
+}
+
+// Locked marks the evaluation in the context as holding the lock on its Merge Request
+func (r *evaluationRegistry) Locked(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if evaluation, ok := r.evaluations[state.EvaluationID(ctx)]; ok {
+		evaluation.State = evaluationStateEvaluating
+	}
+}
+
+// List returns the in-flight evaluations, oldest first
+func (r *evaluationRegistry) List() []inFlightEvaluation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]inFlightEvaluation, 0, len(r.evaluations))
+	for _, evaluation := range r.evaluations {
+		result = append(result, *evaluation)
+	}
+
+	slices.SortFunc(result, func(a, b inFlightEvaluation) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	return result
+}
+
+// evaluationResult is what an evaluation decided to do with the Merge Request
+type evaluationResult struct {
+	EvaluationID string                         `json:"eval_id"`
+	DryRun       bool                           `json:"dry_run"`
+	Labels       []evaluatedLabel               `json:"labels"`
+	Actions      config.Actions                 `json:"actions"`
+	Update       *scm.UpdateMergeRequestOptions `json:"update,omitempty"`
+
+	// configSourceRef and executedActions are only kept for the evaluation history
+	configSourceRef string
+	executedActions []history.Action
+}
+
+// evaluatedLabel is a label and whether its rule matched the Merge Request
+type evaluatedLabel struct {
+	Name        string `json:"name"`
+	Matched     bool   `json:"matched"`
+	Color       string `json:"color,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type evaluationResultKey struct{}
+
+// withEvaluationResult asks ProcessMR to record what it decided into the returned result
+func withEvaluationResult(ctx context.Context) (context.Context, *evaluationResult) {
+	result := &evaluationResult{Labels: []evaluatedLabel{}, Actions: config.Actions{}}
+
+	return context.WithValue(ctx, evaluationResultKey{}, result), result
+}
+
+// evaluationResultFromContext returns the result ProcessMR records into, if any
+func evaluationResultFromContext(ctx context.Context) (*evaluationResult, bool) {
+	result, ok := ctx.Value(evaluationResultKey{}).(*evaluationResult)
+
+	return result, ok
+}
+
+// recordConfigSource records the git ref the configuration file was read from, when asked to by [withEvaluationResult]
+func recordConfigSource(ctx context.Context, ref string) {
+	if result, ok := evaluationResultFromContext(ctx); ok {
+		result.configSourceRef = ref
+	}
+}
+
+// recordEvaluationResult records the evaluated labels and actions, when asked to by [withEvaluationResult]
+func recordEvaluationResult(ctx context.Context, labels []scm.EvaluationResult, actions config.Actions) {
+	result, ok := evaluationResultFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	result.EvaluationID = state.EvaluationID(ctx)
+	result.DryRun = state.IsDryRun(ctx)
+	result.Actions = append(result.Actions, actions...)
+
+	for _, label := range labels {
+		result.Labels = append(result.Labels, evaluatedLabel{
+			Name:        label.Name,
+			Matched:     label.Matched,
+			Color:       label.Color,
+			Description: label.Description,
+		})
+	}
+}
+
+// recordEvaluationUpdate records the changes made to the Merge Request, when asked to by [withEvaluationResult]
+func recordEvaluationUpdate(ctx context.Context, update *scm.UpdateMergeRequestOptions) {
+	if result, ok := evaluationResultFromContext(ctx); ok {
+		result.Update = update
+	}
+}
+
+// recordExecutedAction records an action that was executed, and the error it failed with, when asked to by [withEvaluationResult]
+func recordExecutedAction(ctx context.Context, action config.Action, err error) {
+	result, ok := evaluationResultFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	executed := history.Action{
+		Name:  action.Name,
+		Group: action.Group,
+		Steps: make([]map[string]any, 0, len(action.Then)),
+	}
+
+	for _, step := range action.Then {
+		executed.Steps = append(executed.Steps, step)
+	}
+
+	if err != nil {
+		executed.Error = err.Error()
+	}
+
+	result.executedActions = append(result.executedActions, executed)
+}
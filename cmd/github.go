@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/scm/github"
 	"github.com/jippi/scm-engine/pkg/state"
 	"github.com/urfave/cli/v2"
 )
@@ -8,8 +14,31 @@ import (
 var GitHub = &cli.Command{
 	Name:  "github",
 	Usage: "GitHub related commands",
-	Before: func(ctx *cli.Context) error {
-		ctx.Context = state.WithProvider(ctx.Context, "github")
+	Before: func(cCtx *cli.Context) error {
+		cCtx.Context = state.WithProvider(cCtx.Context, "github")
+		cCtx.Context = state.WithBaseURL(cCtx.Context, cCtx.String(FlagSCMBaseURL))
+		cCtx.Context = state.WithToken(cCtx.Context, cCtx.String(FlagAPIToken))
+		cCtx.Context = state.WithGlobalConfigFilePath(cCtx.Context, cCtx.String(FlagGlobalConfigFile))
+		cCtx.Context = state.WithIncludeMaxDepth(cCtx.Context, cCtx.Int(FlagIncludeMaxDepth))
+
+		if appID := cCtx.Int64(FlagGitHubAppID); appID != 0 {
+			privateKey := cCtx.String(FlagGitHubAppPrivateKey)
+
+			if path := cCtx.String(FlagGitHubAppPrivateKeyPath); len(path) > 0 {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not read GitHub App private key: %w", err)
+				}
+
+				privateKey = string(content)
+			}
+
+			if len(privateKey) == 0 {
+				return errors.New("a GitHub App private key is required when a GitHub App ID is configured")
+			}
+
+			cCtx.Context = state.WithGitHubApp(cCtx.Context, appID, privateKey)
+		}
 
 		return nil
 	},
@@ -21,16 +50,62 @@ var GitHub = &cli.Command{
 				"SCM_ENGINE_TOKEN", // SCM Engine Native
 			},
 		},
+		&cli.Int64Flag{
+			Name:  FlagGitHubAppID,
+			Usage: "Authenticate as this GitHub App instead of using an API token. The installation is resolved from the repository being evaluated",
+			EnvVars: []string{
+				"SCM_ENGINE_GITHUB_APP_ID", // SCM Engine Native
+			},
+		},
+		&cli.StringFlag{
+			Name:  FlagGitHubAppPrivateKey,
+			Usage: "PEM encoded private key for the GitHub App",
+			EnvVars: []string{
+				"SCM_ENGINE_GITHUB_APP_PRIVATE_KEY", // SCM Engine Native
+			},
+		},
+		&cli.StringFlag{
+			Name:      FlagGitHubAppPrivateKeyPath,
+			Usage:     "Path to the PEM encoded private key for the GitHub App. Takes precedence over --" + FlagGitHubAppPrivateKey,
+			TakesFile: true,
+			EnvVars: []string{
+				"SCM_ENGINE_GITHUB_APP_PRIVATE_KEY_PATH", // SCM Engine Native
+			},
+		},
 		&cli.StringFlag{
 			Name:  FlagSCMBaseURL,
-			Usage: "Base URL for the SCM instance",
-			Value: "https://api.github.com/",
+			Usage: "Base URL for the SCM instance. For GitHub Enterprise Server, use the instance URL (e.g. 'https://github.example.com/'); the '/api/v3' and '/api/graphql' paths are added automatically",
+			Value: github.DefaultBaseURL,
 			EnvVars: []string{
 				"SCM_ENGINE_BASE_URL", // SCM Engine Native
 			},
 		},
+		&cli.StringFlag{
+			Name:  FlagGlobalConfigFile,
+			Usage: "Path to a global configuration file. Any repository specific configuration will be merged on top of the global configuration",
+			Value: "",
+			EnvVars: []string{
+				"SCM_ENGINE_GLOBAL_CONFIG_FILE",
+			},
+		},
+		IntFlagIncludeMaxDepth,
 	},
 	Subcommands: []*cli.Command{
+		newDeadLettersCommand(),
+		newHistoryCommand(),
+		{
+			Name:   "lint",
+			Usage:  "lint a configuration file",
+			Args:   false,
+			Action: Lint,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "schema",
+					Usage: "Where to find the JSON Schema file. Can load the file from either the embedded version (default), http://, https://, or a file:// URI",
+					Value: "embed://",
+				},
+			},
+		},
 		{
 			Name:      "evaluate",
 			Usage:     "Evaluate a Pull Request",
@@ -60,6 +135,115 @@ var GitHub = &cli.Command{
 						"GITHUB_SHA", // GitHub Actions
 					},
 				},
+				StringFlagBackstageURL,
+				StringFlagBackstageToken,
+				StringFlagHistoryPath,
+				DurationFlagHistoryRetention,
+			},
+		},
+		{
+			Name:   "server",
+			Usage:  "Start HTTP server for webhook event driven usage",
+			Action: Server,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  FlagWebhookSecret,
+					Usage: "Used to validate received payloads. GitHub signs the request body with it and sends the signature in the X-Hub-Signature-256 HTTP header",
+					EnvVars: []string{
+						"SCM_ENGINE_WEBHOOK_SECRET",
+					},
+				},
+				&cli.StringFlag{
+					Name:  FlagServerListenHost,
+					Usage: "IP that the HTTP server should listen on",
+					Value: "0.0.0.0",
+					EnvVars: []string{
+						"SCM_ENGINE_LISTEN_ADDR",
+					},
+				},
+				&cli.IntFlag{
+					Name:  FlagServerListenPort,
+					Usage: "Port that the HTTP server should listen on",
+					Value: 3000,
+					EnvVars: []string{
+						"SCM_ENGINE_LISTEN_PORT",
+						"PORT",
+					},
+				},
+				&cli.DurationFlag{
+					Name:  FlagServerTimeout,
+					Usage: "Timeout for webhook requests",
+					Value: 5 * time.Second,
+					EnvVars: []string{
+						"SCM_ENGINE_TIMEOUT",
+					},
+				},
+				IntFlagServerWorkers,
+				IntFlagServerQueueSize,
+				StringFlagServerQueuePath,
+				IntFlagServerQueueMaxAttempts,
+				DurationFlagServerQueueRetryBackoff,
+				DurationFlagServerDebounce,
+				StringFlagLockBackend,
+				StringFlagLockRedisURL,
+				DurationFlagLockTTL,
+				StringFlagAdminToken,
+				DurationFlagGlobalConfigReloadInterval,
+				StringFlagHistoryPath,
+				DurationFlagHistoryRetention,
+				&cli.BoolFlag{
+					Name:  FlagUpdatePipeline,
+					Usage: "Report evaluation progress as a 'scm-engine' check run (or commit status) on the Pull Request HEAD commit",
+					Value: true,
+					EnvVars: []string{
+						"SCM_ENGINE_UPDATE_PIPELINE",
+					},
+				},
+				&cli.StringFlag{
+					Name:  FlagUpdatePipelineURL,
+					Usage: "(Optional) URL to where logs can be found for the pipeline",
+					EnvVars: []string{
+						"SCM_ENGINE_UPDATE_PIPELINE_URL",
+					},
+				},
+				&cli.DurationFlag{
+					Name:  FlagPeriodicEvaluationInterval,
+					Usage: "(Optional) Frequency of which to evaluate all Pull Requests regardless of user activity",
+					EnvVars: []string{
+						"SCM_ENGINE_PERIODIC_EVALUATION_INTERVAL",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  FlagPeriodicEvaluationIgnoreMergeRequestsWithLabel,
+					Usage: "(Optional) Ignore PR with these labels",
+					EnvVars: []string{
+						"SCM_ENGINE_PERIODIC_EVALUATION_IGNORE_MR_WITH_LABELS",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  FlagPeriodicEvaluationRequireMergeRequestsWithLabel,
+					Usage: "(Optional) Only process PR with these labels",
+					EnvVars: []string{
+						"SCM_ENGINE_PERIODIC_EVALUATION_REQUIRE_MR_WITH_LABELS",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  FlagPeriodicEvaluationOnlyProjectsWithTopics,
+					Usage: "(Optional) Only evaluate repositories with these topics",
+					EnvVars: []string{
+						"SCM_ENGINE_PERIODIC_EVALUATION_REQUIRE_PROJECT_TOPICS",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  FlagPeriodicEvaluationOnlyProjectsWithMembership,
+					Usage: "(Optional) Only evaluate repositories with membership",
+					Value: true,
+					EnvVars: []string{
+						"SCM_ENGINE_PERIODIC_EVALUATION_ONLY_PROJECTS_WITH_MEMBERSHIP",
+					},
+				},
+				StringFlagBackstageURL,
+				StringFlagBackstageToken,
 			},
 		},
 	},
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// headCommitResolver is implemented by clients that can look up the HEAD commit of
+// a Pull Request, for webhook events that do not carry it in their payload
+type headCommitResolver interface {
+	HeadCommitSHA(ctx context.Context) (string, error)
+}
+
+func GitHubWebhookHandler(webhookSecret string, dispatcher *webhookDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// The event type is only trusted once the signature has been checked
+		eventType := "unknown"
+
+		recorder := newWebhookResponseRecorder(w)
+		defer func() { countReceivedWebhookEvent("github", eventType, recorder.status) }()
+
+		w = recorder
+
+		// Read the POST body of the request; GitHub signs the raw body so we need it before anything else
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			errHandler(ctx, w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		// Check if the webhook secret is set (and if the signature is matching)
+		if len(webhookSecret) > 0 && !validGitHubSignature(webhookSecret, r.Header.Get("X-Hub-Signature-256"), body) {
+			errHandler(ctx, w, http.StatusForbidden, errors.New("Missing or invalid X-Hub-Signature-256 header"))
+
+			return
+		}
+
+		// Validate content type
+		if r.Header.Get("Content-Type") != "application/json" {
+			errHandler(ctx, w, http.StatusNotAcceptable, errors.New("The request is not using Content-Type: application/json"))
+
+			return
+		}
+
+		// Ensure we have content in the POST body
+		if len(body) == 0 {
+			errHandler(ctx, w, http.StatusBadRequest, errors.New("The POST body is empty; expected a JSON payload"))
+
+			return
+		}
+
+		eventType = r.Header.Get("X-GitHub-Event")
+		ctx = slogctx.With(ctx, slog.String("event_type", eventType))
+
+		// GitHub sends a "ping" event when the webhook is created
+		if eventType == "ping" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("pong"))
+
+			return
+		}
+
+		// Decode request payload
+		var payload GitHubWebhookPayload
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&payload); err != nil {
+			errHandler(ctx, w, http.StatusBadRequest, fmt.Errorf("could not decode POST body into Payload struct: %w", err))
+
+			return
+		}
+
+		if payload.IsOwnCheckSuite(state.GitHubAppID(ctx)) {
+			slogctx.Debug(ctx, "Webhook event is about our own check suite, ignoring")
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK - ignoring our own check suite"))
+
+			return
+		}
+
+		// Grab event specific information
+		targets, err := payload.Targets(eventType)
+		if errors.Is(err, errUnsupportedGitHubEvent) {
+			slogctx.Debug(ctx, "Webhook event type is not supported, ignoring")
+
+			// Answering with an error would make GitHub report every delivery of the event as failed
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("OK - ignored unsupported event type " + eventType))
+
+			return
+		}
+
+		if err != nil {
+			errHandler(ctx, w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		if len(targets) == 0 {
+			slogctx.Debug(ctx, "Webhook event does not concern any Pull Requests, ignoring")
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK - no Pull Requests to evaluate"))
+
+			return
+		}
+
+		// Initialize context for logging; the worker builds its own context from the stored event
+		ctx = state.WithProjectID(ctx, payload.Repository.FullName)
+
+		slogctx.Info(ctx, "POST /github webhook")
+
+		// Store and queue the PRs for processing; a single delivery is a single event, so a full
+		// queue never leaves us with only some of the PRs evaluated
+		event := eventstore.Event{Provider: "github", EventType: eventType, Payload: body}
+
+		// Events for multiple Pull Requests (e.g. "check_suite") are never collapsed
+		if len(targets) == 1 {
+			event.DedupeKey = webhookDedupeKey("github", payload.Repository.FullName, targets[0].ID)
+			event.CommitSHA = targets[0].SHA
+		}
+
+		accepted, err := dispatcher.Submit(ctx, event)
+		if err != nil {
+			errHandler(ctx, w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		if !accepted {
+			errHandler(ctx, w, http.StatusServiceUnavailable, errors.New("The webhook queue is full; try again later"))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Accepted"))
+	}
+}
+
+// processGitHubWebhookEvent evaluates the Pull Requests a stored GitHub webhook event refers to
+func processGitHubWebhookEvent(ctx context.Context, client scm.Client, event eventstore.Event) error {
+	var payload GitHubWebhookPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return permanentError{fmt.Errorf("could not decode payload: %w", err)}
+	}
+
+	targets, err := payload.Targets(event.EventType)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	// Collapsed events carry the latest commit SHA, which may be newer than the one in the payload
+	if len(targets) == 1 && len(event.CommitSHA) > 0 {
+		targets[0].SHA = event.CommitSHA
+	}
+
+	ctx = state.WithProjectID(ctx, payload.Repository.FullName)
+
+	// Decode request payload into 'any' so we have all the details
+	var fullEventPayload any
+	if err := json.Unmarshal(event.Payload, &fullEventPayload); err != nil {
+		return permanentError{err}
+	}
+
+	var errs []error
+
+	for _, target := range targets {
+		if err := processGitHubWebhookTarget(ctx, client, target, fullEventPayload); err != nil {
+			errs = append(errs, fmt.Errorf("Pull Request #%s: %w", target.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// processGitHubWebhookTarget evaluates a single Pull Request affected by a webhook event
+func processGitHubWebhookTarget(ctx context.Context, client scm.Client, target GitHubWebhookTarget, event any) error {
+	// Build context for rest of the pipeline
+	ctx = state.WithMergeRequestID(ctx, target.ID)
+	ctx = state.WithCommitSHA(ctx, target.SHA)
+
+	// Some events (e.g. "issue_comment") do not include the HEAD commit, so look it up
+	if len(target.SHA) == 0 {
+		if resolver, ok := client.(headCommitResolver); ok {
+			sha, err := resolver.HeadCommitSHA(ctx)
+			if err != nil {
+				return fmt.Errorf("could not find HEAD commit for Pull Request: %w", err)
+			}
+
+			ctx = state.WithCommitSHA(ctx, sha)
+		}
+	}
+
+	// Process the PR
+	return processWebhookEvent(ctx, client, event)
+}
+
+// validGitHubSignature checks the "sha256=<hex>" HMAC signature GitHub computes over the
+// raw request body using the webhook secret.
+//
+// See: https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+func validGitHubSignature(secret, signature string, body []byte) bool {
+	theirSignature, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+
+	theirMAC, err := hex.DecodeString(theirSignature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(theirMAC, mac.Sum(nil))
+}
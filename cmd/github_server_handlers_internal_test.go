@@ -0,0 +1,312 @@
+//nolint:testpackage // the webhook handler is built from unexported helpers and package level state
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// newGitHubWebhook builds the handler the same way Server() does for the
+// "github" provider; the returned function sends a single delivery.
+//
+// None of the tests below get as far as talking to GitHub, since that would
+// require network access.
+func newGitHubWebhook(t *testing.T, secret string) func(string, map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	ctx := state.WithProvider(t.Context(), "github")
+	ctx = state.WithBaseURL(ctx, "https://api.github.com/")
+	ctx = state.WithToken(ctx, "token")
+	ctx = state.WithBackstageURL(ctx, "")
+	ctx = state.WithBackstageToken(ctx, "")
+	ctx = state.WithConfigFilePath(ctx, ".scm-engine.yml")
+	ctx = state.WithGlobalConfigFilePath(ctx, "")
+	ctx = state.WithDryRun(ctx, true)
+	ctx = state.WithUpdatePipeline(ctx, false, "")
+
+	handler := GitHubWebhookHandler(secret, newTestWebhookDispatcher(t, ctx, 1, 1))
+
+	return func(body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/github", strings.NewReader(body))
+
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+
+		return recorder
+	}
+}
+
+func githubHeaders(event string) map[string]string {
+	return map[string]string{"Content-Type": "application/json", "X-GitHub-Event": event}
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubWebhookHandler_rejectsBadSignature(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "no signature header", signature: ""},
+		{name: "signed with another secret", signature: sign("other-secret", `{}`)},
+		{name: "sha1 signature", signature: "sha1=0123456789abcdef"},
+		{name: "not hex", signature: "sha256=not-hex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			headers := githubHeaders("ping")
+			if tt.signature != "" {
+				headers["X-Hub-Signature-256"] = tt.signature
+			}
+
+			recorder := newGitHubWebhook(t, "expected-secret")(`{}`, headers)
+
+			require.Equal(t, http.StatusForbidden, recorder.Code)
+			require.Contains(t, recorder.Body.String(), "Missing or invalid X-Hub-Signature-256")
+		})
+	}
+}
+
+func TestGitHubWebhookHandler_acceptsMatchingSignature(t *testing.T) {
+	t.Parallel()
+
+	headers := githubHeaders("ping")
+	headers["X-Hub-Signature-256"] = sign("expected-secret", `{"zen":"Keep it logically awesome."}`)
+
+	recorder := newGitHubWebhook(t, "expected-secret")(`{"zen":"Keep it logically awesome."}`, headers)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "pong", recorder.Body.String())
+}
+
+// A signature is only valid for the exact body it was computed over.
+func TestGitHubWebhookHandler_rejectsTamperedBody(t *testing.T) {
+	t.Parallel()
+
+	headers := githubHeaders("ping")
+	headers["X-Hub-Signature-256"] = sign("expected-secret", `{"zen":"original"}`)
+
+	recorder := newGitHubWebhook(t, "expected-secret")(`{"zen":"tampered"}`, headers)
+
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+// With no secret configured the signature header must not be required at all.
+func TestGitHubWebhookHandler_secretIsOptional(t *testing.T) {
+	t.Parallel()
+
+	recorder := newGitHubWebhook(t, "")(`{}`, githubHeaders("ping"))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestGitHubWebhookHandler_requiresJSONContentType(t *testing.T) {
+	t.Parallel()
+
+	recorder := newGitHubWebhook(t, "")(`payload=%7B%7D`, map[string]string{
+		"Content-Type":   "application/x-www-form-urlencoded",
+		"X-GitHub-Event": "ping",
+	})
+
+	require.Equal(t, http.StatusNotAcceptable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Content-Type: application/json")
+}
+
+func TestGitHubWebhookHandler_rejectsEmptyBody(t *testing.T) {
+	t.Parallel()
+
+	recorder := newGitHubWebhook(t, "")("", githubHeaders("pull_request"))
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "The POST body is empty")
+}
+
+func TestGitHubWebhookHandler_rejectsMalformedJSON(t *testing.T) {
+	t.Parallel()
+
+	recorder := newGitHubWebhook(t, "")(`{"broken":`, githubHeaders("pull_request"))
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "could not decode POST body")
+}
+
+// Event types we do not evaluate are acknowledged, so GitHub does not report the deliveries as failed
+func TestGitHubWebhookHandler_ignoresUnsupportedEventTypes(t *testing.T) {
+	t.Parallel()
+
+	for _, event := range []string{"push", "installation", "deployment"} {
+		t.Run(event, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := newGitHubWebhook(t, "")(`{"repository":{"full_name":"jippi/scm-engine"}}`, githubHeaders(event))
+
+			require.Equal(t, http.StatusAccepted, recorder.Code)
+			require.Contains(t, recorder.Body.String(), "ignored unsupported event type "+event)
+		})
+	}
+}
+
+// GitHub sends a "ping" event when a webhook is created, or redelivered from the settings page
+func TestGitHubWebhookHandler_ping(t *testing.T) {
+	t.Parallel()
+
+	recorder := newGitHubWebhook(t, "")(`{"zen":"Keep it logically awesome.","hook_id":1}`, githubHeaders("ping"))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "pong", recorder.Body.String())
+}
+
+// Events that do not concern a Pull Request are acknowledged without evaluating anything.
+func TestGitHubWebhookHandler_ignoresEventsWithoutPullRequests(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		event string
+		body  string
+	}{
+		{
+			name:  "comment on an issue",
+			event: "issue_comment",
+			body:  `{"action":"created","repository":{"full_name":"jippi/scm-engine"},"issue":{"number":1}}`,
+		},
+		{
+			name:  "check suite for a branch without Pull Requests",
+			event: "check_suite",
+			body:  `{"action":"completed","repository":{"full_name":"jippi/scm-engine"},"check_suite":{"head_sha":"abc123","pull_requests":[]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := newGitHubWebhook(t, "")(tt.body, githubHeaders(tt.event))
+
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.Contains(t, recorder.Body.String(), "no Pull Requests to evaluate")
+		})
+	}
+}
+
+// Each supported event type carries the Pull Request number and HEAD commit in
+// different places in the payload, so every shape has to be understood.
+func TestGitHubWebhookPayload_Targets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		event   string
+		payload GitHubWebhookPayload
+		want    []GitHubWebhookTarget
+	}{
+		{
+			name:    "pull_request",
+			event:   "pull_request",
+			payload: GitHubWebhookPayload{PullRequest: &GitHubWebhookPayloadPullRequest{Number: 42, Head: GitHubWebhookPayloadHead{SHA: "abc123"}}},
+			want:    []GitHubWebhookTarget{{ID: "42", SHA: "abc123"}},
+		},
+		{
+			name:    "pull_request_review",
+			event:   "pull_request_review",
+			payload: GitHubWebhookPayload{PullRequest: &GitHubWebhookPayloadPullRequest{Number: 42, Head: GitHubWebhookPayloadHead{SHA: "abc123"}}},
+			want:    []GitHubWebhookTarget{{ID: "42", SHA: "abc123"}},
+		},
+		{
+			name:    "issue_comment on a Pull Request has no commit",
+			event:   "issue_comment",
+			payload: GitHubWebhookPayload{Issue: &GitHubWebhookPayloadIssue{Number: 42, PullRequest: &struct{}{}}},
+			want:    []GitHubWebhookTarget{{ID: "42"}},
+		},
+		{
+			name:    "issue_comment on an Issue",
+			event:   "issue_comment",
+			payload: GitHubWebhookPayload{Issue: &GitHubWebhookPayloadIssue{Number: 42}},
+			want:    nil,
+		},
+		{
+			name:  "check_suite falls back to the suite HEAD commit",
+			event: "check_suite",
+			payload: GitHubWebhookPayload{CheckSuite: &GitHubWebhookPayloadCheckSuite{
+				HeadSHA: "suite-sha",
+				PullRequests: []GitHubWebhookPayloadPullRequest{
+					{Number: 1, Head: GitHubWebhookPayloadHead{SHA: "pr-sha"}},
+					{Number: 2},
+				},
+			}},
+			want: []GitHubWebhookTarget{{ID: "1", SHA: "pr-sha"}, {ID: "2", SHA: "suite-sha"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.payload.Targets(tt.event)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGitHubWebhookPayload_Targets_missingFields(t *testing.T) {
+	t.Parallel()
+
+	for _, event := range []string{"pull_request", "pull_request_review", "issue_comment", "check_suite"} {
+		t.Run(event, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := GitHubWebhookPayload{}.Targets(event)
+			require.ErrorContains(t, err, "is missing the")
+			require.NotErrorIs(t, err, errUnsupportedGitHubEvent)
+		})
+	}
+}
+
+func TestGitHubWebhookPayload_IsOwnCheckSuite(t *testing.T) {
+	t.Parallel()
+
+	ownSuite := GitHubWebhookPayload{CheckSuite: &GitHubWebhookPayloadCheckSuite{App: GitHubWebhookPayloadApp{ID: 42}}}
+
+	tests := []struct {
+		name    string
+		payload GitHubWebhookPayload
+		appID   int64
+		want    bool
+	}{
+		{name: "check suite created by the app", payload: ownSuite, appID: 42, want: true},
+		{name: "check suite created by another app", payload: ownSuite, appID: 7, want: false},
+		{name: "not authenticated as an app", payload: GitHubWebhookPayload{CheckSuite: &GitHubWebhookPayloadCheckSuite{}}, appID: 0, want: false},
+		{name: "not a check suite event", payload: GitHubWebhookPayload{PullRequest: &GitHubWebhookPayloadPullRequest{}}, appID: 42, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, tt.payload.IsOwnCheckSuite(tt.appID))
+		})
+	}
+}
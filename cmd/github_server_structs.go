@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// errUnsupportedGitHubEvent is returned for event types scm-engine does not evaluate Pull Requests for,
+// which GitHub sends when the webhook or App is subscribed to more events (e.g. "push" or "installation")
+var errUnsupportedGitHubEvent = errors.New("unsupported event type")
+
+type GitHubWebhookPayload struct {
+	Action      string                           `json:"action"`
+	Repository  GitHubWebhookPayloadRepository   `json:"repository"`             // "repository" is sent for all events
+	PullRequest *GitHubWebhookPayloadPullRequest `json:"pull_request,omitempty"` // "pull_request" is sent on "pull_request" and "pull_request_review" events
+	Issue       *GitHubWebhookPayloadIssue       `json:"issue,omitempty"`        // "issue" is sent on "issue_comment" events
+	CheckSuite  *GitHubWebhookPayloadCheckSuite  `json:"check_suite,omitempty"`  // "check_suite" is sent on "check_suite" events
+}
+
+type GitHubWebhookPayloadRepository struct {
+	FullName string `json:"full_name"`
+}
+
+type GitHubWebhookPayloadPullRequest struct {
+	Number int                      `json:"number"`
+	Head   GitHubWebhookPayloadHead `json:"head"`
+}
+
+type GitHubWebhookPayloadHead struct {
+	SHA string `json:"sha"`
+}
+
+type GitHubWebhookPayloadIssue struct {
+	Number int `json:"number"`
+
+	// PullRequest is only present when the comment was made on a Pull Request rather than an Issue
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+}
+
+type GitHubWebhookPayloadCheckSuite struct {
+	HeadSHA      string                            `json:"head_sha"`
+	PullRequests []GitHubWebhookPayloadPullRequest `json:"pull_requests"`
+	App          GitHubWebhookPayloadApp           `json:"app"`
+}
+
+type GitHubWebhookPayloadApp struct {
+	ID int64 `json:"id"`
+}
+
+// GitHubWebhookTarget is a single Pull Request (and optionally its HEAD commit) a webhook event should evaluate
+type GitHubWebhookTarget struct {
+	ID  string
+	SHA string
+}
+
+// IsOwnCheckSuite returns whether the event is about a check suite created by the GitHub App with the provided ID.
+//
+// When authenticated as a GitHub App, completing our own "scm-engine" check run triggers a "check_suite"
+// event, which must be ignored to avoid evaluating the Pull Request in an endless loop.
+func (payload GitHubWebhookPayload) IsOwnCheckSuite(appID int64) bool {
+	return appID != 0 && payload.CheckSuite != nil && payload.CheckSuite.App.ID == appID
+}
+
+// Targets returns the Pull Requests the webhook event refers to.
+//
+// The SHA is empty when the event payload does not include the HEAD commit of the Pull Request
+// (e.g. "issue_comment"), and an empty list is returned for events that do not concern a Pull Request at all.
+func (payload GitHubWebhookPayload) Targets(eventType string) ([]GitHubWebhookTarget, error) {
+	switch eventType {
+	case "pull_request", "pull_request_review":
+		if payload.PullRequest == nil {
+			return nil, fmt.Errorf("event type %s is missing the 'pull_request' field", eventType)
+		}
+
+		return []GitHubWebhookTarget{{ID: strconv.Itoa(payload.PullRequest.Number), SHA: payload.PullRequest.Head.SHA}}, nil
+
+	case "issue_comment":
+		if payload.Issue == nil {
+			return nil, fmt.Errorf("event type %s is missing the 'issue' field", eventType)
+		}
+
+		// Comments on regular Issues are not relevant
+		if payload.Issue.PullRequest == nil {
+			return nil, nil
+		}
+
+		return []GitHubWebhookTarget{{ID: strconv.Itoa(payload.Issue.Number)}}, nil
+
+	case "check_suite":
+		if payload.CheckSuite == nil {
+			return nil, fmt.Errorf("event type %s is missing the 'check_suite' field", eventType)
+		}
+
+		targets := make([]GitHubWebhookTarget, 0, len(payload.CheckSuite.PullRequests))
+
+		for _, pullRequest := range payload.CheckSuite.PullRequests {
+			sha := pullRequest.Head.SHA
+			if len(sha) == 0 {
+				sha = payload.CheckSuite.HeadSHA
+			}
+
+			targets = append(targets, GitHubWebhookTarget{ID: strconv.Itoa(pullRequest.Number), SHA: sha})
+		}
+
+		return targets, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedGitHubEvent, eventType)
+	}
+}
@@ -15,6 +15,7 @@ var GitLab = &cli.Command{
 		cCtx.Context = state.WithProvider(cCtx.Context, "gitlab")
 		cCtx.Context = state.WithToken(cCtx.Context, cCtx.String(FlagAPIToken))
 		cCtx.Context = state.WithGlobalConfigFilePath(cCtx.Context, cCtx.String(FlagGlobalConfigFile))
+		cCtx.Context = state.WithIncludeMaxDepth(cCtx.Context, cCtx.Int(FlagIncludeMaxDepth))
 
 		return nil
 	},
@@ -43,8 +44,11 @@ var GitLab = &cli.Command{
 				"SCM_ENGINE_GLOBAL_CONFIG_FILE",
 			},
 		},
+		IntFlagIncludeMaxDepth,
 	},
 	Subcommands: []*cli.Command{
+		newDeadLettersCommand(),
+		newHistoryCommand(),
 		{
 			Name:   "lint",
 			Usage:  "lint a configuration file",
@@ -104,6 +108,8 @@ var GitLab = &cli.Command{
 				},
 				StringFlagBackstageURL,
 				StringFlagBackstageToken,
+				StringFlagHistoryPath,
+				DurationFlagHistoryRetention,
 			},
 		},
 		{
@@ -144,6 +150,19 @@ var GitLab = &cli.Command{
 						"SCM_ENGINE_TIMEOUT",
 					},
 				},
+				IntFlagServerWorkers,
+				IntFlagServerQueueSize,
+				StringFlagServerQueuePath,
+				IntFlagServerQueueMaxAttempts,
+				DurationFlagServerQueueRetryBackoff,
+				DurationFlagServerDebounce,
+				StringFlagLockBackend,
+				StringFlagLockRedisURL,
+				DurationFlagLockTTL,
+				StringFlagAdminToken,
+				DurationFlagGlobalConfigReloadInterval,
+				StringFlagHistoryPath,
+				DurationFlagHistoryRetention,
 				&cli.BoolFlag{
 					Name:  FlagUpdatePipeline,
 					Usage: "Update the CI pipeline status with progress",
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/history"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	"github.com/urfave/cli/v2"
@@ -19,6 +20,7 @@ func Evaluate(cCtx *cli.Context) error {
 	ctx = state.WithUpdatePipeline(ctx, cCtx.Bool(FlagUpdatePipeline), cCtx.String(FlagUpdatePipelineURL))
 	ctx = state.WithRandomSeed(ctx, time.Now().UnixNano()) // weak seed since only used for codeowner selection
 	ctx = state.WithGlobalConfigFilePath(ctx, cCtx.String(FlagGlobalConfigFile))
+	ctx = state.WithTrigger(ctx, "cli")
 
 	// Optional Backstage catalog integration
 	ctx = state.WithBackstageURL(ctx, cCtx.String(FlagBackstageURL))
@@ -28,7 +30,7 @@ func Evaluate(cCtx *cli.Context) error {
 	// Setup global config if present
 	//
 	if state.GlobalConfigFilePath(ctx) != "" {
-		globalCfg, err := config.LoadFile(state.GlobalConfigFilePath(ctx))
+		globalCfg, err := loadConfigFile(ctx, state.GlobalConfigFilePath(ctx), nil)
 		if err != nil {
 			return err
 		}
@@ -36,7 +38,20 @@ func Evaluate(cCtx *cli.Context) error {
 		ctx = config.WithGlobalConfig(ctx, globalCfg)
 	}
 
-	cfg, err := config.LoadFile(state.ConfigFilePath(ctx))
+	//
+	// Setup evaluation history if enabled
+	//
+	if path := cCtx.String(FlagHistoryPath); len(path) > 0 {
+		store, err := history.Open(ctx, path, cCtx.Duration(FlagHistoryRetention))
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		ctx = history.WithStore(ctx, store)
+	}
+
+	cfg, err := loadConfigFile(ctx, state.ConfigFilePath(ctx), nil)
 	if err != nil {
 		return err
 	}
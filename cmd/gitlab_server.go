@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -13,6 +15,9 @@ import (
 	"time"
 
 	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	"github.com/urfave/cli/v2"
@@ -36,16 +41,87 @@ func Server(cCtx *cli.Context) error {
 	ctx = slogctx.With(ctx, slog.String("gitlab_url", cCtx.String(FlagSCMBaseURL)))
 	ctx = slogctx.With(ctx, slog.Duration("server_timeout", cCtx.Duration(FlagServerTimeout)))
 
+	if cCtx.Int(FlagServerWorkers) < 1 {
+		return fmt.Errorf("--%s must be at least 1", FlagServerWorkers)
+	}
+
+	if cCtx.Int(FlagServerQueueSize) < 0 {
+		return fmt.Errorf("--%s must not be negative", FlagServerQueueSize)
+	}
+
+	if cCtx.Int(FlagServerQueueMaxAttempts) < 1 {
+		return fmt.Errorf("--%s must be at least 1", FlagServerQueueMaxAttempts)
+	}
+
+	//
+	// Setup locking, shared between replicas when using a shared lock backend
+	//
+
+	locker, err := newLocker(cCtx.String(FlagLockBackend), cCtx.String(FlagLockRedisURL), cCtx.Duration(FlagLockTTL))
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := locker.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	ctx = state.WithLocker(ctx, locker)
+
 	//
-	// Setup global config if present
+	// Setup global config if present, reloading it on SIGHUP and when it changed on disk
 	//
+	var globalConfig *globalConfigReloader
+
 	if state.GlobalConfigFilePath(ctx) != "" {
-		globalCfg, err := config.LoadFile(state.GlobalConfigFilePath(ctx))
+		globalConfig = newGlobalConfigReloader(state.GlobalConfigFilePath(ctx))
+
+		if err := globalConfig.Reload(ctx, true); err != nil {
+			return err
+		}
+
+		ctx = config.WithGlobalConfigSource(ctx, globalConfig)
+	}
+
+	//
+	// Setup evaluation history if enabled
+	//
+	if path := cCtx.String(FlagHistoryPath); len(path) > 0 {
+		historyStore, err := history.Open(ctx, path, cCtx.Duration(FlagHistoryRetention))
 		if err != nil {
 			return err
 		}
+		defer historyStore.Close()
+
+		ctx = history.WithStore(ctx, historyStore)
+	}
+
+	//
+	// Setup webhook workers
+	//
+
+	client, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
 
-		ctx = config.WithGlobalConfig(ctx, globalCfg)
+	store, err := eventstore.Open(ctx, cCtx.String(FlagServerQueuePath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	retry := webhookRetryPolicy{
+		MaxAttempts: cCtx.Int(FlagServerQueueMaxAttempts),
+		Backoff:     cCtx.Duration(FlagServerQueueRetryBackoff),
+	}
+
+	queue := newWebhookQueue(cCtx.Int(FlagServerQueueSize))
+	queue.Start(ctx, cCtx.Int(FlagServerWorkers))
+
+	dispatcher := newWebhookDispatcher(ctx, queue, store, retry, cCtx.Duration(FlagServerDebounce), processStoredWebhookEvent(client))
+	if err := dispatcher.Start(); err != nil {
+		return err
 	}
 
 	//
@@ -62,8 +138,25 @@ func Server(cCtx *cli.Context) error {
 		SCMConfigurationFilePath:     cCtx.String(FlagConfigFile),
 	}
 
+	periodicStatus := &periodicEvaluationStatus{}
+
 	evalCtx, stopPeriodicEvaluation := context.WithCancel(ctx)
-	startPeriodicEvaluation(evalCtx, cCtx.Duration(FlagPeriodicEvaluationInterval), filter, &wg)
+	startPeriodicEvaluation(evalCtx, cCtx.Duration(FlagPeriodicEvaluationInterval), filter, periodicStatus, &wg)
+
+	if globalConfig != nil {
+		globalConfig.Watch(evalCtx, cCtx.Duration(FlagGlobalConfigReloadInterval), &wg)
+	}
+
+	//
+	// Setup health checks
+	//
+
+	readiness := &readinessChecker{
+		scm:          newCachedPinger(client, scmPingCacheTTL),
+		backstage:    newBackstagePinger(ctx, state.BackstageURL(ctx), state.BackstageToken(ctx)),
+		globalConfig: globalConfig,
+		periodic:     periodicStatus,
+	}
 
 	//
 	// Setup HTTP server
@@ -74,7 +167,30 @@ func Server(cCtx *cli.Context) error {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /_status", GitLabStatusHandler)
-	mux.HandleFunc("POST /gitlab", GitLabWebhookHandler(ctx, cCtx.String(FlagWebhookSecret)))
+	mux.HandleFunc("GET /healthz", HealthzHandler)
+	mux.HandleFunc("GET /readyz", ReadyzHandler(readiness))
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	if token := cCtx.String(FlagAdminToken); len(token) > 0 {
+		admin := &adminAPI{
+			ctx:      evalCtx,
+			token:    token,
+			client:   client,
+			filter:   filter,
+			periodic: periodicStatus,
+			wg:       &wg,
+		}
+
+		admin.Register(mux)
+	}
+
+	switch state.Provider(ctx) {
+	case "github":
+		mux.HandleFunc("POST /github", GitHubWebhookHandler(cCtx.String(FlagWebhookSecret), dispatcher))
+
+	default:
+		mux.HandleFunc("POST /gitlab", GitLabWebhookHandler(cCtx.String(FlagWebhookSecret), dispatcher))
+	}
 
 	server := &http.Server{
 		Addr:         listenAddr,
@@ -130,7 +246,15 @@ func Server(cCtx *cli.Context) error {
 
 	slogctx.Info(ctx, "Graceful HTTP shutdown complete")
 
-	wg.Wait() // Wait for PeriodicEvaluation to complete
+	// The HTTP server no longer accepts webhooks, so finish the ones already queued;
+	// anything left in the event store is replayed on next startup
+	if err := dispatcher.Shutdown(shutdownCtx); err != nil {
+		slogctx.Error(ctx, "Webhook queue shutdown error", slog.Any("error", err))
+	}
+
+	slogctx.Info(ctx, "Graceful webhook queue shutdown complete")
+
+	wg.Wait() // Wait for PeriodicEvaluation and the global configuration reloader to complete
 
 	slogctx.Info(ctx, "Graceful shutdown complete")
 
@@ -9,9 +9,9 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
 
-	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
 )
@@ -22,19 +22,21 @@ func GitLabStatusHandler(w http.ResponseWriter, r *http.Request) {
 	slogctx.Debug(ctx, "GET /_status")
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("scm-engine status: OK\n\nNOTE: this is a static 'OK', no actual checks are being made"))
+	w.Write([]byte("scm-engine status: OK\n\nNOTE: this is a static 'OK', use /readyz for actual checks"))
 }
 
-func GitLabWebhookHandler(ctx context.Context, webhookSecret string) http.HandlerFunc {
-	// Initialize GitLab client
-	client, err := getClient(ctx)
-	if err != nil {
-		panic(err)
-	}
-
+func GitLabWebhookHandler(webhookSecret string, dispatcher *webhookDispatcher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		// The event type is only known once the payload has been decoded
+		eventType := "unknown"
+
+		recorder := newWebhookResponseRecorder(w)
+		defer func() { countReceivedWebhookEvent("gitlab", eventType, recorder.status) }()
+
+		w = recorder
+
 		// Check if the webhook secret is set (and if its matching)
 		if len(webhookSecret) > 0 {
 			theirSecret := r.Header.Get("X-Gitlab-Token")
@@ -75,75 +77,76 @@ func GitLabWebhookHandler(ctx context.Context, webhookSecret string) http.Handle
 			return
 		}
 
-		// Initialize context
-		ctx = state.WithProjectID(ctx, payload.Project.PathWithNamespace)
+		eventType = payload.EventType
 
 		// Grab event specific information
-		var (
-			id     string
-			gitSha string
-		)
-
-		switch payload.EventType {
-		case "merge_request":
-			id = strconv.Itoa(payload.ObjectAttributes.IID)
-			gitSha = payload.ObjectAttributes.LastCommit.ID
-
-		case "note":
-			id = strconv.Itoa(payload.MergeRequest.IID)
-			gitSha = payload.MergeRequest.LastCommit.ID
-
-		default:
-			errHandler(ctx, w, http.StatusInternalServerError, fmt.Errorf("unknown event type: %s", payload.EventType))
+		id, gitSha, err := payload.Target()
+		if err != nil {
+			errHandler(ctx, w, http.StatusInternalServerError, err)
 
 			return
 		}
 
-		// Build context for rest of the pipeline
-		ctx = state.WithCommitSHA(ctx, gitSha)
+		// Initialize context for logging; the worker builds its own context from the stored event
+		ctx = state.WithProjectID(ctx, payload.Project.PathWithNamespace)
 		ctx = state.WithMergeRequestID(ctx, id)
 		ctx = slogctx.With(ctx, slog.String("event_type", payload.EventType))
 
-		slogctx.Info(ctx, "GET /gitlab webhook")
+		slogctx.Info(ctx, "POST /gitlab webhook")
 
-		// Decode request payload into 'any' so we have all the details
-		var fullEventPayload any
-		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&fullEventPayload); err != nil {
+		// Store and queue the MR for processing
+		accepted, err := dispatcher.Submit(ctx, eventstore.Event{
+			Provider:  "gitlab",
+			EventType: payload.EventType,
+			Payload:   body,
+			DedupeKey: webhookDedupeKey("gitlab", payload.Project.PathWithNamespace, id),
+			CommitSHA: gitSha,
+		})
+		if err != nil {
 			errHandler(ctx, w, http.StatusInternalServerError, err)
 
 			return
 		}
 
-		// Check if there exists scm-config file in the repo before moving forward
-		file, err := client.MergeRequests().GetRemoteConfig(ctx, state.ConfigFilePath(ctx), state.CommitSHA(ctx))
-		// only error when global config is not set
-		if err != nil && state.GlobalConfigFilePath(ctx) == "" {
-			errHandler(ctx, w, http.StatusOK, err)
+		if !accepted {
+			errHandler(ctx, w, http.StatusServiceUnavailable, errors.New("The webhook queue is full; try again later"))
 
 			return
 		}
 
-		// Try to parse the config file
-		//
-		// In case of a parse error cfg remains "nil" and ProcessMR will try to read-and-parse it
-		// (but obviously also fail), but will surface the error within the GitLab External Pipeline (if enabled)
-		// which will surface the issue to the end-user directly
-		var cfg *config.Config
-		if file != nil { // file could be nil if no scm-config file is found when global config is set
-			cfg, _ = config.ParseFile(file)
-		} else {
-			// avoid trying to read-and-parse again if global config is set
-			cfg = config.GlobalConfigFromContext(ctx)
-		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Accepted"))
+	}
+}
 
-		// Process the MR
-		if err := ProcessMR(ctx, client, cfg, fullEventPayload); err != nil {
-			errHandler(ctx, w, http.StatusOK, err)
+// processGitLabWebhookEvent evaluates the Merge Request a stored GitLab webhook event refers to
+func processGitLabWebhookEvent(ctx context.Context, client scm.Client, event eventstore.Event) error {
+	var payload GitlabWebhookPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return permanentError{fmt.Errorf("could not decode payload: %w", err)}
+	}
 
-			return
-		}
+	id, gitSha, err := payload.Target()
+	if err != nil {
+		return permanentError{err}
+	}
+
+	// Collapsed events carry the latest commit SHA, which may be newer than the one in the payload
+	if len(event.CommitSHA) > 0 {
+		gitSha = event.CommitSHA
+	}
+
+	// Build context for rest of the pipeline
+	ctx = state.WithProjectID(ctx, payload.Project.PathWithNamespace)
+	ctx = state.WithCommitSHA(ctx, gitSha)
+	ctx = state.WithMergeRequestID(ctx, id)
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	// Decode request payload into 'any' so we have all the details
+	var fullEventPayload any
+	if err := json.Unmarshal(event.Payload, &fullEventPayload); err != nil {
+		return permanentError{err}
 	}
+
+	// Process the MR
+	return processWebhookEvent(ctx, client, fullEventPayload)
 }
@@ -34,6 +34,12 @@ func TestGitLabStatusHandler(t *testing.T) {
 func newWebhook(t *testing.T, secret string) func(string, map[string]string) *httptest.ResponseRecorder {
 	t.Helper()
 
+	return newWebhookWithQueue(t, secret, 1, 1)
+}
+
+func newWebhookWithQueue(t *testing.T, secret string, workers, queueSize int) func(string, map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
 	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, `{"message":"404 Not Found"}`, http.StatusNotFound)
 	}))
@@ -49,7 +55,7 @@ func newWebhook(t *testing.T, secret string) func(string, map[string]string) *ht
 	ctx = state.WithDryRun(ctx, true)
 	ctx = state.WithUpdatePipeline(ctx, false, "")
 
-	handler := GitLabWebhookHandler(ctx, secret)
+	handler := GitLabWebhookHandler(secret, newTestWebhookDispatcher(t, ctx, workers, queueSize))
 
 	return func(body string, headers map[string]string) *httptest.ResponseRecorder {
 		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/gitlab", strings.NewReader(body))
@@ -215,9 +221,28 @@ func TestGitLabWebhookHandler_acceptsSupportedEventTypes(t *testing.T) {
 			recorder := newWebhook(t, "")(tt.body, jsonHeaders)
 
 			// The payload is understood, so the handler gets past validation and
-			// on to fetching the config, which the stand-in answers with a 404.
-			require.NotEqual(t, http.StatusInternalServerError, recorder.Code)
+			// queues the evaluation, which the stand-in answers with a 404 later.
+			require.Equal(t, http.StatusAccepted, recorder.Code)
 			require.NotContains(t, recorder.Body.String(), "unknown event type")
 		})
 	}
 }
+
+// A webhook that can't be queued must be answered with a 503 so GitLab retries
+// the delivery, rather than being accepted and silently dropped.
+func TestGitLabWebhookHandler_rejectsWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	// No workers, so the single slot in the queue is never freed
+	send := newWebhookWithQueue(t, "", 0, 1)
+
+	body := `{"event_type":"merge_request","project":{"path_with_namespace":"jippi/scm-engine"},` +
+		`"object_attributes":{"iid":42,"last_commit":{"id":"abc123"}}}`
+
+	recorder := send(body, jsonHeaders)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	recorder = send(body, jsonHeaders)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "queue is full")
+}
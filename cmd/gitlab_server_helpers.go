@@ -2,10 +2,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
 )
 
@@ -21,3 +29,78 @@ func errHandler(ctx context.Context, w http.ResponseWriter, code int, err error)
 	// error message can never be interpreted as markup by the client.
 	http.Error(w, err.Error(), code)
 }
+
+// processWebhookEvent reads the scm-engine configuration for the Merge Request in the context
+// and evaluates it with the webhook event payload exposed to scripts.
+func processWebhookEvent(ctx context.Context, client scm.Client, event any) error {
+	// Use the same version of the global configuration for the whole evaluation, even when it's reloaded meanwhile
+	ctx = config.WithGlobalConfigSnapshot(ctx)
+
+	// Check if there exists scm-config file in the repo before moving forward
+	file, err := client.MergeRequests().GetRemoteConfig(ctx, state.ConfigFilePath(ctx), state.CommitSHA(ctx))
+	// only error when global config is not set
+	if err != nil && state.GlobalConfigFilePath(ctx) == "" {
+		return err
+	}
+
+	// Try to parse the config file
+	//
+	// In case of a parse error cfg remains "nil" and ProcessMR will try to read-and-parse it
+	// (but obviously also fail), but will surface the error within the GitLab External Pipeline (if enabled)
+	// which will surface the issue to the end-user directly
+	var cfg *config.Config
+	if file != nil { // file could be nil if no scm-config file is found when global config is set
+		cfg, _ = config.ParseFile(file)
+	} else {
+		// avoid trying to read-and-parse again if global config is set
+		cfg = config.GlobalConfigFromContext(ctx)
+	}
+
+	// Process the MR
+	return ProcessMR(ctx, client, cfg, event)
+}
+
+// processStoredWebhookEvent returns the processor evaluating stored webhook events from either provider
+func processStoredWebhookEvent(client scm.Client) webhookEventProcessor {
+	return func(ctx context.Context, event eventstore.Event) error {
+		// The client can only talk to the provider the server was started for
+		if event.Provider != state.Provider(ctx) {
+			return permanentError{fmt.Errorf("event is for provider %q, but the server is running for %q", event.Provider, state.Provider(ctx))}
+		}
+
+		ctx = state.WithTrigger(ctx, event.EventType)
+
+		switch event.Provider {
+		case "github":
+			return processGitHubWebhookEvent(ctx, client, event)
+
+		case "gitlab":
+			return processGitLabWebhookEvent(ctx, client, event)
+
+		default:
+			return permanentError{fmt.Errorf("unknown provider %q - we only support 'github' and 'gitlab'", event.Provider)}
+		}
+	}
+}
+
+// newLocker returns the lock backend configured by the CLI flags
+func newLocker(backend, redisURL string, ttl time.Duration) (lock.Locker, error) {
+	switch backend {
+	case "memory":
+		return lock.NewMemory(), nil
+
+	case "redis":
+		if len(redisURL) == 0 {
+			return nil, errors.New("the 'redis' lock backend requires a Redis URL")
+		}
+
+		if ttl < time.Second {
+			return nil, fmt.Errorf("the lock TTL must be at least 1s, got %s", ttl)
+		}
+
+		return lock.NewRedisFromURL(redisURL, ttl)
+
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q - we only support 'memory' and 'redis'", backend)
+	}
+}
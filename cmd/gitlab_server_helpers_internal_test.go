@@ -0,0 +1,45 @@
+//nolint:testpackage // newLocker is unexported
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLocker(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		backend  string
+		redisURL string
+		ttl      time.Duration
+		want     string
+		wantErr  string
+	}{
+		{name: "memory", backend: "memory", want: "memory"},
+		{name: "redis", backend: "redis", redisURL: "redis://localhost:6379/0", ttl: lock.DefaultRedisTTL, want: "redis"},
+		{name: "redis without URL", backend: "redis", ttl: lock.DefaultRedisTTL, wantErr: "requires a Redis URL"},
+		{name: "redis with a tiny TTL", backend: "redis", redisURL: "redis://localhost:6379/0", ttl: time.Millisecond, wantErr: "must be at least 1s"},
+		{name: "unknown backend", backend: "etcd", wantErr: `unknown lock backend "etcd"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			locker, err := newLocker(tt.backend, tt.redisURL, tt.ttl)
+			if len(tt.wantErr) > 0 {
+				require.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, locker.Name())
+		})
+	}
+}
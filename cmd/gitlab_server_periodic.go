@@ -9,12 +9,13 @@ import (
 	"time"
 
 	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
 )
 
-func startPeriodicEvaluation(ctx context.Context, interval time.Duration, filter scm.MergeRequestListFilters, wg *sync.WaitGroup) {
+func startPeriodicEvaluation(ctx context.Context, interval time.Duration, filter scm.MergeRequestListFilters, status *periodicEvaluationStatus, wg *sync.WaitGroup) {
 	// Empty interval means disabling
 	if interval == 0 {
 		slogctx.Warn(ctx, "scm-engine will not be doing periodic evaluation since interval is '0'. Set 'SCM_ENGINE_PERIODIC_EVALUATION_INTERVAL' or '--periodic-evaluation-interval'  to a non-zero duration to activate")
@@ -34,6 +35,8 @@ func startPeriodicEvaluation(ctx context.Context, interval time.Duration, filter
 		interval = 15 * time.Minute
 	}
 
+	status.Enable(interval)
+
 	// Initialize the SCM-Engine client
 	client, err := getClient(ctx)
 	if err != nil {
@@ -46,6 +49,7 @@ func startPeriodicEvaluation(ctx context.Context, interval time.Duration, filter
 		slog.Duration("periodic_evaluation_interval", interval),
 		slog.String("event_type", "periodic_evaluation"),
 	)
+	ctx = state.WithTrigger(ctx, "periodic_evaluation")
 
 	go func(wg *sync.WaitGroup) {
 		defer wg.Done() // -1: Periodic Evaluation
@@ -63,56 +67,68 @@ func startPeriodicEvaluation(ctx context.Context, interval time.Duration, filter
 				return
 
 			case <-ticker.C:
-				// Track all log output back to a periodic evaluation cycle
-				ctx := slogctx.With(ctx, slog.String("periodic_eval_id", sid.MustGenerate()))
+				runPeriodicEvaluationCycle(ctx, client, filter, status)
+			} // end select
+		} // end loop
+	}(wg)
+}
+
+// runPeriodicEvaluationCycle evaluates all Merge Requests matching filter once
+func runPeriodicEvaluationCycle(ctx context.Context, client scm.Client, filter scm.MergeRequestListFilters, status *periodicEvaluationStatus) {
+	// Track all log output back to a periodic evaluation cycle
+	ctx = slogctx.With(ctx, slog.String("periodic_eval_id", sid.MustGenerate()))
+
+	slogctx.Info(ctx, "Starting periodic evaluation cycle")
+
+	start := time.Now()
 
-				slogctx.Info(ctx, "Starting periodic evaluation cycle")
+	results, err := client.FindMergeRequestsForPeriodicEvaluation(ctx, filter)
+	if err != nil {
+		slogctx.Error(ctx, "Failed to generate merge request list to evaluate", slog.Any("error", err))
+
+		return
+	}
 
-				results, err := client.FindMergeRequestsForPeriodicEvaluation(ctx, filter)
-				if err != nil {
-					slogctx.Error(ctx, "Failed to generate merge request list to evaluate", slog.Any("error", err))
+	metrics.PeriodicEvaluationMergeRequests.Set(float64(len(results)))
 
-					continue
-				}
+	slogctx.Info(ctx, fmt.Sprintf("Found %d Merge Requests to evaluate", len(results)), slog.Int("number_of_projects", len(results)))
 
-				slogctx.Info(ctx, fmt.Sprintf("Found %d Merge Requests to evaluate", len(results)), slog.Int("number_of_projects", len(results)))
+	for _, mergeRequest := range results {
+		ctx := ctx // make sure we define a fresh GC-able context per merge request so we don't append to the existing forever
+		ctx = state.WithCommitSHA(ctx, mergeRequest.SHA)
+		ctx = state.WithMergeRequestID(ctx, mergeRequest.MergeRequestID)
+		ctx = state.WithProjectID(ctx, mergeRequest.Project)
 
-				for _, mergeRequest := range results {
-					ctx := ctx // make sure we define a fresh GC-able context per merge request so we don't append to the existing forever
-					ctx = state.WithCommitSHA(ctx, mergeRequest.SHA)
-					ctx = state.WithMergeRequestID(ctx, mergeRequest.MergeRequestID)
-					ctx = state.WithProjectID(ctx, mergeRequest.Project)
+		if !mergeRequest.UpdatePipeline {
+			slogctx.Info(ctx, "Disabling CI pipeline commit status updating since the MR HEAD CI pipeline is in a failed state")
 
-					if !mergeRequest.UpdatePipeline {
-						slogctx.Info(ctx, "Disabling CI pipeline commit status updating since the MR HEAD CI pipeline is in a failed state")
+			ctx = state.WithUpdatePipeline(ctx, false, "")
+		}
 
-						ctx = state.WithUpdatePipeline(ctx, false, "")
-					}
+		if len(mergeRequest.ConfigBlob) == 0 {
+			slogctx.Warn(ctx, "Could not find the scm-engine configuration file in the repository, skipping...")
 
-					if len(mergeRequest.ConfigBlob) == 0 {
-						slogctx.Warn(ctx, "Could not find the scm-engine configuration file in the repository, skipping...")
+			continue
+		}
 
-						continue
-					}
+		// Parse the file
+		cfg, err := config.ParseFile(strings.NewReader(mergeRequest.ConfigBlob))
+		if err != nil {
+			slogctx.Error(ctx, "could not parse config file", slog.Any("error", err))
 
-					// Parse the file
-					cfg, err := config.ParseFile(strings.NewReader(mergeRequest.ConfigBlob))
-					if err != nil {
-						slogctx.Error(ctx, "could not parse config file", slog.Any("error", err))
+			continue
+		}
 
-						continue
-					}
+		// Process the Merge Request
+		if err := ProcessMR(ctx, client, cfg, nil); err != nil {
+			slogctx.Error(ctx, "failed to process MR", slog.Any("error", err))
 
-					// Process the Merge Request
-					if err := ProcessMR(ctx, client, cfg, nil); err != nil {
-						slogctx.Error(ctx, "failed to process MR", slog.Any("error", err))
+			continue
+		}
+	}
 
-						continue
-					}
-				} // end loop results
+	metrics.PeriodicEvaluationDuration.Observe(time.Since(start).Seconds())
+	status.Completed(time.Now())
 
-				slogctx.Info(ctx, "Completed periodic evaluation cycle")
-			} // end select
-		} // end loop
-	}(wg)
+	slogctx.Info(ctx, "Completed periodic evaluation cycle")
 }
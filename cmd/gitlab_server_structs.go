@@ -1,5 +1,10 @@
 package cmd
 
+import (
+	"fmt"
+	"strconv"
+)
+
 type GitlabWebhookPayload struct {
 	EventType        string                            `json:"event_type"`
 	Project          GitlabWebhookPayloadProject       `json:"project"`                     // "project" is sent for all events
@@ -19,3 +24,25 @@ type GitlabWebhookPayloadMergeRequest struct {
 type GitlabWebhookPayloadCommit struct {
 	ID string `json:"id"`
 }
+
+// Target returns the Merge Request IID and HEAD commit SHA the webhook event refers to
+func (payload GitlabWebhookPayload) Target() (id string, sha string, err error) {
+	var mergeRequest *GitlabWebhookPayloadMergeRequest
+
+	switch payload.EventType {
+	case "merge_request":
+		mergeRequest = payload.ObjectAttributes
+
+	case "note":
+		mergeRequest = payload.MergeRequest
+
+	default:
+		return "", "", fmt.Errorf("unknown event type: %s", payload.EventType)
+	}
+
+	if mergeRequest == nil {
+		return "", "", fmt.Errorf("event type %s is missing the Merge Request", payload.EventType)
+	}
+
+	return strconv.Itoa(mergeRequest.IID), mergeRequest.LastCommit.ID, nil
+}
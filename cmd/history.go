@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flagHistoryLimit = "limit"
+	flagHistoryJSON  = "json"
+)
+
+// newHistoryCommand returns the "history" command, showing the evaluation timeline of a Merge Request.
+//
+// Each provider gets its own instance, since the CLI framework mutates commands while setting them up.
+func newHistoryCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "history",
+		Usage:     "Show the evaluation timeline of a Merge Request",
+		Args:      true,
+		ArgsUsage: " mr_id",
+		Action:    History,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      FlagHistoryPath,
+				Usage:     "Path to the SQLite file evaluations are recorded in",
+				Required:  true,
+				TakesFile: true,
+				EnvVars: []string{
+					"SCM_ENGINE_HISTORY_PATH",
+				},
+			},
+			&cli.StringFlag{
+				Name:     FlagSCMProject,
+				Usage:    "The project of the Merge Request (example: 'jippi/scm-engine')",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  flagHistoryLimit,
+				Usage: "Number of (most recent) evaluations to show",
+				Value: 20,
+			},
+			&cli.BoolFlag{
+				Name:  flagHistoryJSON,
+				Usage: "Output the evaluations as JSON, including the steps of the executed actions and the update payload",
+			},
+		},
+	}
+}
+
+func History(cCtx *cli.Context) error {
+	if cCtx.NArg() != 1 {
+		return errors.New("expected exactly one Merge Request ID")
+	}
+
+	if cCtx.Int(flagHistoryLimit) < 1 {
+		return fmt.Errorf("--%s must be at least 1", flagHistoryLimit)
+	}
+
+	store, err := history.Open(cCtx.Context, cCtx.String(FlagHistoryPath), 0)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	records, err := store.Timeline(cCtx.Context, state.Provider(cCtx.Context), cCtx.String(FlagSCMProject), cCtx.Args().First(), cCtx.Int(flagHistoryLimit))
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool(flagHistoryJSON) {
+		encoder := json.NewEncoder(cCtx.App.Writer)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(records)
+	}
+
+	if len(records) == 0 {
+		fmt.Fprintln(cCtx.App.Writer, "No evaluations recorded")
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cCtx.App.Writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "STARTED AT\tEVAL ID\tTRIGGER\tCOMMIT\tCONFIG REF\tDURATION\tMATCHED LABELS\tACTIONS\tERROR")
+
+	for _, record := range records {
+		actions := make([]string, 0, len(record.Actions))
+		for _, action := range record.Actions {
+			actions = append(actions, action.Name)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.StartedAt.Format(time.RFC3339),
+			record.EvaluationID,
+			orDash(record.Trigger),
+			orDash(shortSHA(record.CommitSHA)),
+			orDash(shortSHA(record.ConfigSourceRef)),
+			record.Duration.Round(time.Millisecond),
+			orDash(strings.Join(record.MatchedLabels, ", ")),
+			orDash(strings.Join(actions, ", ")),
+			// Keep every evaluation on a single line
+			orDash(strings.Join(strings.Fields(record.Error), " ")),
+		)
+	}
+
+	return w.Flush()
+}
+
+// shortSHA abbreviates commit SHAs, leaving other refs (like "HEAD") as-is
+func shortSHA(ref string) string {
+	if len(ref) == 40 {
+		return ref[:8]
+	}
+
+	return ref
+}
+
+func orDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+
+	return value
+}
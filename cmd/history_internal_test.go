@@ -0,0 +1,82 @@
+//nolint:testpackage // the history command is built from an unexported constructor
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runHistory runs the history command against the evaluation history at path, and returns its output
+func runHistory(t *testing.T, path string, args ...string) (string, error) {
+	t.Helper()
+
+	var output bytes.Buffer
+
+	app := &cli.App{
+		Writer:   &output,
+		Commands: []*cli.Command{newHistoryCommand()},
+	}
+
+	err := app.RunContext(state.WithProvider(t.Context(), "gitlab"), append([]string{"scm-engine", "history", "--" + FlagHistoryPath, path}, args...))
+
+	return output.String(), err
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "history.db")
+
+	store, err := history.Open(t.Context(), path, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { store.Close() })
+
+	output, err := runHistory(t, path, "--project", "jippi/scm-engine", "1")
+	require.NoError(t, err)
+	require.Equal(t, "No evaluations recorded\n", output)
+
+	record := history.Record{
+		EvaluationID:    "eval",
+		Provider:        "gitlab",
+		ProjectID:       "jippi/scm-engine",
+		MergeRequestID:  "1",
+		CommitSHA:       "0123456789abcdef0123456789abcdef01234567",
+		Trigger:         "note",
+		ConfigSourceRef: "HEAD",
+		MatchedLabels:   []string{"bug", "needs-review"},
+		Actions:         []history.Action{{Name: "close", Steps: []map[string]any{{"action": "close"}}}},
+		Error:           "could not update:\n502 Bad Gateway",
+		StartedAt:       time.Now(),
+		Duration:        1500 * time.Millisecond,
+	}
+	require.NoError(t, store.Insert(t.Context(), &record))
+
+	output, err = runHistory(t, path, "--project", "jippi/scm-engine", "1")
+	require.NoError(t, err)
+	require.Contains(t, output, "STARTED AT")
+	require.Contains(t, output, "eval")
+	require.Contains(t, output, "01234567  HEAD")
+	require.Contains(t, output, "1.5s")
+	require.Contains(t, output, "bug, needs-review")
+	require.Contains(t, output, "could not update: 502 Bad Gateway", "errors are kept on a single line")
+
+	output, err = runHistory(t, path, "--project", "jippi/scm-engine", "--json", "1")
+	require.NoError(t, err)
+
+	var records []history.Record
+	require.NoError(t, json.Unmarshal([]byte(output), &records))
+	require.Len(t, records, 1)
+	require.Equal(t, []map[string]any{{"action": "close"}}, records[0].Actions[0].Steps)
+
+	_, err = runHistory(t, path, "--project", "jippi/scm-engine")
+	require.ErrorContains(t, err, "expected exactly one Merge Request ID")
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/generated/resources"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/scm/github"
+	"github.com/jippi/scm-engine/pkg/scm/gitlab"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/urfave/cli/v2"
+	slogctx "github.com/veqryn/slog-context"
+	"gopkg.in/yaml.v3"
+)
+
+func Lint(cCtx *cli.Context) error {
+	ctx := cCtx.Context
+	ctx = state.WithConfigFilePath(ctx, cCtx.String(FlagConfigFile))
+	ctx = state.WithGlobalConfigFilePath(ctx, cCtx.String(FlagGlobalConfigFile))
+
+	// Read raw YAML file
+	raw, err := os.ReadFile(state.ConfigFilePath(ctx))
+	if err != nil {
+		return err
+	}
+
+	if err := validateSchema(raw, cCtx.String("schema")); err != nil {
+		return err
+	}
+
+	// Load the configuration file via our Go struct, including its 'local' and 'remote' includes
+	cfg, err := loadConfigFile(ctx, state.ConfigFilePath(ctx), includeHTTPClient)
+	if err != nil {
+		return err
+	}
+
+	// Lint the configuration as it is evaluated, on top of the global configuration
+	if state.GlobalConfigFilePath(ctx) != "" {
+		globalCfg, err := loadConfigFile(ctx, state.GlobalConfigFilePath(ctx), includeHTTPClient)
+		if err != nil {
+			return err
+		}
+
+		cfg = globalCfg.Merge(cfg)
+
+		logMergeChanges(ctx, cfg)
+	}
+
+	if len(cfg.Includes) != 0 {
+		slogctx.Warn(ctx, "Configuration file contains 'project' includes, those require an API token and are ignored by the 'lint' command")
+	}
+
+	evalContext, err := lintEvalContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// To scm-engine specific linting last
+	if err := cfg.Lint(ctx, evalContext); err != nil {
+		return err
+	}
+
+	reportEffectiveConfig(ctx, cfg)
+
+	slogctx.Info(ctx, "No errors found")
+
+	return nil
+}
+
+// reportEffectiveConfig logs the labels and actions that are evaluated, in the order they are evaluated in
+func reportEffectiveConfig(ctx context.Context, cfg *config.Config) {
+	labels := make([]string, 0, len(cfg.Labels))
+
+	for _, label := range cfg.Labels {
+		if label.Disabled {
+			continue
+		}
+
+		name := label.Name
+		if len(name) == 0 {
+			name = "(" + string(config.GenerateLabels) + ")"
+		}
+
+		labels = append(labels, name)
+	}
+
+	actions := make([]string, 0, len(cfg.Actions))
+
+	for _, action := range cfg.Actions {
+		if !action.Disabled {
+			actions = append(actions, action.Name)
+		}
+	}
+
+	slogctx.Info(ctx, "Effective configuration", slog.Any("labels", labels), slog.Any("actions", actions))
+}
+
+// validateSchema validates the raw YAML configuration file against the JSON schema at schemaURL
+func validateSchema(raw []byte, schemaURL string) error {
+	// Parse the YAML file into lose Go shape
+	var yamlOutput any
+	if err := yaml.Unmarshal(raw, &yamlOutput); err != nil {
+		return err
+	}
+
+	// Setup file loaders for reading the JSON schema file
+	loader := jsonschema.SchemeURLLoader{
+		"file":  jsonschema.FileLoader{},
+		"http":  newHTTPURLLoader(),
+		"https": newHTTPURLLoader(),
+		"embed": &EmbedLoader{},
+	}
+
+	// Create json schema compiler
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(loader)
+
+	// Compile the schema into validator format
+	sch, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return err
+	}
+
+	// Validate the json output
+	return sch.Validate(yamlOutput)
+}
+
+// lintEvalContext returns an empty evaluation context for the provider, which scripts are type-checked against
+func lintEvalContext(ctx context.Context) (scm.EvalContext, error) {
+	switch state.Provider(ctx) {
+	case "github":
+		return &github.Context{}, nil
+
+	case "gitlab":
+		return &gitlab.Context{}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown provider %q - we only support 'github' and 'gitlab'", state.Provider(ctx))
+	}
+}
+
+type EmbedLoader struct{}
+
+func (l *EmbedLoader) Load(url string) (any, error) {
+	return jsonschema.UnmarshalJSON(strings.NewReader(resources.JSONSchema))
+}
+
+type HTTPURLLoader http.Client
+
+func (l *HTTPURLLoader) Load(url string) (any, error) {
+	client := (*http.Client)(l)
+
+	resp, err := client.Get(url) //nolint
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("%s returned status code %d", url, resp.StatusCode)
+	}
+
+	defer resp.Body.Close()
+
+	return jsonschema.UnmarshalJSON(resp.Body)
+}
+
+func newHTTPURLLoader() *HTTPURLLoader {
+	httpLoader := HTTPURLLoader(http.Client{
+		Timeout: 15 * time.Second,
+	})
+
+	return &httpLoader
+}
@@ -0,0 +1,271 @@
+//nolint:testpackage,paralleltest // Lint is driven through the cli package; urfave/cli mutates a package level HelpFlag inside App.Run, so these cannot run in parallel
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runLint invokes the lint command exactly as the CLI does, against a config
+// file written for the test.
+//
+// These tests deliberately do not call t.Parallel: urfave/cli mutates its
+// package level HelpFlag inside App.Run, so running several apps concurrently
+// is a data race in the library rather than in scm-engine.
+func runLint(t *testing.T, contents string) error {
+	t.Helper()
+
+	return runLintFor(t, "gitlab", contents)
+}
+
+// runLintFor is runLint for the provider the scripts are type-checked against
+func runLintFor(t *testing.T, provider, contents string) error {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".scm-engine.yml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: FlagConfigFile, Value: path},
+			&cli.StringFlag{Name: "schema", Value: "embed://"},
+		},
+		Action: Lint,
+	}
+
+	return app.RunContext(state.WithProvider(t.Context(), provider), []string{"scm-engine"})
+}
+
+func TestLint_acceptsAValidConfig(t *testing.T) {
+	require.NoError(t, runLint(t, `
+label:
+  - name: bug
+    script: merge_request.has_label("bug")
+    color: "$red-500"
+
+actions:
+  - name: close-stale
+    if: merge_request.has_no_activity_within("30d")
+    then:
+      - action: close
+`))
+}
+
+func TestLint_acceptsAnEmptyConfig(t *testing.T) {
+	require.NoError(t, runLint(t, "{}\n"))
+}
+
+func TestLint_rejectsAMissingFile(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: FlagConfigFile, Value: filepath.Join(t.TempDir(), "does-not-exist.yml")},
+			&cli.StringFlag{Name: "schema", Value: "embed://"},
+		},
+		Action: Lint,
+	}
+
+	require.Error(t, app.RunContext(state.WithProvider(t.Context(), "gitlab"), []string{"scm-engine"}))
+}
+
+func TestLint_rejectsMalformedYAML(t *testing.T) {
+	require.Error(t, runLint(t, "label: [unclosed\n"))
+}
+
+// The JSON schema is what catches a key the user misspelled, before any script
+// is compiled.
+func TestLint_rejectsUnknownKeys(t *testing.T) {
+	err := runLint(t, `
+labels:
+  - name: typo-in-the-top-level-key
+`)
+	require.Error(t, err)
+}
+
+func TestLint_rejectsAnInvalidStrategy(t *testing.T) {
+	err := runLint(t, `
+label:
+  - name: bug
+    strategy: not-a-strategy
+    script: "true"
+`)
+	require.Error(t, err)
+}
+
+// A script that does not compile has to fail lint, which is the whole point of
+// running the command in CI before merging a configuration change.
+func TestLint_rejectsAnUncompilableScript(t *testing.T) {
+	err := runLint(t, `
+label:
+  - name: broken
+    script: this is not )( valid expr
+`)
+	require.ErrorContains(t, err, "broken")
+}
+
+func TestLint_rejectsAnUncompilableAction(t *testing.T) {
+	err := runLint(t, `
+actions:
+  - name: broken
+    if: this is not )( valid expr
+    then:
+      - action: close
+`)
+	require.ErrorContains(t, err, "broken")
+}
+
+// A generate label returning a boolean is a strategy mismatch, and lint is where
+// the user should find out.
+func TestLint_rejectsAStrategyMismatch(t *testing.T) {
+	err := runLint(t, `
+label:
+  - strategy: generate
+    script: "true"
+`)
+	require.Error(t, err)
+}
+
+func TestLint_rejectsAnUnknownAction(t *testing.T) {
+	err := runLint(t, `
+actions:
+  - name: bad-action
+    if: "true"
+    then:
+      - action: no_such_action
+`)
+	require.Error(t, err)
+}
+
+// GitHub configurations are type-checked against the GitHub context, where the
+// Pull Request is called "pull_request" rather than "merge_request"
+func TestLint_github(t *testing.T) {
+	config := `
+label:
+  - name: bug
+    script: pull_request.has_label("bug")
+    color: "$red-500"
+
+actions:
+  - name: close-stale
+    if: pull_request.has_no_activity_within("30d")
+    then:
+      - action: close
+`
+
+	require.NoError(t, runLintFor(t, "github", config))
+	require.ErrorContains(t, runLintFor(t, "gitlab", config), "bug")
+
+	require.ErrorContains(t, runLintFor(t, "github", `
+label:
+  - name: gitlab-only
+    script: merge_request.has_label("bug")
+    color: "$red-500"
+`), "gitlab-only")
+}
+
+func TestLint_rejectsAnUnknownProvider(t *testing.T) {
+	require.ErrorContains(t, runLintFor(t, "bitbucket", "{}\n"), `unknown provider "bitbucket"`)
+}
+
+// runLintWithGlobal is runLint for a repository configuration evaluated on top of the global configuration
+func runLintWithGlobal(t *testing.T, global, contents string) error {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	globalPath := filepath.Join(dir, "global.yml")
+	require.NoError(t, os.WriteFile(globalPath, []byte(global), 0o600))
+
+	path := filepath.Join(dir, ".scm-engine.yml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: FlagConfigFile, Value: path},
+			&cli.StringFlag{Name: FlagGlobalConfigFile, Value: globalPath},
+			&cli.StringFlag{Name: "schema", Value: "embed://"},
+		},
+		Action: Lint,
+	}
+
+	return app.RunContext(state.WithProvider(t.Context(), "gitlab"), []string{"scm-engine"})
+}
+
+// With a global configuration, the repository configuration is linted as it is evaluated: on top of it
+func TestLint_globalConfig(t *testing.T) {
+	global := `
+label:
+  - name: legacy
+    script: merge_request.does_not_exist
+`
+
+	require.ErrorContains(t, runLintWithGlobal(t, global, "{}\n"), `Label "legacy" failed validation`)
+
+	// A disabled label only needs a name, and is not linted
+	require.NoError(t, runLintWithGlobal(t, global, `
+label:
+  - name: legacy
+    disabled: true
+`))
+
+	require.NoError(t, runLintWithGlobal(t, global, `
+label:
+  - name: legacy
+    script: merge_request.has_label("legacy")
+`))
+}
+
+// A repository configuration may not change how the labels and actions of the global configuration behave,
+// by replacing the definitions they use
+func TestLint_globalDefinitions(t *testing.T) {
+	global := `
+definitions:
+  is_big: len(merge_request.diff_stats) > 50
+
+label:
+  - name: big
+    locked: true
+    script: is_big
+`
+
+	require.ErrorContains(t, runLintWithGlobal(t, global, `
+definitions:
+  is_big: "true"
+`), `Definition "is_big" may not replace the definition with the same name in the global configuration`)
+
+	// Adding definitions, or repeating a global one as-is, is fine
+	require.NoError(t, runLintWithGlobal(t, global, `
+definitions:
+  is_big: len(merge_request.diff_stats) > 50
+  is_huge: len(merge_request.diff_stats) > 500
+
+label:
+  - name: huge
+    script: is_big && is_huge
+`))
+}
+
+func TestLint_definitions(t *testing.T) {
+	require.NoError(t, runLint(t, `
+definitions:
+  is_bug: merge_request.has_label("bug")
+
+label:
+  - name: bug
+    script: is_bug
+`))
+
+	require.ErrorContains(t, runLint(t, `
+definitions:
+  a: b
+  b: a
+
+label:
+  - name: bug
+    script: a
+`), "circular reference in definitions: a -> b -> a")
+}
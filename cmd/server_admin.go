@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/scm/github"
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+const (
+	// Admin requests are small JSON documents; anything larger is a mistake
+	adminMaxRequestBodySize = 1 << 20 // 1 MiB
+
+	// Number of evaluations in the history timeline, unless asked for otherwise
+	adminDefaultHistoryLimit = 20
+)
+
+// adminAPI serves the endpoints for operators to trigger and inspect evaluations
+type adminAPI struct {
+	ctx      context.Context //nolint:containedctx // out-of-band periodic evaluation cycles must outlive the request
+	token    string
+	client   scm.Client
+	filter   scm.MergeRequestListFilters // the filters of the periodic evaluation, used as defaults
+	periodic *periodicEvaluationStatus
+	wg       *sync.WaitGroup
+
+	// Only one out-of-band periodic evaluation cycle runs at a time
+	cycleRunning atomic.Bool
+}
+
+// adminEvaluateRequest is the JSON body of "POST /admin/evaluate"
+type adminEvaluateRequest struct {
+	Project        string `json:"project"`
+	MergeRequestID int    `json:"merge_request_id"`
+	CommitSHA      string `json:"commit_sha"` // optional; the HEAD commit of the Merge Request when empty
+	DryRun         bool   `json:"dry_run"`
+}
+
+// adminEvaluationsResponse is the JSON body of "GET /admin/evaluations"
+type adminEvaluationsResponse struct {
+	Evaluations []inFlightEvaluation `json:"evaluations"`
+	Locks       adminLocks           `json:"locks"`
+}
+
+// adminLocks are the Merge Requests locked for evaluation, by any replica sharing the lock backend
+type adminLocks struct {
+	Backend string   `json:"backend"`
+	Held    []string `json:"held"`
+}
+
+// adminHistoryResponse is the JSON body of "GET /admin/history"
+type adminHistoryResponse struct {
+	Evaluations []history.Record `json:"evaluations"`
+}
+
+// adminPeriodicEvaluationRequest is the JSON body of "POST /admin/periodic-evaluation";
+// omitted fields keep the value of the server's periodic evaluation flags
+type adminPeriodicEvaluationRequest struct {
+	IgnoreMergeRequestsWithLabels  []string `json:"ignore_mr_labels"`
+	RequireMergeRequestsWithLabels []string `json:"require_mr_labels"`
+	OnlyProjectsWithMembership     bool     `json:"only_project_membership"`
+	OnlyProjectsWithTopics         []string `json:"project_topics"`
+}
+
+// Register mounts the admin endpoints on mux, all requiring the admin token
+func (api *adminAPI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /admin/evaluate", api.authenticated(api.evaluate))
+	mux.HandleFunc("GET /admin/evaluations", api.authenticated(api.evaluations))
+	mux.HandleFunc("GET /admin/history", api.authenticated(api.evaluationHistory))
+	mux.HandleFunc("POST /admin/periodic-evaluation", api.authenticated(api.periodicEvaluation))
+}
+
+// authenticated rejects requests without the admin token as a bearer token
+func (api *adminAPI) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scm-engine admin"`)
+			writeAdminError(r.Context(), w, http.StatusUnauthorized, errors.New("missing or invalid admin token"))
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// evaluate evaluates a Merge Request right away, and responds with the labels and actions it evaluated to
+func (api *adminAPI) evaluate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request adminEvaluateRequest
+	if err := decodeAdminRequest(w, r, &request); err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if len(request.Project) == 0 || request.MergeRequestID < 1 {
+		writeAdminError(ctx, w, http.StatusBadRequest, errors.New("'project' and 'merge_request_id' are required"))
+
+		return
+	}
+
+	// GitHub projects are always "owner/repo", while GitLab projects may be nested in groups
+	if state.Provider(ctx) == "github" {
+		if _, _, err := github.ParseProject(request.Project); err != nil {
+			writeAdminError(ctx, w, http.StatusBadRequest, err)
+
+			return
+		}
+	}
+
+	ctx = state.WithProjectID(ctx, request.Project)
+	ctx = state.WithMergeRequestID(ctx, strconv.Itoa(request.MergeRequestID))
+
+	if request.DryRun {
+		// Neither the configuration file nor the pipeline status may leak changes into the Merge Request
+		ctx = state.WithForcedDryRun(ctx)
+		ctx = state.WithUpdatePipeline(ctx, false, "")
+	}
+
+	if len(request.CommitSHA) == 0 {
+		resolver, ok := api.client.(headCommitResolver)
+		if !ok {
+			writeAdminError(ctx, w, http.StatusBadRequest, errors.New("'commit_sha' is required"))
+
+			return
+		}
+
+		sha, err := resolver.HeadCommitSHA(ctx)
+		if err != nil {
+			writeAdminError(ctx, w, http.StatusBadGateway, fmt.Errorf("could not find HEAD commit for Merge Request: %w", err))
+
+			return
+		}
+
+		request.CommitSHA = sha
+	}
+
+	ctx = state.WithCommitSHA(ctx, request.CommitSHA)
+	ctx = slogctx.With(ctx, slog.String("event_type", "admin_evaluate"))
+	ctx = state.WithTrigger(ctx, "admin_evaluate")
+
+	// Evaluations routinely take longer than the server timeout meant for webhooks
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slogctx.Warn(ctx, "Could not lift the write deadline; the response may time out", slog.Any("error", err))
+	}
+
+	ctx, result := withEvaluationResult(ctx)
+
+	if err := processWebhookEvent(ctx, api.client, nil); err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeAdminJSON(ctx, w, http.StatusOK, result)
+}
+
+// evaluations lists the in-flight evaluations of this replica, and the Merge Requests locked by any replica
+func (api *adminAPI) evaluations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	locker := state.Locker(ctx)
+
+	held, err := locker.Held(ctx)
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadGateway, err)
+
+		return
+	}
+
+	if held == nil {
+		held = []string{}
+	}
+
+	writeAdminJSON(ctx, w, http.StatusOK, adminEvaluationsResponse{
+		Evaluations: inFlightEvaluations.List(),
+		Locks:       adminLocks{Backend: locker.Name(), Held: held},
+	})
+}
+
+// evaluationHistory returns the evaluation timeline of a Merge Request, oldest first
+func (api *adminAPI) evaluationHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	store := history.FromContext(ctx)
+	if store == nil {
+		writeAdminError(ctx, w, http.StatusNotFound, errors.New("the evaluation history is disabled; set --"+FlagHistoryPath+" to enable it"))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	project, mergeRequestID := query.Get("project"), query.Get("merge_request_id")
+	if len(project) == 0 || len(mergeRequestID) == 0 {
+		writeAdminError(ctx, w, http.StatusBadRequest, errors.New("'project' and 'merge_request_id' are required"))
+
+		return
+	}
+
+	limit := adminDefaultHistoryLimit
+
+	if value := query.Get("limit"); len(value) > 0 {
+		var err error
+
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeAdminError(ctx, w, http.StatusBadRequest, fmt.Errorf("'limit' must be a positive number, got %q", value))
+
+			return
+		}
+	}
+
+	records, err := store.Timeline(ctx, state.Provider(ctx), project, mergeRequestID, limit)
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeAdminJSON(ctx, w, http.StatusOK, adminHistoryResponse{Evaluations: records})
+}
+
+// periodicEvaluation starts a periodic evaluation cycle in the background, regardless of the interval
+func (api *adminAPI) periodicEvaluation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Cloned, since decoding into a slice reuses its backing array
+	request := adminPeriodicEvaluationRequest{
+		IgnoreMergeRequestsWithLabels:  slices.Clone(api.filter.IgnoreMergeRequestWithLabels),
+		RequireMergeRequestsWithLabels: slices.Clone(api.filter.OnlyMergeRequestsWithLabels),
+		OnlyProjectsWithMembership:     api.filter.OnlyProjectsWithMembership,
+		OnlyProjectsWithTopics:         slices.Clone(api.filter.OnlyProjectsWithTopics),
+	}
+
+	if err := decodeAdminRequest(w, r, &request); err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	filter := scm.MergeRequestListFilters{
+		IgnoreMergeRequestWithLabels: request.IgnoreMergeRequestsWithLabels,
+		OnlyMergeRequestsWithLabels:  request.RequireMergeRequestsWithLabels,
+		OnlyProjectsWithMembership:   request.OnlyProjectsWithMembership,
+		OnlyProjectsWithTopics:       request.OnlyProjectsWithTopics,
+		SCMConfigurationFilePath:     api.filter.SCMConfigurationFilePath,
+	}
+
+	if !api.cycleRunning.CompareAndSwap(false, true) {
+		writeAdminError(ctx, w, http.StatusConflict, errors.New("an out-of-band periodic evaluation cycle is already running"))
+
+		return
+	}
+
+	api.wg.Add(1) // +1: Out-of-band periodic evaluation
+
+	go func() {
+		defer api.wg.Done() // -1: Out-of-band periodic evaluation
+		defer api.cycleRunning.Store(false)
+
+		ctx := slogctx.With(api.ctx,
+			slog.Any("periodic_evaluation_filters", filter.AsGraphqlVariables()),
+			slog.String("event_type", "admin_periodic_evaluation"),
+		)
+		ctx = state.WithTrigger(ctx, "admin_periodic_evaluation")
+
+		runPeriodicEvaluationCycle(ctx, api.client, filter, api.periodic)
+	}()
+
+	writeAdminJSON(ctx, w, http.StatusAccepted, request)
+}
+
+// decodeAdminRequest decodes the JSON body of r into target; an empty body leaves target as-is
+func decodeAdminRequest(w http.ResponseWriter, r *http.Request, target any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminMaxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(target); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+func writeAdminError(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	slogctx.Warn(ctx, "Admin API request failed", slog.Int("response_code", status), slog.Any("error", err))
+
+	writeAdminJSON(ctx, w, status, map[string]string{"error": err.Error()})
+}
+
+func writeAdminJSON(ctx context.Context, w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slogctx.Debug(ctx, "Could not write admin API response", slog.Any("error", err))
+	}
+}
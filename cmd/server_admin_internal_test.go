@@ -0,0 +1,441 @@
+//nolint:testpackage // the admin API and the evaluation registry are unexported
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdminAPI(client scm.Client) (*adminAPI, *http.ServeMux) {
+	api := &adminAPI{
+		ctx:    context.Background(),
+		token:  "secret",
+		client: client,
+		filter: scm.MergeRequestListFilters{
+			IgnoreMergeRequestWithLabels: []string{"skip"},
+			OnlyProjectsWithMembership:   true,
+			SCMConfigurationFilePath:     ".scm-engine.yml",
+		},
+		periodic: &periodicEvaluationStatus{},
+		wg:       &sync.WaitGroup{},
+	}
+
+	mux := http.NewServeMux()
+	api.Register(mux)
+
+	return api, mux
+}
+
+func adminRequest(ctx context.Context, method, target, token, body string) *http.Request {
+	req := httptest.NewRequestWithContext(ctx, method, target, strings.NewReader(body))
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+func decodeAdminResponse(t *testing.T, recorder *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+
+	return body
+}
+
+func TestAdminAPI_authentication(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, mux := newTestAdminAPI(newFakeClient())
+
+			req := adminRequest(t.Context(), http.MethodGet, "/admin/evaluations", "", "")
+			if len(tt.header) > 0 {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			require.Equal(t, tt.wantStatus, recorder.Code)
+
+			if tt.wantStatus == http.StatusUnauthorized {
+				require.Equal(t, `Bearer realm="scm-engine admin"`, recorder.Header().Get("WWW-Authenticate"))
+				require.Equal(t, "missing or invalid admin token", decodeAdminResponse(t, recorder)["error"])
+			}
+		})
+	}
+}
+
+func TestAdminAPI_evaluate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "invalid JSON",
+			body:       `{"project":`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid request body",
+		},
+		{
+			name:       "unknown field",
+			body:       `{"project":"jippi/scm-engine","merge_request_id":1,"mr":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "unknown field",
+		},
+		{
+			name:       "missing merge request",
+			body:       `{"project":"jippi/scm-engine"}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "'project' and 'merge_request_id' are required",
+		},
+		{
+			name:       "HEAD commit can not be resolved by the client",
+			body:       `{"project":"jippi/scm-engine","merge_request_id":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "'commit_sha' is required",
+		},
+		{
+			name:       "evaluation failed",
+			body:       `{"project":"jippi/scm-engine","merge_request_id":1,"commit_sha":"abc123","dry_run":true}`,
+			wantStatus: http.StatusInternalServerError,
+			wantError:  errNotImplemented.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, mux := newTestAdminAPI(newFakeClient())
+
+			ctx := state.WithProvider(t.Context(), "gitlab")
+			ctx = state.WithConfigFilePath(ctx, ".scm-engine.yml")
+			ctx = state.WithGlobalConfigFilePath(ctx, "")
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, adminRequest(ctx, http.MethodPost, "/admin/evaluate", "secret", tt.body))
+
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			require.Contains(t, decodeAdminResponse(t, recorder)["error"], tt.wantError)
+		})
+	}
+}
+
+// GitHub projects are split into owner and repository name, which must not fail on admin input
+func TestAdminAPI_evaluate_githubProject(t *testing.T) {
+	t.Parallel()
+
+	for _, project := range []string{"scm-engine", "jippi/", "/scm-engine", "jippi/scm-engine/extra"} {
+		t.Run(project, func(t *testing.T) {
+			t.Parallel()
+
+			_, mux := newTestAdminAPI(newFakeClient())
+
+			ctx := state.WithProvider(t.Context(), "github")
+			body := `{"project":"` + project + `","merge_request_id":1}`
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, adminRequest(ctx, http.MethodPost, "/admin/evaluate", "secret", body))
+
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+			require.Contains(t, decodeAdminResponse(t, recorder)["error"], "it must be in the format owner/repository")
+		})
+	}
+}
+
+func TestAdminAPI_evaluations(t *testing.T) {
+	t.Parallel()
+
+	locker := lock.NewMemory()
+
+	unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx := state.WithProvider(t.Context(), "gitlab")
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "1")
+	ctx = state.WithCommitSHA(ctx, "abc123")
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithEvaluationID(ctx, t.Name())
+	ctx = state.WithLocker(ctx, locker)
+
+	done := inFlightEvaluations.Start(ctx)
+	defer done()
+
+	inFlightEvaluations.Locked(ctx)
+
+	_, mux := newTestAdminAPI(newFakeClient())
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(ctx, http.MethodGet, "/admin/evaluations", "secret", ""))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body adminEvaluationsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+
+	require.Equal(t, adminLocks{Backend: "memory", Held: []string{"gitlab/jippi/scm-engine/1"}}, body.Locks)
+	require.Contains(t, body.Evaluations, inFlightEvaluation{
+		EvaluationID:   t.Name(),
+		Provider:       "gitlab",
+		ProjectID:      "jippi/scm-engine",
+		MergeRequestID: "1",
+		CommitSHA:      "abc123",
+		StartedAt:      state.StartTime(ctx).UTC(),
+		State:          evaluationStateEvaluating,
+	})
+}
+
+// periodicFilterClient records the filters periodic evaluation cycles were run with
+type periodicFilterClient struct {
+	*fakeClient
+
+	filters chan scm.MergeRequestListFilters
+}
+
+func (c *periodicFilterClient) FindMergeRequestsForPeriodicEvaluation(_ context.Context, filters scm.MergeRequestListFilters) ([]scm.PeriodicEvaluationMergeRequest, error) {
+	c.filters <- filters
+
+	return nil, nil
+}
+
+func TestAdminAPI_periodicEvaluation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantFilter scm.MergeRequestListFilters
+	}{
+		{
+			name: "defaults to the server filters",
+			wantFilter: scm.MergeRequestListFilters{
+				IgnoreMergeRequestWithLabels: []string{"skip"},
+				OnlyProjectsWithMembership:   true,
+				SCMConfigurationFilePath:     ".scm-engine.yml",
+			},
+		},
+		{
+			name: "custom filters",
+			body: `{"ignore_mr_labels":["wip"],"require_mr_labels":["ready"],"project_topics":["backend"]}`,
+			wantFilter: scm.MergeRequestListFilters{
+				IgnoreMergeRequestWithLabels: []string{"wip"},
+				OnlyMergeRequestsWithLabels:  []string{"ready"},
+				OnlyProjectsWithMembership:   true,
+				OnlyProjectsWithTopics:       []string{"backend"},
+				SCMConfigurationFilePath:     ".scm-engine.yml",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &periodicFilterClient{fakeClient: newFakeClient(), filters: make(chan scm.MergeRequestListFilters, 1)}
+			api, mux := newTestAdminAPI(client)
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, adminRequest(t.Context(), http.MethodPost, "/admin/periodic-evaluation", "secret", tt.body))
+
+			require.Equal(t, http.StatusAccepted, recorder.Code)
+			require.Equal(t, tt.wantFilter, <-client.filters)
+
+			api.wg.Wait()
+
+			// The server filters must not be changed by the request
+			require.Equal(t, []string{"skip"}, api.filter.IgnoreMergeRequestWithLabels)
+			require.False(t, api.cycleRunning.Load())
+			require.NotZero(t, api.periodic.lastCycleAt.Load())
+		})
+	}
+}
+
+func TestAdminAPI_periodicEvaluation_alreadyRunning(t *testing.T) {
+	t.Parallel()
+
+	api, mux := newTestAdminAPI(newFakeClient())
+	api.cycleRunning.Store(true)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(t.Context(), http.MethodPost, "/admin/periodic-evaluation", "secret", ""))
+
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	require.Contains(t, decodeAdminResponse(t, recorder)["error"], "already running")
+}
+
+func TestEvaluationRegistry(t *testing.T) {
+	t.Parallel()
+
+	registry := newEvaluationRegistry()
+
+	ctx := state.WithProvider(t.Context(), "github")
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "2")
+	ctx = state.WithCommitSHA(ctx, "abc123")
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithEvaluationID(ctx, "first")
+
+	done := registry.Start(ctx)
+
+	later := state.WithStartTime(state.WithEvaluationID(ctx, "second"), time.Now().Add(time.Second))
+	doneLater := registry.Start(later)
+
+	registry.Locked(later)
+
+	evaluations := registry.List()
+	require.Len(t, evaluations, 2)
+	require.Equal(t, "first", evaluations[0].EvaluationID)
+	require.Equal(t, evaluationStateWaitingForLock, evaluations[0].State)
+	require.Equal(t, "second", evaluations[1].EvaluationID)
+	require.Equal(t, evaluationStateEvaluating, evaluations[1].State)
+
+	done()
+	doneLater()
+
+	require.Empty(t, registry.List())
+}
+
+func TestRecordEvaluationResult(t *testing.T) {
+	t.Parallel()
+
+	ctx := state.WithEvaluationID(t.Context(), "eval")
+	ctx = state.WithDryRun(ctx, true)
+
+	// Nothing is recorded unless asked for
+	recordEvaluationResult(ctx, []scm.EvaluationResult{{Name: "bug"}}, nil)
+
+	ctx, result := withEvaluationResult(ctx)
+
+	recordEvaluationResult(ctx,
+		[]scm.EvaluationResult{{Name: "bug", Matched: true, Color: "#ff0000"}, {Name: "feature"}},
+		config.Actions{{Name: "close"}},
+	)
+	recordEvaluationUpdate(ctx, &scm.UpdateMergeRequestOptions{AddLabels: &scm.LabelOptions{"bug"}})
+
+	require.Equal(t, &evaluationResult{
+		EvaluationID: "eval",
+		DryRun:       true,
+		Labels: []evaluatedLabel{
+			{Name: "bug", Matched: true, Color: "#ff0000"},
+			{Name: "feature"},
+		},
+		Actions: config.Actions{{Name: "close"}},
+		Update:  &scm.UpdateMergeRequestOptions{AddLabels: &scm.LabelOptions{"bug"}},
+	}, result)
+}
+
+func TestAdminAPI_history(t *testing.T) {
+	t.Parallel()
+
+	ctx, store := newHistoryContext(t)
+
+	for _, evaluationID := range []string{"first", "second"} {
+		require.NoError(t, store.Insert(t.Context(), &history.Record{
+			EvaluationID:   evaluationID,
+			Provider:       "gitlab",
+			ProjectID:      "jippi/scm-engine",
+			MergeRequestID: "1",
+			StartedAt:      time.Now(),
+		}))
+	}
+
+	_, mux := newTestAdminAPI(newFakeClient())
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(ctx, http.MethodGet, "/admin/history?project=jippi/scm-engine&merge_request_id=1&limit=1", "secret", ""))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body adminHistoryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Len(t, body.Evaluations, 1)
+	require.Equal(t, "second", body.Evaluations[0].EvaluationID)
+}
+
+func TestAdminAPI_history_errors(t *testing.T) {
+	t.Parallel()
+
+	enabled, _ := newHistoryContext(t)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context //nolint:containedctx // the history is enabled through the request context
+		target     string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "history disabled",
+			ctx:        state.WithProvider(t.Context(), "gitlab"),
+			target:     "/admin/history?project=jippi/scm-engine&merge_request_id=1",
+			wantStatus: http.StatusNotFound,
+			wantError:  "the evaluation history is disabled",
+		},
+		{
+			name:       "missing merge request",
+			ctx:        enabled,
+			target:     "/admin/history?project=jippi/scm-engine",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "'project' and 'merge_request_id' are required",
+		},
+		{
+			name:       "invalid limit",
+			ctx:        enabled,
+			target:     "/admin/history?project=jippi/scm-engine&merge_request_id=1&limit=0",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "'limit' must be a positive number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, mux := newTestAdminAPI(newFakeClient())
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, adminRequest(tt.ctx, http.MethodGet, tt.target, "secret", ""))
+
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			require.Contains(t, decodeAdminResponse(t, recorder)["error"], tt.wantError)
+		})
+	}
+}
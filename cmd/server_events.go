@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	go_github "github.com/google/go-github/v72/github"
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/metrics"
+	slogctx "github.com/veqryn/slog-context"
+	go_gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+const (
+	// How often the event store is checked for events due for (another) attempt
+	webhookSchedulerInterval = time.Second
+
+	// Upper bound for the exponential backoff between attempts
+	webhookMaxRetryBackoff = time.Hour
+)
+
+// webhookEventProcessor evaluates a stored webhook event
+type webhookEventProcessor func(ctx context.Context, event eventstore.Event) error
+
+// webhookRetryPolicy controls how often, and how far apart, failing webhook events are attempted
+type webhookRetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// Delay returns how long to wait after the given (1-indexed) failed attempt;
+// the backoff doubles for every attempt, up to [webhookMaxRetryBackoff]
+func (policy webhookRetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.Backoff
+
+	for range attempt - 1 {
+		delay *= 2
+
+		if delay >= webhookMaxRetryBackoff {
+			return webhookMaxRetryBackoff
+		}
+	}
+
+	return min(delay, webhookMaxRetryBackoff)
+}
+
+// permanentError marks an error that will not go away by retrying, like a malformed payload
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable returns whether attempting the event again could succeed
+func isRetryable(err error) bool {
+	if errors.As(err, &permanentError{}) || errors.Is(err, config.ErrIncludeNotAllowed) {
+		return false
+	}
+
+	// A missing configuration file (or Merge Request) does not appear by retrying
+	return !isNotFound(err)
+}
+
+// isNotFound returns whether err is a "404 Not Found" response from the GitLab or GitHub API
+func isNotFound(err error) bool {
+	if errors.Is(err, go_gitlab.ErrNotFound) {
+		return true
+	}
+
+	var githubErr *go_github.ErrorResponse
+	if errors.As(err, &githubErr) && githubErr.Response != nil {
+		return githubErr.Response.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
+
+// webhookEventRelevance ranks webhook event types by how relevant their payload is to scripts
+// when collapsing events; comments and reviews carry what a user asked for, so they are kept
+// over a later, less relevant, event for the same Merge Request
+var webhookEventRelevance = map[string]int{
+	// GitLab
+	"note":          2,
+	"merge_request": 1,
+
+	// GitHub
+	"issue_comment":       2,
+	"pull_request_review": 2,
+	"pull_request":        1,
+	"check_suite":         0,
+}
+
+// webhookDedupeKey returns the key events for the same Merge Request are collapsed on
+func webhookDedupeKey(provider, projectID, mergeRequestID string) string {
+	return provider + "/" + projectID + "/" + mergeRequestID
+}
+
+// mergeWebhookEvents collapses a newly received event into the one waiting for the same
+// Merge Request: the latest commit SHA is kept, along with the most relevant payload
+func mergeWebhookEvents(waiting, received eventstore.Event) eventstore.Event {
+	merged := received
+
+	if webhookEventRelevance[waiting.EventType] > webhookEventRelevance[received.EventType] {
+		merged.EventType = waiting.EventType
+		merged.Payload = waiting.Payload
+	}
+
+	// Not all events know the commit SHA (e.g. "issue_comment"), in which case it's
+	// looked up when the event is processed
+	if len(received.CommitSHA) == 0 {
+		merged.CommitSHA = waiting.CommitSHA
+	}
+
+	return merged
+}
+
+// webhookDispatcher stores webhook events before handing them to the worker queue,
+// so events that fail are retried with backoff, events that keep failing end up as
+// dead letters, and events that were pending or in-flight during a restart are replayed.
+//
+// When debounce is set, events for the same Merge Request received within that window
+// are collapsed into a single evaluation.
+type webhookDispatcher struct {
+	ctx      context.Context //nolint:containedctx // jobs for replayed events have no request to take their context from
+	queue    *webhookQueue
+	store    *eventstore.Store
+	retry    webhookRetryPolicy
+	debounce time.Duration
+	process  webhookEventProcessor
+
+	stopScheduler context.CancelFunc
+	schedulerDone chan struct{}
+}
+
+func newWebhookDispatcher(ctx context.Context, queue *webhookQueue, store *eventstore.Store, retry webhookRetryPolicy, debounce time.Duration, process webhookEventProcessor) *webhookDispatcher {
+	return &webhookDispatcher{
+		ctx:      ctx,
+		queue:    queue,
+		store:    store,
+		retry:    retry,
+		debounce: debounce,
+		process:  process,
+	}
+}
+
+// Start replays the events that were in-flight when the previous process stopped, and
+// starts dispatching pending events as they become due
+func (d *webhookDispatcher) Start() error {
+	released, err := d.store.ReleaseAll(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	if released > 0 {
+		slogctx.Info(d.ctx, "Replaying webhook events that were in-flight during shutdown", slog.Int64("events", released))
+	}
+
+	var schedulerCtx context.Context
+
+	schedulerCtx, d.stopScheduler = context.WithCancel(d.ctx)
+	d.schedulerDone = make(chan struct{})
+
+	go func() {
+		defer close(d.schedulerDone)
+
+		ticker := time.NewTicker(webhookSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			d.dispatchDue(schedulerCtx)
+
+			select {
+			case <-schedulerCtx.Done():
+				return
+
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Submit stores the event and queues it for a worker, or holds on to it for the debounce window.
+//
+// It returns false when the queue is full, in which case the event is not kept,
+// since the SCM will deliver it again.
+func (d *webhookDispatcher) Submit(ctx context.Context, event eventstore.Event) (bool, error) {
+	if d.debounce > 0 && len(event.DedupeKey) > 0 {
+		return d.submitDebounced(ctx, event)
+	}
+
+	if err := d.store.Insert(ctx, &event); err != nil {
+		return false, err
+	}
+
+	if d.enqueue(event) {
+		return true, nil
+	}
+
+	if err := d.store.Delete(ctx, event.ID); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// submitDebounced stores the event as pending until the debounce window is over, collapsing
+// it with an event for the same Merge Request that is still waiting for its window to end
+func (d *webhookDispatcher) submitDebounced(ctx context.Context, event eventstore.Event) (bool, error) {
+	// Debounced events are queued later by the scheduler, so the best signal for
+	// backpressure is whether the queue is full right now
+	if size := cap(d.queue.jobs); size > 0 && d.queue.Len() >= size {
+		return false, nil
+	}
+
+	collapsed, err := d.store.Debounce(ctx, &event, time.Now().Add(d.debounce), mergeWebhookEvents)
+	if err != nil {
+		return false, err
+	}
+
+	if collapsed {
+		slogctx.Info(ctx, "Collapsed webhook event into an event waiting for the same Merge Request",
+			slog.Int64("event_id", event.ID),
+			slog.String("kept_event_type", event.EventType),
+		)
+	}
+
+	return true, nil
+}
+
+// Shutdown stops dispatching pending events, and waits for the queued ones to be processed.
+//
+// Events that are still pending afterwards are replayed on next startup.
+func (d *webhookDispatcher) Shutdown(ctx context.Context) error {
+	if d.stopScheduler != nil {
+		d.stopScheduler()
+		<-d.schedulerDone
+	}
+
+	return d.queue.Shutdown(ctx)
+}
+
+// dispatchDue queues the pending events that are due for an attempt, as far as the queue has room
+func (d *webhookDispatcher) dispatchDue(ctx context.Context) {
+	// An unbuffered queue still accepts an event when a worker is idle
+	limit := max(cap(d.queue.jobs)-d.queue.Len(), 1)
+
+	events, err := d.store.ClaimDue(ctx, time.Now(), limit)
+	if err != nil {
+		slogctx.Error(ctx, "Could not read due webhook events", slog.Any("error", err))
+
+		return
+	}
+
+	for _, event := range events {
+		if d.enqueue(event) {
+			continue
+		}
+
+		// No room after all; try again on next tick
+		if err := d.store.Release(ctx, event.ID); err != nil {
+			slogctx.Error(ctx, "Could not release webhook event", slog.Int64("event_id", event.ID), slog.Any("error", err))
+		}
+	}
+}
+
+func (d *webhookDispatcher) enqueue(event eventstore.Event) bool {
+	ctx := slogctx.With(d.ctx,
+		slog.Int64("event_id", event.ID),
+		slog.String("event_type", event.EventType),
+		slog.Int("attempt", event.Attempts+1),
+	)
+
+	return d.queue.Enqueue(ctx, func(ctx context.Context) error {
+		return d.run(ctx, event)
+	})
+}
+
+// run processes the event, and records the outcome in the store
+func (d *webhookDispatcher) run(ctx context.Context, event eventstore.Event) error {
+	err := d.safeProcess(ctx, event)
+	if err == nil || !isRetryable(err) {
+		if err == nil {
+			countProcessedWebhookEvent(event, "succeeded")
+		} else {
+			countProcessedWebhookEvent(event, "failed")
+		}
+
+		if deleteErr := d.store.Delete(ctx, event.ID); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+
+		return err
+	}
+
+	attempts := event.Attempts + 1
+
+	if attempts >= d.retry.MaxAttempts {
+		countProcessedWebhookEvent(event, "dead_lettered")
+
+		if buryErr := d.store.Bury(ctx, event.ID, attempts, err.Error()); buryErr != nil {
+			return errors.Join(err, buryErr)
+		}
+
+		return fmt.Errorf("giving up after %d attempts, the event was moved to the dead letters: %w", attempts, err)
+	}
+
+	countProcessedWebhookEvent(event, "retried")
+
+	delay := d.retry.Delay(attempts)
+
+	if retryErr := d.store.Retry(ctx, event.ID, attempts, err.Error(), time.Now().Add(delay)); retryErr != nil {
+		return errors.Join(err, retryErr)
+	}
+
+	return fmt.Errorf("attempt %d of %d failed, retrying in %s: %w", attempts, d.retry.MaxAttempts, delay, err)
+}
+
+// countProcessedWebhookEvent counts the outcome of an attempt at processing the event
+func countProcessedWebhookEvent(event eventstore.Event, outcome string) {
+	metrics.WebhookEventsProcessed.WithLabelValues(event.Provider, event.EventType, outcome).Inc()
+}
+
+// safeProcess turns a panic while processing the event into a failed attempt,
+// so the event does not stay claimed until the next restart
+func (d *webhookDispatcher) safeProcess(ctx context.Context, event eventstore.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing webhook event: %v", r)
+		}
+	}()
+
+	return d.process(ctx, event)
+}
@@ -0,0 +1,400 @@
+//nolint:testpackage // the webhook dispatcher is unexported
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	go_github "github.com/google/go-github/v72/github"
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/jippi/scm-engine/pkg/metrics"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	go_gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// newTestWebhookDispatcher returns a dispatcher evaluating events with the client for
+// the provider in ctx, backed by an in-memory event store
+func newTestWebhookDispatcher(t *testing.T, ctx context.Context, workers, size int) *webhookDispatcher {
+	t.Helper()
+
+	client, err := getClient(ctx)
+	require.NoError(t, err)
+
+	return newTestDispatcherWithProcessor(t, workers, size, processStoredWebhookEvent(client))
+}
+
+func newTestDispatcherWithProcessor(t *testing.T, workers, size int, process webhookEventProcessor) *webhookDispatcher {
+	t.Helper()
+
+	return newTestDebouncingDispatcher(t, workers, size, 0, process)
+}
+
+func newTestDebouncingDispatcher(t *testing.T, workers, size int, debounce time.Duration, process webhookEventProcessor) *webhookDispatcher {
+	t.Helper()
+
+	store, err := eventstore.Open(t.Context(), "")
+	require.NoError(t, err)
+
+	queue := newWebhookQueue(size)
+	queue.Start(t.Context(), workers)
+
+	dispatcher := newWebhookDispatcher(t.Context(), queue, store, webhookRetryPolicy{MaxAttempts: 3, Backoff: time.Minute}, debounce, process)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Queues without workers are never drained
+		if workers > 0 {
+			require.NoError(t, dispatcher.Shutdown(ctx))
+		}
+
+		require.NoError(t, store.Close())
+	})
+
+	return dispatcher
+}
+
+// runStored stores the event like a received webhook, and runs it the way a worker would
+func runStored(t *testing.T, dispatcher *webhookDispatcher, event eventstore.Event) (*eventstore.Event, error) {
+	t.Helper()
+
+	require.NoError(t, dispatcher.store.Insert(t.Context(), &event))
+
+	err := dispatcher.run(t.Context(), event)
+
+	stored, getErr := dispatcher.store.Get(t.Context(), event.ID)
+	if errors.Is(getErr, eventstore.ErrNotFound) {
+		return nil, err
+	}
+
+	require.NoError(t, getErr)
+
+	return stored, err
+}
+
+func TestWebhookRetryPolicy_Delay(t *testing.T) {
+	t.Parallel()
+
+	policy := webhookRetryPolicy{Backoff: 30 * time.Second}
+
+	require.Equal(t, 30*time.Second, policy.Delay(1))
+	require.Equal(t, time.Minute, policy.Delay(2))
+	require.Equal(t, 2*time.Minute, policy.Delay(3))
+	require.Equal(t, webhookMaxRetryBackoff, policy.Delay(10))
+	require.Equal(t, webhookMaxRetryBackoff, policy.Delay(100), "must not overflow")
+}
+
+func TestWebhookDispatcher_run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		attempts     int
+		process      webhookEventProcessor
+		wantStatus   string // empty when the event must be gone from the store
+		wantAttempts int
+		wantErr      string
+		wantOutcome  string
+	}{
+		{
+			name:        "success removes the event",
+			process:     func(context.Context, eventstore.Event) error { return nil },
+			wantOutcome: "succeeded",
+		},
+		{
+			name:        "permanent errors are not retried",
+			process:     func(context.Context, eventstore.Event) error { return permanentError{errors.New("bad payload")} },
+			wantErr:     "bad payload",
+			wantOutcome: "failed",
+		},
+		{
+			name:        "missing configuration files are not retried",
+			process:     func(context.Context, eventstore.Event) error { return fmt.Errorf("GET ...: %w", go_gitlab.ErrNotFound) },
+			wantErr:     "404 Not Found",
+			wantOutcome: "failed",
+		},
+		{
+			name:         "errors are retried",
+			process:      func(context.Context, eventstore.Event) error { return errors.New("connection reset") },
+			wantStatus:   eventstore.StatusPending,
+			wantAttempts: 1,
+			wantErr:      "attempt 1 of 3 failed, retrying in 1m0s: connection reset",
+			wantOutcome:  "retried",
+		},
+		{
+			name:         "panics are retried",
+			process:      func(context.Context, eventstore.Event) error { panic("boom") },
+			wantStatus:   eventstore.StatusPending,
+			wantAttempts: 1,
+			wantErr:      "panic while processing webhook event: boom",
+			wantOutcome:  "retried",
+		},
+		{
+			name:         "the last attempt moves the event to the dead letters",
+			attempts:     2,
+			process:      func(context.Context, eventstore.Event) error { return errors.New("connection reset") },
+			wantStatus:   eventstore.StatusDead,
+			wantAttempts: 3,
+			wantErr:      "giving up after 3 attempts",
+			wantOutcome:  "dead_lettered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dispatcher := newTestDispatcherWithProcessor(t, 0, 1, tt.process)
+
+			// A unique event type keeps the metrics of the parallel tests apart
+			stored, err := runStored(t, dispatcher, eventstore.Event{Provider: "gitlab", EventType: t.Name(), Payload: []byte(`{}`), Attempts: tt.attempts})
+
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+
+			require.InDelta(t, 1, testutil.ToFloat64(metrics.WebhookEventsProcessed.WithLabelValues("gitlab", t.Name(), tt.wantOutcome)), 0)
+
+			if len(tt.wantStatus) == 0 {
+				require.Nil(t, stored)
+
+				return
+			}
+
+			require.NotNil(t, stored)
+			require.Equal(t, tt.wantStatus, stored.Status)
+			require.Equal(t, tt.wantAttempts, stored.Attempts)
+			require.NotEmpty(t, stored.LastError)
+		})
+	}
+}
+
+func TestWebhookDispatcher_retriesWithBackoff(t *testing.T) {
+	t.Parallel()
+
+	dispatcher := newTestDispatcherWithProcessor(t, 0, 1, func(context.Context, eventstore.Event) error {
+		return errors.New("connection reset")
+	})
+
+	before := time.Now()
+
+	stored, err := runStored(t, dispatcher, eventstore.Event{Provider: "gitlab", EventType: "merge_request", Payload: []byte(`{}`), Attempts: 1})
+	require.Error(t, err)
+
+	// Second failed attempt: twice the one minute backoff
+	require.WithinDuration(t, before.Add(2*time.Minute), stored.NextAttemptAt, 5*time.Second)
+}
+
+func TestWebhookDispatcher_Submit_rejectsWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	dispatcher := newTestDispatcherWithProcessor(t, 0, 1, func(context.Context, eventstore.Event) error { return nil })
+
+	event := eventstore.Event{Provider: "gitlab", EventType: "merge_request", Payload: []byte(`{}`)}
+
+	accepted, err := dispatcher.Submit(t.Context(), event)
+	require.NoError(t, err)
+	require.True(t, accepted)
+
+	accepted, err = dispatcher.Submit(t.Context(), event)
+	require.NoError(t, err)
+	require.False(t, accepted)
+
+	// The rejected event is not kept, since the SCM will deliver it again
+	processing, err := dispatcher.store.List(t.Context(), eventstore.StatusProcessing)
+	require.NoError(t, err)
+	require.Len(t, processing, 1)
+}
+
+// Events that were pending, or being processed when the previous process stopped,
+// must be processed once the server starts again.
+func TestWebhookDispatcher_Start_replaysStoredEvents(t *testing.T) {
+	t.Parallel()
+
+	processed := make(chan string, 2)
+
+	dispatcher := newTestDispatcherWithProcessor(t, 1, 2, func(_ context.Context, event eventstore.Event) error {
+		processed <- event.EventType
+
+		return nil
+	})
+
+	inFlight := eventstore.Event{Provider: "gitlab", EventType: "in-flight", Payload: []byte(`{}`)}
+	require.NoError(t, dispatcher.store.Insert(t.Context(), &inFlight))
+
+	pending := eventstore.Event{Provider: "gitlab", EventType: "pending", Payload: []byte(`{}`)}
+	require.NoError(t, dispatcher.store.Insert(t.Context(), &pending))
+	require.NoError(t, dispatcher.store.Retry(t.Context(), pending.ID, 1, "connection reset", time.Now()))
+
+	require.NoError(t, dispatcher.Start())
+
+	got := []string{receive(t, processed), receive(t, processed)}
+	require.ElementsMatch(t, []string{"in-flight", "pending"}, got)
+}
+
+func TestProcessStoredWebhookEvent_rejectsOtherProviders(t *testing.T) {
+	t.Parallel()
+
+	ctx := state.WithProvider(t.Context(), "gitlab")
+
+	// The event is rejected before the client is ever used
+	err := processStoredWebhookEvent(nil)(ctx, eventstore.Event{Provider: "github", EventType: "pull_request", Payload: []byte(`{}`)})
+	require.ErrorContains(t, err, `event is for provider "github", but the server is running for "gitlab"`)
+	require.False(t, isRetryable(err))
+}
+
+// An include the policy does not allow stays disallowed until the configuration changes
+func TestIsRetryable_includeNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("failed to load 'include' settings: %w", fmt.Errorf("%w: project [a/b] at ref [HEAD] is not in the allowlist", config.ErrIncludeNotAllowed))
+	require.False(t, isRetryable(err))
+	require.True(t, isRetryable(errors.New("connection reset")))
+}
+
+// Only responses with a 404 status are not found, not errors mentioning it
+func TestIsRetryable_notFound(t *testing.T) {
+	t.Parallel()
+
+	githubNotFound := &go_github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound, Request: &http.Request{}}}
+	githubForbidden := &go_github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden, Request: &http.Request{}}}
+
+	require.False(t, isRetryable(fmt.Errorf("failed to read remote raw file: %w", githubNotFound)))
+	require.False(t, isRetryable(fmt.Errorf("failed to read remote raw file: %w", go_gitlab.ErrNotFound)))
+	require.True(t, isRetryable(githubForbidden))
+	require.True(t, isRetryable(errors.New("script failed: 404 Not Found")))
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case value := <-ch:
+		return value
+
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, fmt.Sprintf("timed out waiting for %T", *new(T)))
+	}
+
+	return *new(T)
+}
+
+func TestMergeWebhookEvents(t *testing.T) {
+	t.Parallel()
+
+	event := func(eventType, sha string) eventstore.Event {
+		return eventstore.Event{EventType: eventType, Payload: []byte(eventType), CommitSHA: sha}
+	}
+
+	tests := []struct {
+		name     string
+		waiting  eventstore.Event
+		received eventstore.Event
+		wantType string
+		wantSHA  string
+	}{
+		{
+			name:     "the newest event wins between equally relevant events",
+			waiting:  event("merge_request", "old"),
+			received: event("merge_request", "new"),
+			wantType: "merge_request",
+			wantSHA:  "new",
+		},
+		{
+			name:     "a comment is kept over a later push, with the commit SHA of the push",
+			waiting:  event("note", "old"),
+			received: event("merge_request", "new"),
+			wantType: "note",
+			wantSHA:  "new",
+		},
+		{
+			name:     "a comment replaces an earlier Merge Request update",
+			waiting:  event("merge_request", "old"),
+			received: event("note", "new"),
+			wantType: "note",
+			wantSHA:  "new",
+		},
+		{
+			name:     "a GitHub comment without commit SHA keeps the SHA that is known",
+			waiting:  event("pull_request", "sha"),
+			received: event("issue_comment", ""),
+			wantType: "issue_comment",
+			wantSHA:  "sha",
+		},
+		{
+			name:     "a Pull Request update is kept over a later check suite",
+			waiting:  event("pull_request", "old"),
+			received: event("check_suite", "new"),
+			wantType: "pull_request",
+			wantSHA:  "new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			merged := mergeWebhookEvents(tt.waiting, tt.received)
+
+			require.Equal(t, tt.wantType, merged.EventType)
+			require.Equal(t, tt.wantType, string(merged.Payload), "the payload must match the event type")
+			require.Equal(t, tt.wantSHA, merged.CommitSHA)
+		})
+	}
+}
+
+// A burst of events for the same Merge Request must result in a single evaluation
+func TestWebhookDispatcher_Submit_debounces(t *testing.T) {
+	t.Parallel()
+
+	processed := make(chan eventstore.Event, 3)
+
+	dispatcher := newTestDebouncingDispatcher(t, 1, 10, time.Hour, func(_ context.Context, event eventstore.Event) error {
+		processed <- event
+
+		return nil
+	})
+
+	for _, eventType := range []string{"merge_request", "note", "merge_request"} {
+		accepted, err := dispatcher.Submit(t.Context(), eventstore.Event{
+			Provider:  "gitlab",
+			EventType: eventType,
+			Payload:   []byte(`{}`),
+			DedupeKey: webhookDedupeKey("gitlab", "jippi/scm-engine", "42"),
+			CommitSHA: eventType + "-sha",
+		})
+		require.NoError(t, err)
+		require.True(t, accepted)
+	}
+
+	// Events without a dedupe key are queued right away
+	accepted, err := dispatcher.Submit(t.Context(), eventstore.Event{Provider: "github", EventType: "check_suite", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	require.True(t, accepted)
+	require.Equal(t, "check_suite", receive(t, processed).EventType)
+
+	pending, err := dispatcher.store.List(t.Context(), eventstore.StatusPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	// Fast forward to the end of the debounce window
+	require.NoError(t, dispatcher.store.Retry(t.Context(), pending[0].ID, 0, "", time.Now()))
+	dispatcher.dispatchDue(t.Context())
+
+	event := receive(t, processed)
+	require.Equal(t, "note", event.EventType)
+	require.Equal(t, "merge_request-sha", event.CommitSHA)
+
+	require.NoError(t, dispatcher.Shutdown(t.Context()))
+	require.Empty(t, processed, "the burst must be evaluated once")
+}
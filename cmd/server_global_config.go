@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// loadedGlobalConfig is a global configuration file that passed validation
+type loadedGlobalConfig struct {
+	cfg  *config.Config
+	hash string // SHA-256 of the file content
+}
+
+// globalConfigReloader keeps the global configuration file in memory, and swaps it for a new
+// version when it changed on disk, as long as the new version passes validation.
+//
+// Evaluations take a snapshot of the configuration with [config.WithGlobalConfigSnapshot] when they
+// start, so an evaluation in progress keeps the version it started with.
+type globalConfigReloader struct {
+	path    string
+	current atomic.Pointer[loadedGlobalConfig]
+
+	// Reloads are serialized, so a file change and SIGHUP at the same time don't race
+	mu sync.Mutex
+
+	// The hash and error of the latest version that failed validation; guarded by mu
+	failedHash string
+	failedErr  error
+}
+
+func newGlobalConfigReloader(path string) *globalConfigReloader {
+	return &globalConfigReloader{path: path}
+}
+
+// GlobalConfig returns the global configuration in use
+func (r *globalConfigReloader) GlobalConfig() *config.Config {
+	if loaded := r.current.Load(); loaded != nil {
+		return loaded.cfg
+	}
+
+	return nil
+}
+
+// Reload reads and validates the global configuration file, and swaps it in when it passes
+// validation. On failure the previous version is kept, and the error returned.
+//
+// A version that failed validation before is only validated again when force is set,
+// so polling for changes doesn't log the same error over and over. An unchanged file is
+// only loaded again when force is set too, since the 'local' files it includes may have changed.
+func (r *globalConfigReloader) Reload(ctx context.Context, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx = slogctx.With(ctx, slog.String("global_config_path", r.path))
+
+	raw, err := os.ReadFile(r.path)
+	if err != nil {
+		return r.failed(ctx, "", fmt.Errorf("could not read global configuration file: %w", err))
+	}
+
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])
+
+	previous := r.current.Load()
+	if !force && previous != nil && previous.hash == hash {
+		slogctx.Debug(ctx, "Global configuration is unchanged", slog.String("config_hash", hash))
+
+		r.failedHash, r.failedErr = "", nil
+
+		return nil
+	}
+
+	if !force && hash == r.failedHash {
+		return r.failedErr
+	}
+
+	cfg, err := parseGlobalConfig(ctx, r.path, raw)
+	if err != nil {
+		return r.failed(ctx, hash, err)
+	}
+
+	r.current.Store(&loadedGlobalConfig{cfg: cfg, hash: hash})
+	r.failedHash, r.failedErr = "", nil
+
+	if previous == nil {
+		slogctx.Info(ctx, "Loaded global configuration", slog.String("config_hash", hash))
+	} else {
+		slogctx.Info(ctx, "Reloaded global configuration", slog.String("config_hash", hash), slog.String("previous_config_hash", previous.hash))
+	}
+
+	return nil
+}
+
+// failed records a version of the file that could not be loaded; guarded by mu
+func (r *globalConfigReloader) failed(ctx context.Context, hash string, err error) error {
+	r.failedHash, r.failedErr = hash, err
+
+	if previous := r.current.Load(); previous != nil {
+		slogctx.Error(ctx, "Could not reload global configuration, keeping the previous version",
+			slog.String("config_hash", previous.hash),
+			slog.String("rejected_config_hash", hash),
+			slog.Any("error", err),
+		)
+	}
+
+	return err
+}
+
+// Watch reloads the global configuration on SIGHUP, and when the file changed on disk,
+// which is checked every interval (never when zero), until ctx is cancelled
+func (r *globalConfigReloader) Watch(ctx context.Context, interval time.Duration, wg *sync.WaitGroup) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	wg.Add(1) // +1: Global configuration reloader
+
+	go func() {
+		defer wg.Done() // -1: Global configuration reloader
+		defer signal.Stop(hangup)
+
+		// A nil channel blocks forever, disabling the polling case below
+		var poll <-chan time.Time
+
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			poll = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-hangup:
+				slogctx.Info(ctx, "Got SIGHUP, reloading global configuration")
+
+				r.Reload(ctx, true) //nolint:errcheck // logged by Reload, and the previous version is kept
+
+			case <-poll:
+				r.Reload(ctx, false) //nolint:errcheck // logged by Reload, and the previous version is kept
+			}
+		}
+	}()
+}
+
+// check reports the global configuration in use for the readiness check; a failed reload
+// does not make the server unready, since the previous version is still in use
+func (r *globalConfigReloader) check() healthCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded := r.current.Load()
+	if loaded == nil {
+		return healthCheck{Status: healthStatusFail, Message: "global configuration is not loaded"}
+	}
+
+	message := fmt.Sprintf("loaded %s (sha256 %s)", r.path, loaded.hash)
+	if r.failedErr != nil {
+		message += "; the latest version was rejected: " + r.failedErr.Error()
+	}
+
+	return healthCheck{Status: healthStatusOK, Message: message}
+}
+
+// parseGlobalConfig parses the global configuration file at path, loads its 'local' includes, and validates
+// it against the JSON schema and the scm-engine linter, like the 'lint' command does
+func parseGlobalConfig(ctx context.Context, path string, raw []byte) (*config.Config, error) {
+	if err := validateSchema(raw, "embed://"); err != nil {
+		return nil, fmt.Errorf("global configuration failed JSON schema validation: %w", err)
+	}
+
+	cfg, err := config.ParseFile(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse global configuration file: %w", err)
+	}
+
+	if err := loadLocalIncludes(ctx, cfg, path, nil); err != nil {
+		return nil, err
+	}
+
+	evalContext, err := lintEvalContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Lint(ctx, evalContext); err != nil {
+		return nil, fmt.Errorf("global configuration failed validation: %w", err)
+	}
+
+	return cfg, nil
+}
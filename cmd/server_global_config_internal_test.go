@@ -0,0 +1,259 @@
+//nolint:testpackage // the global configuration reloader is unexported
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	validGlobalConfig = `
+label:
+  - name: bug
+    color: "#ff0000"
+    script: merge_request.title contains "bug"
+`
+
+	// Passes the JSON schema, but the script does not compile
+	unlintableGlobalConfig = `
+label:
+  - name: bug
+    color: "#ff0000"
+    script: merge_request.no_such_field
+`
+
+	// Fails the JSON schema, since labels must be a list
+	invalidSchemaGlobalConfig = `
+label: bug
+`
+)
+
+// writeGlobalConfig writes the global configuration file at path, replacing it atomically like a ConfigMap update
+func writeGlobalConfig(t *testing.T, path, content string) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(content), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func newTestGlobalConfigReloader(t *testing.T, content string) (context.Context, *globalConfigReloader, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "global.yml")
+	writeGlobalConfig(t, path, content)
+
+	reloader := newGlobalConfigReloader(path)
+	ctx := state.WithProvider(t.Context(), "gitlab")
+
+	return ctx, reloader, path
+}
+
+func TestGlobalConfigReloader_Reload(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+
+	require.Nil(t, reloader.GlobalConfig())
+	require.NoError(t, reloader.Reload(ctx, true))
+
+	first := reloader.GlobalConfig()
+	require.NotNil(t, first)
+	require.Len(t, first.Labels, 1)
+
+	hash := reloader.current.Load().hash
+	require.Len(t, hash, 64)
+
+	// Unchanged files are not swapped
+	require.NoError(t, reloader.Reload(ctx, false))
+	require.Same(t, first, reloader.GlobalConfig())
+
+	writeGlobalConfig(t, path, validGlobalConfig+`
+  - name: feature
+    color: "#00ff00"
+    script: merge_request.title contains "feature"
+`)
+
+	require.NoError(t, reloader.Reload(ctx, false))
+	require.Len(t, reloader.GlobalConfig().Labels, 2)
+	require.NotEqual(t, hash, reloader.current.Load().hash)
+}
+
+func TestGlobalConfigReloader_Reload_keepsPreviousVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		content   string
+		wantError string
+	}{
+		{name: "schema validation", content: invalidSchemaGlobalConfig, wantError: "global configuration failed JSON schema validation"},
+		{name: "lint", content: unlintableGlobalConfig, wantError: `Label "bug" failed validation`},
+		{name: "unreadable", wantError: "could not read global configuration file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, reloader, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+			require.NoError(t, reloader.Reload(ctx, true))
+
+			previous := reloader.GlobalConfig()
+
+			if len(tt.content) > 0 {
+				writeGlobalConfig(t, path, tt.content)
+			} else {
+				require.NoError(t, os.Remove(path))
+			}
+
+			require.ErrorContains(t, reloader.Reload(ctx, false), tt.wantError)
+			require.Same(t, previous, reloader.GlobalConfig())
+
+			check := reloader.check()
+			require.Equal(t, healthStatusOK, check.Status, "the previous version is still in use")
+			require.Contains(t, check.Message, "the latest version was rejected")
+			require.Contains(t, check.Message, tt.wantError)
+
+			// Fixing the file clears the error
+			writeGlobalConfig(t, path, validGlobalConfig)
+			require.NoError(t, reloader.Reload(ctx, false))
+			require.NotContains(t, reloader.check().Message, "rejected")
+		})
+	}
+}
+
+func TestGlobalConfigReloader_Reload_initialVersionMustBeValid(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, _ := newTestGlobalConfigReloader(t, unlintableGlobalConfig)
+
+	require.Error(t, reloader.Reload(ctx, true))
+	require.Nil(t, reloader.GlobalConfig())
+	require.Equal(t, healthStatusFail, reloader.check().Status)
+}
+
+// Local includes are read relative to the global configuration file, and only reloaded when forced, like on SIGHUP
+func TestGlobalConfigReloader_Reload_localIncludes(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, path := newTestGlobalConfigReloader(t, `
+include:
+  - local: labels.yml
+`)
+
+	labels := filepath.Join(filepath.Dir(path), "labels.yml")
+	writeGlobalConfig(t, labels, validGlobalConfig)
+
+	require.NoError(t, reloader.Reload(ctx, true))
+	require.Len(t, reloader.GlobalConfig().Labels, 1)
+	require.Empty(t, reloader.GlobalConfig().Includes)
+
+	writeGlobalConfig(t, labels, validGlobalConfig+`
+  - name: feature
+    color: "#00ff00"
+    script: merge_request.title contains "feature"
+`)
+
+	require.NoError(t, reloader.Reload(ctx, false))
+	require.Len(t, reloader.GlobalConfig().Labels, 1, "the global configuration file is unchanged")
+
+	require.NoError(t, reloader.Reload(ctx, true))
+	require.Len(t, reloader.GlobalConfig().Labels, 2)
+}
+
+func TestGlobalConfigReloader_Watch(t *testing.T) {
+	// Not parallel, since SIGHUP is delivered to every test watching for it
+
+	ctx, reloader, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+	require.NoError(t, reloader.Reload(ctx, true))
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	reloader.Watch(ctx, 0, &wg)
+
+	writeGlobalConfig(t, path, validGlobalConfig+`
+  - name: feature
+    color: "#00ff00"
+    script: merge_request.title contains "feature"
+`)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+
+	require.Eventually(t, func() bool {
+		return len(reloader.GlobalConfig().Labels) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestGlobalConfigReloader_Watch_polling(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+	require.NoError(t, reloader.Reload(ctx, true))
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	reloader.Watch(ctx, 10*time.Millisecond, &wg)
+
+	writeGlobalConfig(t, path, validGlobalConfig+`
+  - name: feature
+    color: "#00ff00"
+    script: merge_request.title contains "feature"
+`)
+
+	require.Eventually(t, func() bool {
+		return len(reloader.GlobalConfig().Labels) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestGlobalConfigFromContext_source(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, _ := newTestGlobalConfigReloader(t, validGlobalConfig)
+
+	ctx = config.WithGlobalConfigSource(ctx, reloader)
+	require.Nil(t, config.GlobalConfigFromContext(ctx))
+
+	require.NoError(t, reloader.Reload(ctx, true))
+	require.Same(t, reloader.GlobalConfig(), config.GlobalConfigFromContext(ctx))
+}
+
+// An evaluation keeps the version of the global configuration it started with, even when it's reloaded meanwhile
+func TestWithGlobalConfigSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx, reloader, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+	require.NoError(t, reloader.Reload(ctx, true))
+
+	ctx = config.WithGlobalConfigSource(ctx, reloader)
+	snapshot := config.WithGlobalConfigSnapshot(ctx)
+
+	started := config.GlobalConfigFromContext(snapshot)
+	require.NotNil(t, started)
+
+	writeGlobalConfig(t, path, validGlobalConfig+"    description: reloaded\n")
+	require.NoError(t, reloader.Reload(ctx, false))
+
+	require.NotSame(t, started, reloader.GlobalConfig())
+	require.Same(t, started, config.GlobalConfigFromContext(snapshot))
+	require.Same(t, started, config.GlobalConfigFromContext(config.WithGlobalConfigSnapshot(snapshot)))
+}
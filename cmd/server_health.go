@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/integration/backstage"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusFail     = "fail"
+	healthStatusDegraded = "degraded"
+	healthStatusDisabled = "disabled"
+
+	// How long the readiness checks may take, well within the default Kubernetes probe timeout when healthy
+	readinessCheckTimeout = 5 * time.Second
+
+	// How long the outcome of the SCM check is reused, so frequent probes from every replica don't eat into the API rate limit
+	scmPingCacheTTL = 30 * time.Second
+)
+
+// healthReport is the JSON body of the /healthz and /readyz endpoints
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// healthCheck is the outcome of a single readiness check
+type healthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+
+	// Only set for the periodic evaluation check
+	LastCycleAt *time.Time `json:"last_cycle_at,omitempty"`
+}
+
+// pinger verifies an upstream dependency can be reached
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// periodicEvaluationStatus tracks the periodic evaluation cycles for the readiness check
+type periodicEvaluationStatus struct {
+	interval    atomic.Int64 // time.Duration; zero while periodic evaluation is disabled
+	lastCycleAt atomic.Int64 // Unix nanoseconds; zero until the first cycle completed
+}
+
+// Enable marks periodic evaluation as running every interval
+func (s *periodicEvaluationStatus) Enable(interval time.Duration) {
+	s.interval.Store(int64(interval))
+}
+
+// Completed records that a cycle completed at the given time
+func (s *periodicEvaluationStatus) Completed(at time.Time) {
+	s.lastCycleAt.Store(at.UnixNano())
+}
+
+func (s *periodicEvaluationStatus) check() healthCheck {
+	interval := time.Duration(s.interval.Load())
+	if interval == 0 {
+		return healthCheck{Status: healthStatusDisabled}
+	}
+
+	lastCycleAt := s.lastCycleAt.Load()
+	if lastCycleAt == 0 {
+		return healthCheck{Status: healthStatusOK, Message: "waiting for the first cycle, running every " + interval.String()}
+	}
+
+	at := time.Unix(0, lastCycleAt).UTC()
+
+	return healthCheck{Status: healthStatusOK, Message: "running every " + interval.String(), LastCycleAt: &at}
+}
+
+// readinessChecker verifies that the server can do its job
+//
+// Backstage is only needed by the "assign_reviewers" action with "source: backstage", so an outage
+// only reports the server as degraded
+type readinessChecker struct {
+	scm          pinger
+	backstage    pinger                // nil when the Backstage integration is not configured
+	globalConfig *globalConfigReloader // nil when no global configuration file is configured
+	periodic     *periodicEvaluationStatus
+}
+
+// Check runs the readiness checks concurrently; the server is ready when none of them failed, and
+// degraded when an optional dependency can't be reached
+func (c *readinessChecker) Check(ctx context.Context) healthReport {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	report := healthReport{
+		Status: healthStatusOK,
+		Checks: map[string]healthCheck{
+			"global_config":       c.globalConfigCheck(),
+			"periodic_evaluation": c.periodic.check(),
+		},
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	// The status a check gets when the dependency can't be reached
+	failures := map[string]string{"scm": healthStatusFail, "backstage": healthStatusDegraded}
+
+	for name, target := range map[string]pinger{"scm": c.scm, "backstage": c.backstage} {
+		if target == nil {
+			mu.Lock()
+			report.Checks[name] = healthCheck{Status: healthStatusDisabled}
+			mu.Unlock()
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			result := healthCheck{Status: healthStatusOK}
+			if err := target.Ping(ctx); err != nil {
+				result = healthCheck{Status: failures[name], Message: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[name] = result
+		}()
+	}
+
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		switch {
+		case check.Status == healthStatusFail:
+			report.Status = healthStatusFail
+
+		case check.Status == healthStatusDegraded && report.Status == healthStatusOK:
+			report.Status = healthStatusDegraded
+		}
+	}
+
+	return report
+}
+
+// globalConfigCheck reports the global configuration file in use
+func (c *readinessChecker) globalConfigCheck() healthCheck {
+	if c.globalConfig == nil {
+		return healthCheck{Status: healthStatusDisabled}
+	}
+
+	return c.globalConfig.check()
+}
+
+// pingerFunc adapts a function to the pinger interface
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+// cachedPinger reuses the outcome of the wrapped pinger for a while
+type cachedPinger struct {
+	target pinger
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	err       error
+	checkedAt time.Time
+}
+
+func newCachedPinger(target pinger, ttl time.Duration) *cachedPinger {
+	return &cachedPinger{target: target, ttl: ttl}
+}
+
+func (p *cachedPinger) Ping(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.checkedAt.IsZero() && time.Since(p.checkedAt) < p.ttl {
+		return p.err
+	}
+
+	err := p.target.Ping(ctx)
+
+	// The probe giving up is not an outcome worth keeping
+	if ctx.Err() != nil {
+		return err
+	}
+
+	p.err = err
+	p.checkedAt = time.Now()
+
+	return err
+}
+
+// newBackstagePinger returns the Backstage client to check readiness with, or nil when the integration is not configured
+func newBackstagePinger(ctx context.Context, baseURL, token string) pinger {
+	if len(baseURL) == 0 {
+		return nil
+	}
+
+	client, err := backstage.NewClient(ctx, baseURL, token, nil)
+	if err != nil {
+		// Evaluations skip the Backstage integration in this case, which readiness must not hide
+		return pingerFunc(func(context.Context) error { return err })
+	}
+
+	return client
+}
+
+// HealthzHandler reports that the server is alive; it makes no upstream calls, so an
+// outage of the SCM does not get the server restarted
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(r.Context(), w, healthReport{Status: healthStatusOK})
+}
+
+// ReadyzHandler reports whether the server can do its job, answering with
+// "503 Service Unavailable" when any of the readiness checks failed; a degraded server is still ready
+func ReadyzHandler(checker *readinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(r.Context(), w, checker.Check(r.Context()))
+	}
+}
+
+func writeHealthReport(ctx context.Context, w http.ResponseWriter, report healthReport) {
+	status := http.StatusOK
+
+	switch report.Status {
+	case healthStatusFail:
+		status = http.StatusServiceUnavailable
+
+		slogctx.Warn(ctx, "Readiness check failed", slog.Any("checks", report.Checks))
+
+	case healthStatusDegraded:
+		slogctx.Warn(ctx, "Readiness check degraded", slog.Any("checks", report.Checks))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(report) //nolint:errchkjson // nothing to do when the client went away
+}
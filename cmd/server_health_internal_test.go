@@ -0,0 +1,170 @@
+//nolint:testpackage // the readiness checker is unexported
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	healthy   = pingerFunc(func(context.Context) error { return nil })
+	unhealthy = pingerFunc(func(context.Context) error { return errors.New("401 Unauthorized") })
+)
+
+// serveHealth calls the handler, and decodes its JSON response
+func serveHealth(t *testing.T, handler http.HandlerFunc, path string) (int, healthReport) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, nil))
+
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var report healthReport
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&report))
+
+	return recorder.Code, report
+}
+
+func TestHealthzHandler(t *testing.T) {
+	t.Parallel()
+
+	code, report := serveHealth(t, HealthzHandler, "/healthz")
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, healthReport{Status: healthStatusOK}, report)
+}
+
+func TestReadyzHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ready", func(t *testing.T) {
+		t.Parallel()
+
+		periodic := &periodicEvaluationStatus{}
+		periodic.Enable(15 * time.Minute)
+
+		ctx, globalConfig, path := newTestGlobalConfigReloader(t, validGlobalConfig)
+		require.NoError(t, globalConfig.Reload(ctx, true))
+
+		code, report := serveHealth(t, ReadyzHandler(&readinessChecker{
+			scm:          healthy,
+			backstage:    healthy,
+			globalConfig: globalConfig,
+			periodic:     periodic,
+		}), "/readyz")
+
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, healthStatusOK, report.Status)
+		require.Equal(t, map[string]healthCheck{
+			"scm":                 {Status: healthStatusOK},
+			"backstage":           {Status: healthStatusOK},
+			"global_config":       {Status: healthStatusOK, Message: "loaded " + path + " (sha256 " + globalConfig.current.Load().hash + ")"},
+			"periodic_evaluation": {Status: healthStatusOK, Message: "waiting for the first cycle, running every 15m0s"},
+		}, report.Checks)
+	})
+
+	t.Run("optional checks are disabled", func(t *testing.T) {
+		t.Parallel()
+
+		code, report := serveHealth(t, ReadyzHandler(&readinessChecker{scm: healthy, periodic: &periodicEvaluationStatus{}}), "/readyz")
+
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, healthStatusDisabled, report.Checks["backstage"].Status)
+		require.Equal(t, healthStatusDisabled, report.Checks["global_config"].Status)
+		require.Equal(t, healthStatusDisabled, report.Checks["periodic_evaluation"].Status)
+	})
+
+	t.Run("a failing check makes the server unready", func(t *testing.T) {
+		t.Parallel()
+
+		code, report := serveHealth(t, ReadyzHandler(&readinessChecker{scm: unhealthy, backstage: healthy, periodic: &periodicEvaluationStatus{}}), "/readyz")
+
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, healthStatusFail, report.Status)
+		require.Equal(t, healthCheck{Status: healthStatusFail, Message: "401 Unauthorized"}, report.Checks["scm"])
+		require.Equal(t, healthStatusOK, report.Checks["backstage"].Status)
+	})
+
+	t.Run("a Backstage outage only degrades the server", func(t *testing.T) {
+		t.Parallel()
+
+		code, report := serveHealth(t, ReadyzHandler(&readinessChecker{scm: healthy, backstage: unhealthy, periodic: &periodicEvaluationStatus{}}), "/readyz")
+
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, healthStatusDegraded, report.Status)
+		require.Equal(t, healthCheck{Status: healthStatusDegraded, Message: "401 Unauthorized"}, report.Checks["backstage"])
+	})
+
+	t.Run("a failing check wins over a degraded one", func(t *testing.T) {
+		t.Parallel()
+
+		code, report := serveHealth(t, ReadyzHandler(&readinessChecker{scm: unhealthy, backstage: unhealthy, periodic: &periodicEvaluationStatus{}}), "/readyz")
+
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, healthStatusFail, report.Status)
+	})
+}
+
+func TestCachedPinger(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls int
+		err   = errors.New("401 Unauthorized")
+	)
+
+	cached := newCachedPinger(pingerFunc(func(context.Context) error {
+		calls++
+
+		return err
+	}), time.Hour)
+
+	require.ErrorIs(t, cached.Ping(t.Context()), err)
+	require.ErrorIs(t, cached.Ping(t.Context()), err)
+	require.Equal(t, 1, calls, "the outcome is reused within the TTL")
+
+	cached.checkedAt = time.Now().Add(-2 * time.Hour)
+
+	require.ErrorIs(t, cached.Ping(t.Context()), err)
+	require.Equal(t, 2, calls, "the outcome expires after the TTL")
+
+	// A probe that gave up does not replace the outcome
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	cached.checkedAt = time.Time{}
+
+	require.ErrorIs(t, cached.Ping(canceled), err)
+	require.True(t, cached.checkedAt.IsZero())
+}
+
+func TestPeriodicEvaluationStatus(t *testing.T) {
+	t.Parallel()
+
+	status := &periodicEvaluationStatus{}
+	status.Enable(time.Hour)
+
+	completedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	status.Completed(completedAt)
+
+	check := status.check()
+	require.Equal(t, healthStatusOK, check.Status)
+	require.Equal(t, "running every 1h0m0s", check.Message)
+	require.NotNil(t, check.LastCycleAt)
+	require.True(t, completedAt.Equal(*check.LastCycleAt))
+}
+
+func TestNewBackstagePinger(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, newBackstagePinger(t.Context(), "", ""), "the integration is optional")
+	require.NotNil(t, newBackstagePinger(t.Context(), "https://backstage.example.com", ""))
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/jippi/scm-engine/pkg/metrics"
+)
+
+// webhookResponseRecorder remembers the status code a webhook handler responded with
+type webhookResponseRecorder struct {
+	http.ResponseWriter
+
+	status int
+}
+
+func newWebhookResponseRecorder(w http.ResponseWriter) *webhookResponseRecorder {
+	return &webhookResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *webhookResponseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// countReceivedWebhookEvent counts a webhook delivery by the status code it was responded to with
+func countReceivedWebhookEvent(provider, eventType string, status int) {
+	metrics.WebhookEventsReceived.WithLabelValues(provider, eventType, webhookOutcome(status)).Inc()
+}
+
+// webhookOutcome maps the status code a webhook delivery was responded to with to its "outcome" label
+func webhookOutcome(status int) string {
+	switch {
+	case status == http.StatusAccepted:
+		return "accepted"
+
+	case status == http.StatusServiceUnavailable:
+		return "queue_full"
+
+	case status < http.StatusBadRequest:
+		return "ignored"
+
+	default:
+		return "rejected"
+	}
+}
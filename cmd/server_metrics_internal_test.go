@@ -0,0 +1,52 @@
+//nolint:testpackage // the webhook response recorder is unexported
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookOutcome(t *testing.T) {
+	t.Parallel()
+
+	tests := map[int]string{
+		http.StatusAccepted:            "accepted",
+		http.StatusOK:                  "ignored",
+		http.StatusServiceUnavailable:  "queue_full",
+		http.StatusForbidden:           "rejected",
+		http.StatusBadRequest:          "rejected",
+		http.StatusInternalServerError: "rejected",
+	}
+
+	for status, want := range tests {
+		require.Equal(t, want, webhookOutcome(status), http.StatusText(status))
+	}
+}
+
+func TestWebhookResponseRecorder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults to 200 OK", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := newWebhookResponseRecorder(httptest.NewRecorder())
+		recorder.Write([]byte("pong"))
+
+		require.Equal(t, http.StatusOK, recorder.status)
+	})
+
+	t.Run("remembers the status code", func(t *testing.T) {
+		t.Parallel()
+
+		underlying := httptest.NewRecorder()
+		recorder := newWebhookResponseRecorder(underlying)
+
+		http.Error(recorder, "nope", http.StatusForbidden)
+
+		require.Equal(t, http.StatusForbidden, recorder.status)
+		require.Equal(t, http.StatusForbidden, underlying.Code)
+	})
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// webhookJob is the evaluation work for a single webhook event, run by a queue worker
+type webhookJob func(ctx context.Context) error
+
+type queuedWebhookJob struct {
+	ctx context.Context //nolint:containedctx // the job must run with the request context values, after the request is done
+	run webhookJob
+}
+
+// webhookQueue is a bounded queue of webhook jobs drained by a fixed pool of workers.
+//
+// Webhook handlers enqueue the work and respond right away, so slow evaluations never make
+// the SCM consider the webhook failing; when the queue is full the handler responds with
+// 503 so the SCM retries the delivery later.
+type webhookQueue struct {
+	jobs chan queuedWebhookJob
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newWebhookQueue(size int) *webhookQueue {
+	return &webhookQueue{
+		jobs: make(chan queuedWebhookJob, size),
+	}
+}
+
+// Start launches the workers draining the queue
+func (q *webhookQueue) Start(ctx context.Context, workers int) {
+	slogctx.Info(ctx, "Starting webhook workers", slog.Int("workers", workers), slog.Int("queue_size", cap(q.jobs)))
+
+	for i := range workers {
+		q.wg.Add(1)
+
+		go q.worker(i)
+	}
+}
+
+// Enqueue adds the job to the queue without blocking.
+//
+// It returns false when the queue is full or shutting down.
+func (q *webhookQueue) Enqueue(ctx context.Context, job webhookJob) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return false
+	}
+
+	// The request context is cancelled once the response is written, but the job
+	// still needs its values (project, merge request, logging attributes and similar)
+	select {
+	case q.jobs <- queuedWebhookJob{ctx: context.WithoutCancel(ctx), run: job}:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Len returns the number of jobs waiting for a worker
+func (q *webhookQueue) Len() int {
+	return len(q.jobs)
+}
+
+// Shutdown stops accepting new jobs, and waits for the queued jobs to be processed
+// or the context to be done, whichever comes first.
+func (q *webhookQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return fmt.Errorf("webhook queue did not drain before shutdown (%d jobs left): %w", q.Len(), ctx.Err())
+	}
+}
+
+func (q *webhookQueue) worker(id int) {
+	defer q.wg.Done()
+
+	for job := range q.jobs {
+		runWebhookJob(slogctx.With(job.ctx, slog.Int("worker_id", id)), job.run)
+	}
+}
+
+// runWebhookJob runs the job, logging errors the same way the webhook handlers do.
+//
+// A panic in a job must not take down the worker (and with it the server), so it's
+// recovered and logged like an error.
+func runWebhookJob(ctx context.Context, job webhookJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			slogctx.Error(ctx, "Webhook job panicked", slog.Any("panic", r))
+		}
+	}()
+
+	err := job(ctx)
+	if err == nil {
+		slogctx.Info(ctx, "Webhook job completed")
+
+		return
+	}
+
+	// Treat 404 errors as informational instead of actual errors
+	if strings.Contains(err.Error(), "404 Not Found") {
+		slogctx.Info(ctx, "Webhook job failed", slog.Any("error", err))
+
+		return
+	}
+
+	slogctx.Error(ctx, "Webhook job failed", slog.Any("error", err))
+}
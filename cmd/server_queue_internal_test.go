@@ -0,0 +1,152 @@
+//nolint:testpackage // the webhook queue is unexported
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWebhookQueue returns a queue with the given number of workers, which is
+// drained when the test completes
+func newTestWebhookQueue(t *testing.T, workers, size int) *webhookQueue {
+	t.Helper()
+
+	queue := newWebhookQueue(size)
+	queue.Start(t.Context(), workers)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Queues without workers are never drained
+		if workers > 0 {
+			require.NoError(t, queue.Shutdown(ctx))
+		}
+	})
+
+	return queue
+}
+
+func TestWebhookQueue_runsJobs(t *testing.T) {
+	t.Parallel()
+
+	queue := newWebhookQueue(10)
+	queue.Start(t.Context(), 2)
+
+	var ran atomic.Int32
+
+	for range 10 {
+		require.True(t, queue.Enqueue(t.Context(), func(ctx context.Context) error {
+			ran.Add(1)
+
+			return nil
+		}))
+	}
+
+	require.NoError(t, queue.Shutdown(t.Context()))
+	require.Equal(t, int32(10), ran.Load(), "shutdown must wait for queued jobs to finish")
+}
+
+func TestWebhookQueue_rejectsWhenFull(t *testing.T) {
+	t.Parallel()
+
+	// No workers, so nothing ever leaves the queue
+	queue := newWebhookQueue(2)
+
+	noop := func(context.Context) error { return nil }
+
+	require.True(t, queue.Enqueue(t.Context(), noop))
+	require.True(t, queue.Enqueue(t.Context(), noop))
+	require.False(t, queue.Enqueue(t.Context(), noop))
+	require.Equal(t, 2, queue.Len())
+}
+
+func TestWebhookQueue_rejectsAfterShutdown(t *testing.T) {
+	t.Parallel()
+
+	queue := newWebhookQueue(1)
+	queue.Start(t.Context(), 1)
+
+	require.NoError(t, queue.Shutdown(t.Context()))
+	require.False(t, queue.Enqueue(t.Context(), func(context.Context) error { return nil }))
+}
+
+// The job runs after the response has been written, which cancels the request
+// context; the job must still see the values stored on it.
+func TestWebhookQueue_jobOutlivesRequestContext(t *testing.T) {
+	t.Parallel()
+
+	queue := newWebhookQueue(1)
+
+	requestCtx, cancel := context.WithCancel(state.WithProjectID(t.Context(), "jippi/scm-engine"))
+
+	result := make(chan error, 1)
+
+	require.True(t, queue.Enqueue(requestCtx, func(ctx context.Context) error {
+		switch {
+		case ctx.Err() != nil:
+			result <- ctx.Err()
+
+		case state.ProjectID(ctx) != "jippi/scm-engine":
+			result <- errors.New("project ID is missing from the job context")
+
+		default:
+			result <- nil
+		}
+
+		return nil
+	}))
+
+	// The request is done before any worker picks up the job
+	cancel()
+	queue.Start(t.Context(), 1)
+
+	require.NoError(t, <-result)
+	require.NoError(t, queue.Shutdown(t.Context()))
+}
+
+func TestWebhookQueue_survivesPanickingJobs(t *testing.T) {
+	t.Parallel()
+
+	queue := newWebhookQueue(2)
+	queue.Start(t.Context(), 1)
+
+	var ran atomic.Bool
+
+	require.True(t, queue.Enqueue(t.Context(), func(context.Context) error { panic("boom") }))
+	require.True(t, queue.Enqueue(t.Context(), func(context.Context) error {
+		ran.Store(true)
+
+		return nil
+	}))
+
+	require.NoError(t, queue.Shutdown(t.Context()))
+	require.True(t, ran.Load(), "the worker must keep going after a job panics")
+}
+
+func TestWebhookQueue_shutdownTimesOut(t *testing.T) {
+	t.Parallel()
+
+	queue := newWebhookQueue(1)
+	queue.Start(t.Context(), 1)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	require.True(t, queue.Enqueue(t.Context(), func(context.Context) error {
+		<-release
+
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, queue.Shutdown(ctx), context.DeadlineExceeded)
+}
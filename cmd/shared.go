@@ -6,22 +6,29 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"time"
 
 	"github.com/jippi/scm-engine/pkg/config"
 	"github.com/jippi/scm-engine/pkg/integration/backstage"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/scm/github"
 	"github.com/jippi/scm-engine/pkg/scm/gitlab"
 	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	"github.com/teris-io/shortid"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var sid = shortid.MustNew(1, shortid.DefaultABC, 2342)
 
+// includeHTTPClient reads 'remote' includes
+var includeHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
 func getClient(ctx context.Context) (scm.Client, error) {
 	backstageClient, err := backstage.NewClient(ctx, state.BackstageURL(ctx), state.BackstageToken(ctx), nil)
 	if err != nil {
@@ -30,7 +37,7 @@ func getClient(ctx context.Context) (scm.Client, error) {
 
 	switch state.Provider(ctx) {
 	case "github":
-		return github.NewClient(ctx), nil
+		return github.NewClient(ctx, backstageClient)
 
 	case "gitlab":
 		return gitlab.NewClient(ctx, backstageClient)
@@ -44,16 +51,46 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 	// Track start time of the evaluation
 	ctx = state.WithStartTime(ctx, time.Now())
 
+	// Use the same version of the global configuration for the whole evaluation, even when it's reloaded meanwhile
+	ctx = config.WithGlobalConfigSnapshot(ctx)
+
+	defer func() {
+		metrics.EvaluationDuration.WithLabelValues(state.Provider(ctx), metrics.Outcome(err)).Observe(time.Since(state.StartTime(ctx)).Seconds())
+	}()
+
 	// Attach unique eval id to the logs so they are easy to filter on later
 	ctx = state.WithEvaluationID(ctx, sid.MustGenerate())
 
+	// Make the evaluation visible in the admin API while it's in-flight
+	defer inFlightEvaluations.Start(ctx)()
+
+	// Record what the evaluation decided and did in the evaluation history, when enabled
+	ctx = withEvaluationRecord(ctx)
+	defer func() { saveEvaluationRecord(ctx, err) }()
+
+	// Trace the evaluation, with a child span per phase
+	ctx, span := tracing.Start(ctx, "ProcessMR",
+		attribute.String("scm.provider", state.Provider(ctx)),
+		attribute.String("scm.project_id", state.ProjectID(ctx)),
+		attribute.String("scm.merge_request_id", state.MergeRequestID(ctx)),
+		attribute.String("scm.commit_sha", state.CommitSHA(ctx)),
+		attribute.String("scm_engine.eval_id", state.EvaluationID(ctx)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	// Track where we grab the configuration file from
 	ctx = slogctx.With(ctx, slog.String("config_source_branch", "merge_request_branch"))
 
 	// Should we allow failing the CI pipeline?
 	allowPipelineFailure := false
 
-	defer state.LockForProcessing(ctx)()
+	unlock, err := state.LockForProcessing(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inFlightEvaluations.Locked(ctx)
 
 	// Stop the pipeline when we leave this func
 	defer func() {
@@ -73,7 +110,7 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 
 	slogctx.Info(ctx, "Creating evaluation context")
 
-	evalContext, err := client.EvalContext(ctx)
+	evalContext, err := fetchEvalContext(ctx, client)
 	if err != nil {
 		return err
 	}
@@ -106,19 +143,13 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 		ctx = slogctx.With(ctx, slog.String("config_source_branch", configSourceRef))
 	}
 
+	recordConfigSource(ctx, configSourceRef)
+
 	// Download and parse the configuration file if necessary
 	if configShouldBeDownloaded {
-		slogctx.Debug(ctx, "Downloading scm-engine configuration from ref: "+configSourceRef)
-
-		file, err := client.MergeRequests().GetRemoteConfig(ctx, state.ConfigFilePath(ctx), configSourceRef)
+		cfg, err = downloadConfig(ctx, client, configSourceRef, cfg)
 		if err != nil {
-			slogctx.Warn(ctx, "Could not read remote config file", slog.Any("error", err))
-		} else {
-			// Parse the file
-			cfg, err = config.ParseFile(file)
-			if err != nil { // error on parsing failures when present
-				return fmt.Errorf("could not parse config file: %w", err)
-			}
+			return err
 		}
 	}
 
@@ -134,20 +165,30 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 	}
 
 	// Load any remote configuration files
-	if err := cfg.LoadIncludes(ctx, client); err != nil {
-		return fmt.Errorf("failed to load 'include' settings: %w", err)
+	if err := loadIncludes(ctx, client, cfg); err != nil {
+		return err
 	}
 
+	logMergeChanges(ctx, cfg)
+
 	// Allow changing the 'dry-run' mode via configuration file
-	if cfg.DryRun != nil && *cfg.DryRun != state.IsDryRun(ctx) {
+	if cfg.DryRun != nil && *cfg.DryRun != state.IsDryRun(ctx) && !state.IsDryRunForced(ctx) {
 		slogctx.Info(ctx, "Configuration file has a 'dry_run' value, using that in favor of server default")
 
 		ctx = state.WithDryRun(ctx, *cfg.DryRun)
 	}
 
-	// Lint the configuration file to catch any misconfigurations
-	if err := cfg.Lint(ctx, evalContext); err != nil {
-		return fmt.Errorf("Configuration failed validation: %w", err)
+	// Compile the definitions once, for the scripts of the labels, actions and their steps
+	definitions, err := cfg.CompileDefinitions(evalContext)
+	if err != nil {
+		return permanentError{fmt.Errorf("Configuration failed validation: %w", err)}
+	}
+
+	ctx = config.WithDefinitions(ctx, definitions)
+
+	// Lint the configuration file to catch any misconfigurations; the configuration does not change by retrying
+	if err := lintConfig(ctx, cfg, evalContext); err != nil {
+		return permanentError{err}
 	}
 
 	// Write the config to context so we can pull it out later
@@ -170,6 +211,8 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 
 	slogctx.Debug(ctx, "Evaluation complete", slog.Int("number_of_labels", len(labels)), slog.Int("number_of_actions", len(actions)))
 
+	recordEvaluationResult(ctx, labels, actions)
+
 	//
 	// Post-evaluation sync of labels
 	//
@@ -211,8 +254,10 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 
 	slogctx.Info(ctx, "Applying actions")
 
+	// Actions like 'comment' call the API as soon as they run, so once they started, retrying the
+	// evaluation would apply them again
 	if err := runActions(ctx, evalContext, client, update, actions); err != nil {
-		return err
+		return permanentError{err}
 	}
 
 	//
@@ -221,10 +266,137 @@ func ProcessMR(ctx context.Context, client scm.Client, cfg *config.Config, event
 
 	slogctx.Info(ctx, "Updating Merge Request")
 
-	return updateMergeRequest(ctx, client, update)
+	recordEvaluationUpdate(ctx, update)
+
+	// The actions already ran, so the update is not retried either
+	if err := updateMergeRequest(ctx, client, update); err != nil {
+		return permanentError{err}
+	}
+
+	return nil
+}
+
+// fetchEvalContext reads the Merge Request and everything scripts can access about it
+func fetchEvalContext(ctx context.Context, client scm.Client) (evalContext scm.EvalContext, err error) {
+	ctx, span := tracing.Start(ctx, "EvalContext")
+	defer func() { tracing.End(span, err) }()
+
+	return client.EvalContext(ctx)
+}
+
+// downloadConfig reads and parses the configuration file from the repository at ref,
+// keeping cfg when it could not be read
+func downloadConfig(ctx context.Context, client scm.Client, ref string, cfg *config.Config) (_ *config.Config, err error) {
+	ctx, span := tracing.Start(ctx, "DownloadConfig", attribute.String("scm.ref", ref))
+	defer func() { tracing.End(span, err) }()
+
+	slogctx.Debug(ctx, "Downloading scm-engine configuration from ref: "+ref)
+
+	file, err := client.MergeRequests().GetRemoteConfig(ctx, state.ConfigFilePath(ctx), ref)
+	if err != nil {
+		slogctx.Warn(ctx, "Could not read remote config file", slog.Any("error", err))
+
+		return cfg, nil
+	}
+
+	// Parse the file
+	cfg, err = config.ParseFile(file)
+	if err != nil { // error on parsing failures when present
+		return nil, permanentError{fmt.Errorf("could not parse config file: %w", err)}
+	}
+
+	return cfg, nil
+}
+
+func loadIncludes(ctx context.Context, client scm.Client, cfg *config.Config) (err error) {
+	ctx, span := tracing.Start(ctx, "LoadIncludes", attribute.Int("scm_engine.includes", len(cfg.Includes)))
+	defer func() { tracing.End(span, err) }()
+
+	options := config.IncludeOptions{
+		Client:     client,
+		HTTPClient: includeHTTPClient,
+		MaxDepth:   state.IncludeMaxDepth(ctx),
+	}
+
+	// The configuration of a repository evaluated by the server may only include URLs in the allowlist of the
+	// global configuration, while the includes of the global configuration itself are trusted
+	if state.Trigger(ctx) != "cli" {
+		globalConfig := config.GlobalConfigFromContext(ctx)
+
+		options.Trusted = func(include config.Include) bool {
+			return globalConfig != nil && globalConfig.HasInclude(include)
+		}
+	}
+
+	if err := cfg.LoadIncludes(ctx, options); err != nil {
+		return fmt.Errorf("failed to load 'include' settings: %w", err)
+	}
+
+	return nil
+}
+
+// loadConfigFile reads and parses the configuration file at path, and loads its 'local' includes.
+//
+// Other includes are kept for the evaluation, unless httpClient is set, in which case 'remote' includes are loaded as well.
+func loadConfigFile(ctx context.Context, path string, httpClient *http.Client) (*config.Config, error) {
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadLocalIncludes(ctx, cfg, path, httpClient); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
-func updateMergeRequest(ctx context.Context, client scm.Client, update *scm.UpdateMergeRequestOptions) error {
+// loadLocalIncludes loads the 'local' includes of cfg, which was read from the file at path
+func loadLocalIncludes(ctx context.Context, cfg *config.Config, path string, httpClient *http.Client) error {
+	options := config.IncludeOptions{
+		HTTPClient: httpClient,
+		LocalDir:   filepath.Dir(path),
+		MaxDepth:   state.IncludeMaxDepth(ctx),
+	}
+
+	if err := cfg.LoadIncludes(ctx, options); err != nil {
+		return fmt.Errorf("failed to load 'include' settings of [%s]: %w", path, err)
+	}
+
+	return nil
+}
+
+// logMergeChanges logs the inherited and included labels and actions that were overridden or disabled,
+// and warns about those that could not be changed since they are locked
+func logMergeChanges(ctx context.Context, cfg *config.Config) {
+	for _, change := range cfg.MergeChanges {
+		ctx := slogctx.With(ctx, slog.String("kind", change.Kind), slog.String("name", change.Name))
+
+		switch change.Change {
+		case config.MergeLocked:
+			slogctx.Warn(ctx, fmt.Sprintf("The %s %q is locked, ignoring the configuration overriding or disabling it", change.Kind, change.Name))
+
+		default:
+			slogctx.Info(ctx, fmt.Sprintf("The %s %q was %s", change.Kind, change.Name, change.Change))
+		}
+	}
+}
+
+func lintConfig(ctx context.Context, cfg *config.Config, evalContext scm.EvalContext) (err error) {
+	ctx, span := tracing.Start(ctx, "Lint")
+	defer func() { tracing.End(span, err) }()
+
+	if err := cfg.Lint(ctx, evalContext); err != nil {
+		return fmt.Errorf("Configuration failed validation: %w", err)
+	}
+
+	return nil
+}
+
+func updateMergeRequest(ctx context.Context, client scm.Client, update *scm.UpdateMergeRequestOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "UpdateMergeRequest")
+	defer func() { tracing.End(span, err) }()
+
 	if update == nil || reflect.DeepEqual(update, &scm.UpdateMergeRequestOptions{}) {
 		slogctx.Info(ctx, "No changes to apply to Merge Request")
 
@@ -239,7 +411,7 @@ func updateMergeRequest(ctx context.Context, client scm.Client, update *scm.Upda
 
 	slogctx.Debug(ctx, "Applying Merge Request changes", slog.Any("changes", update))
 
-	_, err := client.MergeRequests().Update(ctx, update)
+	_, err = client.MergeRequests().Update(ctx, update)
 
 	return err
 }
@@ -263,19 +435,48 @@ func runActions(ctx context.Context, evalContext scm.EvalContext, client scm.Cli
 
 		evalContext.TrackActionGroupExecution(action.Group)
 
-		for _, task := range action.Then {
-			if err := client.ApplyStep(ctx, evalContext, update, task); err != nil {
-				slogctx.Error(ctx, "failed to apply action step", slog.Any("error", err))
+		err := applyAction(ctx, evalContext, client, update, action)
+		metrics.Actions.WithLabelValues(action.Name, metrics.Outcome(err)).Inc()
+		recordExecutedAction(ctx, action, err)
 
-				return err
-			}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyAction applies the steps of an action, stopping at the first one failing
+func applyAction(ctx context.Context, evalContext scm.EvalContext, client scm.Client, update *scm.UpdateMergeRequestOptions, action config.Action) error {
+	for _, task := range action.Then {
+		if err := applyStep(ctx, evalContext, client, update, action, task); err != nil {
+			slogctx.Error(ctx, "failed to apply action step", slog.Any("error", err))
+
+			return err
 		}
 	}
 
 	return nil
 }
 
-func syncLabels(ctx context.Context, client scm.Client, required []scm.EvaluationResult) error {
+func applyStep(ctx context.Context, evalContext scm.EvalContext, client scm.Client, update *scm.UpdateMergeRequestOptions, action config.Action, step scm.ActionStep) (err error) {
+	// An invalid step fails in ApplyStep, where the error is recorded
+	stepName, _ := step.OptionalString("action", "")
+
+	ctx, span := tracing.Start(ctx, "ApplyStep",
+		attribute.String("scm_engine.action", action.Name),
+		attribute.String("scm_engine.step", stepName),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	return client.ApplyStep(ctx, evalContext, update, step)
+}
+
+func syncLabels(ctx context.Context, client scm.Client, required []scm.EvaluationResult) (err error) {
+	ctx, span := tracing.Start(ctx, "syncLabels", attribute.Int("scm_engine.labels", len(required)))
+	defer func() { tracing.End(span, err) }()
+
 	slogctx.Info(ctx, "Going to sync required labels", slog.Int("number_of_labels", len(required)))
 
 	remote, err := client.Labels().List(ctx)
@@ -316,6 +517,8 @@ func syncLabels(ctx context.Context, client scm.Client, required []scm.Evaluatio
 
 			return err
 		}
+
+		metrics.Labels.WithLabelValues("created").Inc()
 	}
 
 	// Update
@@ -344,6 +547,8 @@ func syncLabels(ctx context.Context, client scm.Client, required []scm.Evaluatio
 		if err != nil {
 			return err
 		}
+
+		metrics.Labels.WithLabelValues("updated").Inc()
 	}
 
 	return nil
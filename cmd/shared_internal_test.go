@@ -6,12 +6,20 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/jippi/scm-engine/pkg/config"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // fakeLabelClient records every write so a test can assert on exactly which
@@ -57,6 +65,8 @@ func (c *fakeLabelClient) Update(_ context.Context, opt *scm.UpdateLabelOptions)
 type fakeMergeRequestClient struct {
 	updates   []*scm.UpdateMergeRequestOptions
 	updateErr error
+
+	remoteConfig string // the configuration file of the repository, when not empty
 }
 
 func (c *fakeMergeRequestClient) Update(_ context.Context, opt *scm.UpdateMergeRequestOptions) (*scm.Response, error) {
@@ -70,6 +80,10 @@ func (c *fakeMergeRequestClient) List(context.Context, *scm.ListMergeRequestsOpt
 }
 
 func (c *fakeMergeRequestClient) GetRemoteConfig(context.Context, string, string) (io.Reader, error) {
+	if len(c.remoteConfig) > 0 {
+		return strings.NewReader(c.remoteConfig), nil
+	}
+
 	return nil, errNotImplemented
 }
 
@@ -113,6 +127,11 @@ func (c *fakeClient) GetProjectFiles(context.Context, string, *string, []string)
 	return nil, errNotImplemented
 }
 
+func (c *fakeClient) IsSignedTag(context.Context, string, string) (bool, error) {
+	return false, errNotImplemented
+}
+
+func (c *fakeClient) Ping(context.Context) error              { return nil }
 func (c *fakeClient) Start(context.Context) error             { return nil }
 func (c *fakeClient) Stop(context.Context, error, bool) error { return nil }
 
@@ -143,6 +162,20 @@ func (c *evalContextStub) HasExecutedActionGroup(name string) bool {
 	return c.groups[name]
 }
 
+// A configuration file that can't be parsed does not change by retrying the evaluation
+func TestDownloadConfig_parseErrorIsPermanent(t *testing.T) {
+	t.Parallel()
+
+	client := newFakeClient()
+	client.mergeRequests.remoteConfig = "label: [\n"
+
+	ctx := state.WithConfigFilePath(t.Context(), ".scm-engine.yml")
+
+	_, err := downloadConfig(ctx, client, "HEAD", nil)
+	require.ErrorContains(t, err, "could not parse config file")
+	require.False(t, isRetryable(err))
+}
+
 // An empty update must never be sent: GitLab returns an error for a PUT with no
 // changes, and it burns an API call on every evaluation that changes nothing.
 func TestUpdateMergeRequest_skipsEmptyUpdates(t *testing.T) {
@@ -407,3 +440,70 @@ func TestSyncLabels_propagatesUpdateError(t *testing.T) {
 
 	require.ErrorContains(t, syncLabels(ctx, client, []scm.EvaluationResult{{Name: "bug", Description: "new"}}), "cannot update")
 }
+
+var (
+	spanRecorder        = tracetest.NewSpanRecorder()
+	installSpanRecorder sync.Once
+)
+
+// startTestTrace runs the test within a trace, and returns a function ending it and
+// returning the spans recorded within it, in the order they ended
+func startTestTrace(t *testing.T) (context.Context, func() []sdktrace.ReadOnlySpan) {
+	t.Helper()
+
+	installSpanRecorder.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+
+	ctx, root := tracing.Start(t.Context(), t.Name())
+
+	return ctx, func() []sdktrace.ReadOnlySpan {
+		root.End()
+
+		var spans []sdktrace.ReadOnlySpan
+
+		for _, span := range spanRecorder.Ended() {
+			if span.SpanContext().TraceID() == root.SpanContext().TraceID() && span.SpanContext().SpanID() != root.SpanContext().SpanID() {
+				spans = append(spans, span)
+			}
+		}
+
+		return spans
+	}
+}
+
+func TestRunActions_tracesEveryStep(t *testing.T) {
+	t.Parallel()
+
+	ctx, ended := startTestTrace(t)
+
+	client := newFakeClient()
+	client.applyErr = errors.New("cannot close")
+
+	actions := config.Actions{{Name: "close stale", Then: []config.ActionStep{{"action": "close"}, {"action": "comment"}}}}
+
+	require.Error(t, runActions(ctx, newEvalContextStub(), client, &scm.UpdateMergeRequestOptions{}, actions))
+
+	spans := ended()
+	require.Len(t, spans, 1, "the failing step stops the action")
+	require.Equal(t, "ApplyStep", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.String("scm_engine.action", "close stale"))
+	require.Contains(t, spans[0].Attributes(), attribute.String("scm_engine.step", "close"))
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, "cannot close", spans[0].Status().Description)
+}
+
+func TestSyncLabels_traced(t *testing.T) {
+	t.Parallel()
+
+	ctx, ended := startTestTrace(t)
+	ctx = state.WithDryRun(state.WithProvider(ctx, "gitlab"), false)
+
+	require.NoError(t, syncLabels(ctx, newFakeClient(), []scm.EvaluationResult{{Name: "bug"}}))
+
+	spans := ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "syncLabels", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.Int("scm_engine.labels", 1))
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+}
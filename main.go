@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/jippi/scm-engine/cmd"
 	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	"github.com/jippi/scm-engine/pkg/tui"
 	"github.com/urfave/cli/v2"
 	slogctx "github.com/veqryn/slog-context"
@@ -28,6 +30,9 @@ var (
 func main() {
 	spew.Config.DisableMethods = true
 
+	// Replaced when tracing is enabled
+	shutdownTracing := func(context.Context) error { return nil }
+
 	app := &cli.App{
 		Name:                 "scm-engine",
 		Usage:                "GitHub/GitLab automation",
@@ -50,8 +55,23 @@ func main() {
 			cCtx.Context = state.WithDryRun(cCtx.Context, cCtx.Bool(cmd.FlagDryRun))
 			cCtx.Context = state.WithRandomSeed(cCtx.Context, time.Now().UnixNano()) // weak seed since only used for codeowner selection
 
+			// Setup (optional) tracing
+			shutdown, err := tracing.Setup(cCtx.Context, cCtx.String(cmd.FlagOTelEndpoint), version)
+			if err != nil {
+				return err
+			}
+
+			shutdownTracing = shutdown
+
 			return nil
 		},
+		After: func(cCtx *cli.Context) error {
+			// Flush the spans of the evaluations that just completed
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(cCtx.Context), 5*time.Second)
+			defer cancel()
+
+			return shutdownTracing(ctx)
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:      cmd.FlagConfigFile,
@@ -70,6 +90,14 @@ func main() {
 					"SCM_ENGINE_DRY_RUN",
 				},
 			},
+			&cli.StringFlag{
+				Name:  cmd.FlagOTelEndpoint,
+				Usage: "Base URL of an OTLP/HTTP collector to export traces to (example: 'http://localhost:4318'); tracing is disabled when empty",
+				EnvVars: []string{
+					"SCM_ENGINE_OTEL_ENDPOINT",
+					"OTEL_EXPORTER_OTLP_ENDPOINT", // OpenTelemetry standard
+				},
+			},
 		},
 		Commands: []*cli.Command{
 			cmd.GitLab,
@@ -9,7 +9,9 @@ import (
 	"github.com/expr-lang/expr/vm"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/stdlib"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type (
@@ -36,19 +38,38 @@ type (
 		//
 		// See: https://jippi.github.io/scm-engine/configuration/#actions.if.then
 		Then []ActionStep `json:"then" yaml:"then"`
+
+		// (Optional) Remove the action with the same name inherited from the global configuration.
+		//
+		// See: https://jippi.github.io/scm-engine/configuration/#actions.disabled
+		Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+		// (Optional) Prevent repository configuration files from overriding or disabling the action. Only used from the global configuration file.
+		//
+		// See: https://jippi.github.io/scm-engine/configuration/#actions.locked
+		Locked bool `json:"locked,omitempty" yaml:"locked,omitempty"`
 	}
 )
 
-func (actions Actions) Evaluate(ctx context.Context, evalContext scm.EvalContext) ([]Action, error) {
+// Evaluate evaluates the actions, where options are added to the expr-lang options every script is compiled with,
+// like the compiled [Definitions] of the configuration
+func (actions Actions) Evaluate(ctx context.Context, evalContext scm.EvalContext, options ...expr.Option) ([]Action, error) {
 	results := []Action{}
 
 	// Evaluate actions
 	for _, action := range actions {
+		if action.Disabled {
+			continue
+		}
+
 		ctx := slogctx.With(ctx, slog.String("action_name", action.Name))
 
 		slogctx.Debug(ctx, "Evaluating action")
 
-		ok, err := action.Evaluate(ctx, evalContext)
+		ctx, span := tracing.Start(ctx, "EvaluateAction", attribute.String("scm_engine.action", action.Name))
+		ok, err := action.Evaluate(ctx, evalContext, options...)
+		tracing.End(span, err)
+
 		if err != nil {
 			return nil, err
 		}
@@ -67,8 +88,8 @@ func (actions Actions) Evaluate(ctx context.Context, evalContext scm.EvalContext
 	return results, nil
 }
 
-func (p *Action) Evaluate(ctx context.Context, evalContext scm.EvalContext) (bool, error) {
-	program, err := p.Setup(evalContext)
+func (p *Action) Evaluate(ctx context.Context, evalContext scm.EvalContext, options ...expr.Option) (bool, error) {
+	program, err := p.Setup(evalContext, options...)
 	if err != nil {
 		return false, err
 	}
@@ -77,10 +98,11 @@ func (p *Action) Evaluate(ctx context.Context, evalContext scm.EvalContext) (boo
 	return runAndCheckBool(ctx, program, evalContext)
 }
 
-func (p *Action) Setup(evalContext scm.EvalContext) (*vm.Program, error) {
-	opts := make([]expr.Option, 0, len(stdlib.Functions)+4)
+func (p *Action) Setup(evalContext scm.EvalContext, options ...expr.Option) (*vm.Program, error) {
+	opts := make([]expr.Option, 0, len(stdlib.Functions)+len(options)+4)
 	opts = append(opts, expr.AsBool(), expr.Env(evalContext), stdlib.FunctionRenamer)
 	opts = append(opts, stdlib.Functions...)
+	opts = append(opts, options...)
 	opts = append(opts, expr.Patch(patcher.WithContext{Name: "ctx"}))
 
 	return expr.Compile(p.If, opts...)
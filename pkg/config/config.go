@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/jippi/scm-engine/pkg/scm"
@@ -19,6 +21,11 @@ type Config struct {
 	// See: https://jippi.github.io/scm-engine/configuration/#include
 	Includes []Include `json:"include,omitempty" yaml:"include"`
 
+	// (Optional) Restrict what may be included, and require includes to be pinned. Only used from the global configuration file.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy
+	IncludePolicy *IncludePolicy `json:"include_policy,omitempty" yaml:"include_policy"`
+
 	// (Optional) Configure what users that should be ignored when considering activity on a Merge Request
 	//
 	// SCM-Engine defines activity as comments, reviews, commits, adding/removing labels and similar actions made on a change request.
@@ -26,6 +33,11 @@ type Config struct {
 	// See: https://jippi.github.io/scm-engine/configuration/#ignore_activity_from
 	IgnoreActivityFrom IgnoreActivityFrom `json:"ignore_activity_from,omitempty" yaml:"ignore_activity_from"`
 
+	// (Optional) Named expr-lang scripts, which every other script can use by name, either as a value or as a function
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#definitions
+	Definitions map[string]string `json:"definitions,omitempty" yaml:"definitions"`
+
 	// (Optional) Actions can modify a Merge Request in various ways, for example, adding a comment or closing the Merge Request.
 	//
 	// See: https://jippi.github.io/scm-engine/configuration/#actions
@@ -35,19 +47,53 @@ type Config struct {
 	//
 	// See: https://jippi.github.io/scm-engine/configuration/#label
 	Labels Labels `json:"label,omitempty" yaml:"label"`
+
+	// How the labels, actions and definitions inherited from the global configuration were changed by [Config.Merge],
+	// and by the includes loaded after it
+	MergeChanges []MergeChange `json:"-" yaml:"-"`
 }
 
-func (c Config) Lint(_ context.Context, evalContext scm.EvalContext) error {
+func (c Config) Lint(ctx context.Context, evalContext scm.EvalContext) error {
 	var errors error
 
+	definitions, err := c.definitions(ctx, evalContext)
+	if err != nil {
+		// Scripts using the definitions can't compile without them
+		return err
+	}
+
+	if c.IncludePolicy != nil {
+		if err := c.IncludePolicy.Validate(); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	for _, change := range c.MergeChanges {
+		if change.Kind == "definition" && change.Change == MergeLocked {
+			errors = multierror.Append(errors, fmt.Errorf("Definition %q may not replace the definition with the same name in the global configuration or an included file", change.Name))
+		}
+	}
+
+	for _, err := range c.lintShadowedDefinitions() {
+		errors = multierror.Append(errors, err)
+	}
+
 	for _, action := range c.Actions {
-		if _, err := action.Setup(evalContext); err != nil {
+		if action.Disabled {
+			continue
+		}
+
+		if _, err := action.Setup(evalContext, definitions...); err != nil {
 			errors = multierror.Append(errors, fmt.Errorf("Action %q failed validation: %w", action.Name, err))
 		}
 	}
 
 	for _, label := range c.Labels {
-		if err := label.Setup(evalContext); err != nil {
+		if label.Disabled {
+			continue
+		}
+
+		if err := label.Setup(evalContext, definitions...); err != nil {
 			errors = multierror.Append(errors, fmt.Errorf("Label %q failed validation: %w", label.Name, err))
 		}
 	}
@@ -55,17 +101,53 @@ func (c Config) Lint(_ context.Context, evalContext scm.EvalContext) error {
 	return errors
 }
 
+// lintShadowedDefinitions reports the scripts of labels and actions declaring a variable with 'let' that has the name
+// of a definition; definitions themselves are checked by [Config.CompileDefinitions]
+func (c Config) lintShadowedDefinitions() []error {
+	if len(c.Definitions) == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	report := func(kind, name, script string) {
+		for _, variable := range shadowedDefinitions(script, c.Definitions) {
+			errs = append(errs, fmt.Errorf("%s %q may not declare variable %q with 'let', since a definition has the same name", kind, name, variable))
+		}
+	}
+
+	for _, action := range c.Actions {
+		if !action.Disabled {
+			report("Action", action.Name, action.If)
+		}
+	}
+
+	for _, label := range c.Labels {
+		if !label.Disabled {
+			report("Label", label.Name, label.Script)
+			report("Label", label.Name, label.SkipIf)
+		}
+	}
+
+	return errs
+}
+
 func (c Config) Evaluate(ctx context.Context, evalContext scm.EvalContext) ([]scm.EvaluationResult, []Action, error) {
+	definitions, err := c.definitions(ctx, evalContext)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	slogctx.Info(ctx, "Evaluating labels")
 
-	labels, err := c.Labels.Evaluate(ctx, evalContext)
+	labels, err := c.Labels.Evaluate(ctx, evalContext, definitions...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("evaluation failed: %w", err)
 	}
 
 	slogctx.Info(ctx, "Evaluating Actions")
 
-	actions, err := c.Actions.Evaluate(ctx, evalContext)
+	actions, err := c.Actions.Evaluate(ctx, evalContext, definitions...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -73,64 +155,111 @@ func (c Config) Evaluate(ctx context.Context, evalContext scm.EvalContext) ([]sc
 	return labels, actions, nil
 }
 
-func (c *Config) LoadIncludes(ctx context.Context, client scm.Client) error {
+// definitions returns the definitions stored in ctx by [WithDefinitions], or compiles them when there are none
+func (c Config) definitions(ctx context.Context, evalContext scm.EvalContext) (Definitions, error) {
+	if definitions := DefinitionsFromContext(ctx); definitions != nil {
+		return definitions, nil
+	}
+
+	return c.CompileDefinitions(evalContext)
+}
+
+// LoadIncludes reads the configuration files from the 'include' settings, and any 'include' settings within
+// those, up to the configured depth.
+//
+// The actions and labels of included files are appended in a deterministic order: every file in the order it
+// was listed, followed by the files it includes. A file that is included more than once is only loaded the
+// first time, while a file including itself, directly or not, is an error. Actions and labels with the
+// same name as one already in the config are not appended, unless they are locked, see [includeEntries].
+// Definitions are never replaced, and a different definition with the same name fails [Config.Lint].
+//
+// Afterwards, the 'include' settings only contain the includes that could not be loaded with the options,
+// so they can be loaded later; for example the 'project' includes of a configuration file read from disk.
+func (c *Config) LoadIncludes(ctx context.Context, options IncludeOptions) error {
 	// No files to include
 	if len(c.Includes) == 0 {
 		return nil
 	}
 
+	if options.MaxDepth <= 0 {
+		options.MaxDepth = DefaultIncludeMaxDepth
+	}
+
 	// Update logger with a friendly tag to differentiate the events within
 	ctx = slogctx.With(ctx, slog.String("phase", "remote_include"))
 
-	// For each project, do a read of all the files we need
-	for _, include := range c.Includes {
-		ctx := slogctx.With(ctx, slog.Any("remote_include_config", include))
+	if c.IncludePolicy != nil {
+		if err := c.IncludePolicy.Validate(); err != nil {
+			return err
+		}
+	}
 
-		slogctx.Debug(ctx, fmt.Sprintf("Loading remote configuration from project %q", include.Project))
+	resolver := &includeResolver{
+		options: options,
+		policy:  c.IncludePolicy,
+		visited: make(map[string]bool),
+	}
 
-		files, err := client.GetProjectFiles(ctx, include.Project, include.Ref, include.Files)
-		if err != nil {
-			return fmt.Errorf("failed to load included config files from project [%s]: %w", include.Project, err)
-		}
+	tree, err := resolver.resolve(ctx, c.Includes, nil, options.LocalDir, true)
+	if err != nil {
+		return err
+	}
 
-		for fileName, fileContent := range files {
-			remoteConfig, err := ParseFileString(fileContent)
-			if err != nil {
-				return fmt.Errorf("failed to parse remote config file [%s] from project [%s]: %w", fileName, include.Project, err)
-			}
+	for _, file := range resolver.files {
+		var changes []MergeChange
+
+		// Add definitions, unless the config, or a file included before, already has one with the same name.
+		//
+		// The included labels and actions may depend on the definitions of their file, including the locked
+		// ones, so a different definition with the same name is recorded for [Config.Lint] to reject
+		for _, name := range slices.Sorted(maps.Keys(file.config.Definitions)) {
+			definition, ok := c.Definitions[name]
+			if !ok {
+				if c.Definitions == nil {
+					c.Definitions = make(map[string]string, len(file.config.Definitions))
+				}
+
+				c.Definitions[name] = file.config.Definitions[name]
 
-			// Disallow nested includes
-			if len(remoteConfig.Includes) != 0 {
-				slogctx.Warn(ctx, fmt.Sprintf("file [%s] from project [%s] may not have any 'include' settings; Recursive include is not supported", fileName, include.Project))
+				continue
 			}
 
-			// Disallow changing dry run
-			if remoteConfig.DryRun != nil {
-				slogctx.Warn(ctx, fmt.Sprintf("file [%s] from project [%s] may not have a 'dry_run' setting; Remote include are not allowed to change this setting", fileName, include.Project))
+			if definition != file.config.Definitions[name] {
+				changes = append(changes, MergeChange{Kind: "definition", Name: name, Change: MergeLocked})
 			}
+		}
 
-			// Append actions
-			if len(remoteConfig.Actions) != 0 {
-				slogctx.Debug(ctx, fmt.Sprintf("file [%s] from project [%s] added %d new actions to the config file", fileName, include.Project, len(remoteConfig.Actions)))
+		c.MergeChanges = append(c.MergeChanges, changes...)
 
-				c.Actions = append(c.Actions, remoteConfig.Actions...)
-			}
+		// Merge actions, where the config takes precedence over the file, except for locked actions
+		if len(file.config.Actions) != 0 {
+			slogctx.Debug(ctx, fmt.Sprintf("file [%s] added %d actions to the config file", file.source, len(file.config.Actions)))
 
-			// Append labels
-			if len(remoteConfig.Labels) != 0 {
-				slogctx.Debug(ctx, fmt.Sprintf("file [%s] from project [%s] added %d new labels to the config file", fileName, include.Project, len(remoteConfig.Labels)))
+			c.Actions, changes = includeEntries("action", c.Actions, file.config.Actions)
+			c.MergeChanges = append(c.MergeChanges, changes...)
+		}
 
-				c.Labels = append(c.Labels, remoteConfig.Labels...)
-			}
+		// Merge labels, where the config takes precedence over the file, except for locked labels
+		if len(file.config.Labels) != 0 {
+			slogctx.Debug(ctx, fmt.Sprintf("file [%s] added %d labels to the config file", file.source, len(file.config.Labels)))
+
+			c.Labels, changes = includeEntries("label", c.Labels, file.config.Labels)
+			c.MergeChanges = append(c.MergeChanges, changes...)
 		}
 	}
 
-	slogctx.Debug(ctx, "Done loading remote configuration files")
+	c.Includes = resolver.deferred
+
+	slogctx.Debug(ctx, "Done loading remote configuration files", slog.Any("include_tree", tree), slog.Int("deferred_includes", len(c.Includes)))
 
 	return nil
 }
 
-// Merge merges the other config into the current config
+// Merge merges the other config into the current config.
+//
+// Labels and actions in the other config replace those with the same name in the current config,
+// or remove them when 'disabled', unless they are 'locked' in the current config. Definitions in the
+// other config may never replace those of the current config.
 func (c *Config) Merge(other *Config) *Config {
 	cfg := &Config{}
 
@@ -141,11 +270,17 @@ func (c *Config) Merge(other *Config) *Config {
 			Actions:            c.Actions,
 			Labels:             c.Labels,
 			Includes:           c.Includes,
+			IncludePolicy:      c.IncludePolicy,
+			Definitions:        maps.Clone(c.Definitions),
+			MergeChanges:       c.MergeChanges,
 		}
 	}
 
 	cfg.DryRun = other.DryRun
 
+	// The policy restricts what the other config may include, so it may not change it
+	cfg.IncludePolicy = c.IncludePolicy
+
 	cfg.IgnoreActivityFrom.IsBot = other.IgnoreActivityFrom.IsBot
 
 	if c.IgnoreActivityFrom.Usernames != nil || other.IgnoreActivityFrom.Usernames != nil {
@@ -160,19 +295,40 @@ func (c *Config) Merge(other *Config) *Config {
 		})
 	}
 
+	// Definitions in the other config may not replace those with the same name, since the labels
+	// and actions of the current config, including the locked ones, may depend on them
+	if c.Definitions != nil || other.Definitions != nil {
+		cfg.Definitions = make(map[string]string, len(c.Definitions)+len(other.Definitions))
+
+		maps.Copy(cfg.Definitions, c.Definitions)
+
+		for _, name := range slices.Sorted(maps.Keys(other.Definitions)) {
+			definition, ok := c.Definitions[name]
+			if !ok {
+				cfg.Definitions[name] = other.Definitions[name]
+
+				continue
+			}
+
+			if definition != other.Definitions[name] {
+				cfg.MergeChanges = append(cfg.MergeChanges, MergeChange{Kind: "definition", Name: name, Change: MergeLocked})
+			}
+		}
+	}
+
+	var changes []MergeChange
+
 	if c.Actions != nil || other.Actions != nil {
-		cfg.Actions = scm.MergeSlices(c.Actions, other.Actions, func(action Action) string {
-			return action.Name
-		})
+		cfg.Actions, changes = mergeEntries("action", c.Actions, other.Actions)
+		cfg.MergeChanges = append(cfg.MergeChanges, changes...)
 	}
 
 	if c.Labels != nil || other.Labels != nil {
-		cfg.Labels = scm.MergeSlices(c.Labels, other.Labels, func(label *Label) string {
-			return label.Name
-		})
+		cfg.Labels, changes = mergeEntries("label", c.Labels, other.Labels)
+		cfg.MergeChanges = append(cfg.MergeChanges, changes...)
 	}
 
-	// Merge includes, but skip adding duplicate files under a project/ref.
+	// Merge includes, but skip adding duplicate files under a project/ref, and duplicate local or remote files.
 	//
 	// Both the includes and the files within them keep first-seen order: the
 	// maps below are only used for de-duplication, never for iteration, since
@@ -185,13 +341,12 @@ func (c *Config) Merge(other *Config) *Config {
 
 		for _, includes := range [][]Include{c.Includes, other.Includes} {
 			for _, include := range includes {
-				mapKey := key(include.Project, include.Ref)
+				mapKey := key(include)
 
 				entry, ok := merge[mapKey]
 				if !ok {
 					entry = &mergedInclude{
-						project:   include.Project,
-						ref:       include.Ref,
+						include:   include,
 						seenFiles: make(map[string]struct{}, len(include.Files)),
 					}
 					merge[mapKey] = entry
@@ -214,32 +369,45 @@ func (c *Config) Merge(other *Config) *Config {
 		for _, mapKey := range order {
 			entry := merge[mapKey]
 
-			cfg.Includes = append(cfg.Includes, Include{
-				Project: entry.project,
-				Ref:     entry.ref,
-				Files:   entry.files,
-			})
+			include := entry.include
+			include.Files = entry.files
+
+			cfg.Includes = append(cfg.Includes, include)
 		}
 	}
 
 	return cfg
 }
 
-// mergedInclude accumulates the files seen for a single project/ref pair while
+// mergedInclude accumulates the files seen for a single include while
 // merging two configurations, keeping the files in the order they were seen.
 type mergedInclude struct {
-	project   string
-	ref       *string
+	include   Include // the first include seen, which the files are merged into
 	files     []string
 	seenFiles map[string]struct{}
 }
 
-func key(project string, ref *string) string {
+// HasInclude reports whether the config has an include of the same project and ref, local file or URL
+func (c *Config) HasInclude(include Include) bool {
+	return slices.ContainsFunc(c.Includes, func(other Include) bool {
+		return key(other) == key(include)
+	})
+}
+
+func key(include Include) string {
+	switch {
+	case len(include.Local) > 0:
+		return "local:" + include.Local
+
+	case len(include.Remote) > 0:
+		return "remote:" + include.Remote
+	}
+
 	strRef := ""
 
-	if ref != nil {
-		strRef = *ref
+	if include.Ref != nil {
+		strRef = *include.Ref
 	}
 
-	return fmt.Sprintf("%s:%s", project, strRef)
+	return fmt.Sprintf("project:%s:%s", include.Project, strRef)
 }
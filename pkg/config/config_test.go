@@ -71,7 +71,10 @@ func TestConfig_Merge(t *testing.T) {
 			other: &config.Config{
 				Actions: []config.Action{{Name: "action3"}, {Name: "action2"}},
 			},
-			want: &config.Config{Actions: []config.Action{{Name: "action1"}, {Name: "action2"}, {Name: "action3"}}},
+			want: &config.Config{
+				Actions:      []config.Action{{Name: "action1"}, {Name: "action2"}, {Name: "action3"}},
+				MergeChanges: []config.MergeChange{{Kind: "action", Name: "action2", Change: config.MergeOverridden}},
+			},
 		},
 		{
 			name: "merge labels",
@@ -79,7 +82,78 @@ func TestConfig_Merge(t *testing.T) {
 			other: &config.Config{
 				Labels: config.Labels{{Name: "label3"}, {Name: "label2"}},
 			},
-			want: &config.Config{Labels: config.Labels{{Name: "label1"}, {Name: "label2"}, {Name: "label3"}}},
+			want: &config.Config{
+				Labels:       config.Labels{{Name: "label1"}, {Name: "label2"}, {Name: "label3"}},
+				MergeChanges: []config.MergeChange{{Kind: "label", Name: "label2", Change: config.MergeOverridden}},
+			},
+		},
+		{
+			name: "other labels and actions replace those with the same name in place",
+			cfg: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "true"}, {Name: "action2", If: "true"}},
+				Labels:  config.Labels{{Name: "label1", Script: "true"}, {Name: "label2", Script: "true"}},
+			},
+			other: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "false"}},
+				Labels:  config.Labels{{Name: "label1", Script: "false"}},
+			},
+			want: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "false"}, {Name: "action2", If: "true"}},
+				Labels:  config.Labels{{Name: "label1", Script: "false"}, {Name: "label2", Script: "true"}},
+				MergeChanges: []config.MergeChange{
+					{Kind: "action", Name: "action1", Change: config.MergeOverridden},
+					{Kind: "label", Name: "label1", Change: config.MergeOverridden},
+				},
+			},
+		},
+		{
+			name: "disabled labels and actions are kept, to be skipped when evaluating",
+			cfg: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "true"}},
+				Labels:  config.Labels{{Name: "label1", Script: "true"}},
+			},
+			other: &config.Config{
+				Actions: []config.Action{{Name: "action1", Disabled: true}},
+				Labels:  config.Labels{{Name: "label1", Disabled: true}},
+			},
+			want: &config.Config{
+				Actions: []config.Action{{Name: "action1", Disabled: true}},
+				Labels:  config.Labels{{Name: "label1", Disabled: true}},
+				MergeChanges: []config.MergeChange{
+					{Kind: "action", Name: "action1", Change: config.MergeDisabled},
+					{Kind: "label", Name: "label1", Change: config.MergeDisabled},
+				},
+			},
+		},
+		{
+			name: "locked labels and actions can not be overridden or disabled",
+			cfg: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "true", Locked: true}},
+				Labels:  config.Labels{{Name: "label1", Script: "true", Locked: true}},
+			},
+			other: &config.Config{
+				Actions: []config.Action{{Name: "action1", Disabled: true}},
+				Labels:  config.Labels{{Name: "label1", Script: "false"}},
+			},
+			want: &config.Config{
+				Actions: []config.Action{{Name: "action1", If: "true", Locked: true}},
+				Labels:  config.Labels{{Name: "label1", Script: "true", Locked: true}},
+				MergeChanges: []config.MergeChange{
+					{Kind: "action", Name: "action1", Change: config.MergeLocked},
+					{Kind: "label", Name: "label1", Change: config.MergeLocked},
+				},
+			},
+		},
+		{
+			name: "generated labels have no name, and are always kept",
+			cfg:  &config.Config{Labels: config.Labels{{Strategy: config.GenerateLabels, Script: "['a']"}}},
+			other: &config.Config{
+				Labels: config.Labels{{Strategy: config.GenerateLabels, Script: "['b']"}},
+			},
+			want: &config.Config{Labels: config.Labels{
+				{Strategy: config.GenerateLabels, Script: "['a']"},
+				{Strategy: config.GenerateLabels, Script: "['b']"},
+			}},
 		},
 		{
 			name: "merge includes",
@@ -145,6 +219,25 @@ func TestConfig_Merge(t *testing.T) {
 				Includes: []config.Include{{Project: "project1", Files: []string{"file1"}}},
 			},
 		},
+		{
+			name: "local and remote includes are de-duplicated by path and URL",
+			cfg: &config.Config{Includes: []config.Include{
+				{Local: "base.yml"},
+				{Remote: "https://example.com/base.yml", Checksum: "sha256:abc"},
+			}},
+			other: &config.Config{Includes: []config.Include{
+				{Local: "base.yml"},
+				{Local: "team.yml"},
+				{Remote: "https://example.com/base.yml"},
+			}},
+			want: &config.Config{
+				Includes: []config.Include{
+					{Local: "base.yml"},
+					{Remote: "https://example.com/base.yml", Checksum: "sha256:abc"},
+					{Local: "team.yml"},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -9,6 +9,7 @@ type contextKey uint
 const (
 	configKey contextKey = iota
 	globalConfigKey
+	definitionsKey
 )
 
 func WithConfig(ctx context.Context, config *Config) context.Context {
@@ -19,10 +20,52 @@ func FromContext(ctx context.Context) *Config {
 	return ctx.Value(configKey).(*Config) //nolint:forcetypeassert
 }
 
+// GlobalConfigSource provides the global configuration, for when it can change while the process is running
+type GlobalConfigSource interface {
+	GlobalConfig() *Config
+}
+
 func WithGlobalConfig(ctx context.Context, config *Config) context.Context {
 	return context.WithValue(ctx, globalConfigKey, config)
 }
 
+// WithGlobalConfigSource makes [GlobalConfigFromContext] read the global configuration from source on every call
+func WithGlobalConfigSource(ctx context.Context, source GlobalConfigSource) context.Context {
+	return context.WithValue(ctx, globalConfigKey, source)
+}
+
+// WithGlobalConfigSnapshot keeps the global configuration [GlobalConfigFromContext] returns now for the rest of ctx,
+// so every later read returns the same version, even when a [GlobalConfigSource] changes it in the meantime
+func WithGlobalConfigSnapshot(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(globalConfigKey).(GlobalConfigSource); !ok {
+		return ctx
+	}
+
+	return WithGlobalConfig(ctx, GlobalConfigFromContext(ctx))
+}
+
+// GlobalConfigFromContext returns the global configuration, or nil when there is none
 func GlobalConfigFromContext(ctx context.Context) *Config {
-	return ctx.Value(globalConfigKey).(*Config) //nolint:forcetypeassert
+	switch value := ctx.Value(globalConfigKey).(type) {
+	case *Config:
+		return value
+
+	case GlobalConfigSource:
+		return value.GlobalConfig()
+
+	default:
+		return nil
+	}
+}
+
+// WithDefinitions stores the compiled definitions of the configuration, so they are only compiled once per evaluation
+func WithDefinitions(ctx context.Context, definitions Definitions) context.Context {
+	return context.WithValue(ctx, definitionsKey, definitions)
+}
+
+// DefinitionsFromContext returns the definitions stored by [WithDefinitions], or nil
+func DefinitionsFromContext(ctx context.Context) Definitions {
+	definitions, _ := ctx.Value(definitionsKey).(Definitions)
+
+	return definitions
 }
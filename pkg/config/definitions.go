@@ -0,0 +1,255 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/patcher"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/stdlib"
+)
+
+// Definitions are the compiled 'definitions' of a configuration, as expr-lang options
+// to compile scripts with, see [Config.CompileDefinitions]
+type Definitions []expr.Option
+
+// definitionNamePattern matches the names a definition can be referenced by in a script
+var definitionNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// CompileDefinitions compiles the 'definitions' of the configuration, in the order they reference each other,
+// into functions that scripts can use either as a value (is_reviewable) or as a function (is_reviewable()).
+//
+// Every definition is compiled once, and runs against the environment of the script using it.
+func (c Config) CompileDefinitions(evalContext scm.EvalContext) (Definitions, error) {
+	if len(c.Definitions) == 0 {
+		return nil, nil
+	}
+
+	order, err := definitionOrder(c.Definitions)
+	if err != nil {
+		return nil, err
+	}
+
+	// A definition with the name of something scripts already use would silently replace it in every script
+	env := conf.New(evalContext)
+	for _, option := range stdlib.Functions {
+		option(env)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Definitions)) {
+		if reserved := reservedName(env, name); len(reserved) > 0 {
+			return nil, fmt.Errorf("invalid definition name %q, it is already the name of %s", name, reserved)
+		}
+
+		if shadowed := shadowedDefinitions(c.Definitions[name], c.Definitions); len(shadowed) > 0 {
+			return nil, fmt.Errorf("definition %q may not declare variable %q with 'let', since a definition has the same name", name, shadowed[0])
+		}
+	}
+
+	var (
+		names     = make(map[string]bool, len(order))
+		functions = make([]expr.Option, 0, len(order))
+	)
+
+	for _, name := range order {
+		opts := make([]expr.Option, 0, len(stdlib.Functions)+len(functions)+4)
+		opts = append(opts, expr.Env(evalContext), stdlib.FunctionRenamer)
+		opts = append(opts, stdlib.Functions...)
+		opts = append(opts, functions...)
+		opts = append(opts, expr.Patch(definitionPatcher{names: maps.Clone(names)}), expr.Patch(patcher.WithContext{Name: "ctx"}))
+
+		program, err := expr.Compile(c.Definitions[name], opts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile definition %q into valid expr-lang syntax: %w", name, err)
+		}
+
+		returnType := reflect.TypeFor[any]()
+		if node := program.Node(); node != nil && node.Type() != nil {
+			returnType = node.Type()
+		}
+
+		// The function is called with the environment of the script using it, see [definitionPatcher]
+		signature := reflect.FuncOf([]reflect.Type{reflect.TypeFor[any]()}, []reflect.Type{returnType}, false)
+
+		functions = append(functions, expr.Function(
+			name,
+			func(params ...any) (any, error) {
+				return expr.Run(program, params[0])
+			},
+			reflect.New(signature).Interface(),
+		))
+
+		names[name] = true
+	}
+
+	return append(functions, expr.Patch(definitionPatcher{names: names})), nil
+}
+
+// definitionOrder returns the names of the definitions, so every definition comes after the definitions it references
+func definitionOrder(definitions map[string]string) ([]string, error) {
+	references := make(map[string][]string, len(definitions))
+
+	// Ranging over the sorted names, so the order, and the cycle reported, are always the same
+	for _, name := range slices.Sorted(maps.Keys(definitions)) {
+		if !definitionNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid definition name %q, it must only contain letters, digits and underscores, and not start with a digit", name)
+		}
+
+		tree, err := parser.Parse(definitions[name])
+		if err != nil {
+			return nil, fmt.Errorf("could not compile definition %q into valid expr-lang syntax: %w", name, err)
+		}
+
+		collector := &referenceCollector{definitions: definitions, seen: map[string]bool{}}
+		ast.Walk(&tree.Node, collector)
+
+		references[name] = collector.references
+	}
+
+	var (
+		order = make([]string, 0, len(definitions))
+		// true once all references of the definition were ordered, so a definition seen while still false references itself
+		visited = make(map[string]bool, len(definitions))
+		visit   func(name string, chain []string) error
+	)
+
+	visit = func(name string, chain []string) error {
+		if done, seen := visited[name]; seen {
+			if !done {
+				return fmt.Errorf("circular reference in definitions: %s", strings.Join(append(chain, name), " -> "))
+			}
+
+			return nil
+		}
+
+		visited[name] = false
+
+		for _, reference := range references[name] {
+			if err := visit(reference, append(slices.Clip(chain), name)); err != nil {
+				return err
+			}
+		}
+
+		visited[name] = true
+		order = append(order, name)
+
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(definitions)) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// reservedName returns what scripts compiled with env already use name for, like a field of the evaluation context,
+// a script function, an expr-lang builtin or keyword; empty when the name is free to use for a definition
+func reservedName(env *conf.Config, name string) string {
+	if tree, err := parser.Parse(name); err != nil || !isIdentifier(tree.Node) {
+		return "an expr-lang keyword"
+	}
+
+	switch {
+	case env.IsOverridden(name):
+		return "a field or function of the evaluation context"
+
+	case slices.Contains(builtin.Names, name):
+		return "an expr-lang builtin function"
+
+	default:
+		return ""
+	}
+}
+
+func isIdentifier(node ast.Node) bool {
+	_, ok := node.(*ast.IdentifierNode)
+
+	return ok
+}
+
+// shadowedDefinitions returns the variables the script declares with 'let' that have the name of a definition,
+// which expr-lang would reject with the less helpful "cannot redeclare function" error
+func shadowedDefinitions(script string, definitions map[string]string) []string {
+	tree, err := parser.Parse(script)
+	if err != nil {
+		// Reported when the script is compiled
+		return nil
+	}
+
+	collector := &variableCollector{definitions: definitions}
+	ast.Walk(&tree.Node, collector)
+
+	return collector.shadowed
+}
+
+// variableCollector collects the variables declared with 'let' that have the name of a definition
+type variableCollector struct {
+	definitions map[string]string
+	shadowed    []string
+}
+
+func (v *variableCollector) Visit(node *ast.Node) {
+	if declarator, ok := (*node).(*ast.VariableDeclaratorNode); ok {
+		if _, ok := v.definitions[declarator.Name]; ok && !slices.Contains(v.shadowed, declarator.Name) {
+			v.shadowed = append(v.shadowed, declarator.Name)
+		}
+	}
+}
+
+// referenceCollector collects the definitions referenced by a script, in the order they are referenced
+type referenceCollector struct {
+	definitions map[string]string
+	seen        map[string]bool
+	references  []string
+}
+
+func (r *referenceCollector) Visit(node *ast.Node) {
+	if identifier, ok := (*node).(*ast.IdentifierNode); ok {
+		if _, ok := r.definitions[identifier.Value]; ok && !r.seen[identifier.Value] {
+			r.seen[identifier.Value] = true
+			r.references = append(r.references, identifier.Value)
+		}
+	}
+}
+
+// definitionPatcher turns references to definitions into calls passing the environment ($env) of the script,
+// which the compiled definition runs against
+type definitionPatcher struct {
+	names map[string]bool
+}
+
+func (p definitionPatcher) Visit(node *ast.Node) {
+	switch current := (*node).(type) {
+	case *ast.IdentifierNode:
+		if p.names[current.Value] {
+			ast.Patch(node, &ast.CallNode{
+				Callee:    &ast.IdentifierNode{Value: current.Value},
+				Arguments: []ast.Node{&ast.IdentifierNode{Value: "$env"}},
+			})
+		}
+
+	case *ast.CallNode:
+		// The callee of is_reviewable() was already patched into is_reviewable($env) above
+		if callee, ok := current.Callee.(*ast.CallNode); ok && len(current.Arguments) == 0 && p.isDefinitionCall(callee) {
+			ast.Patch(node, callee)
+		}
+	}
+}
+
+func (p definitionPatcher) isDefinitionCall(call *ast.CallNode) bool {
+	identifier, ok := call.Callee.(*ast.IdentifierNode)
+
+	return ok && p.names[identifier.Value] && len(call.Arguments) == 1
+}
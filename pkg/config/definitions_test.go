@@ -0,0 +1,246 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Evaluate_definitions(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Definitions: map[string]string{
+			"is_bug":        `merge_request.has_label("bug")`,
+			"is_urgent_bug": `is_bug && merge_request.has_label("urgent")`,
+			"bug_labels":    `filter(["bug", "urgent"], { merge_request.has_label(#) })`,
+		},
+		Labels: config.Labels{
+			{Name: "as-value", Script: `is_bug`},
+			{Name: "as-function", Script: `is_bug()`},
+			{Name: "nested", Script: `is_urgent_bug`},
+			{Name: "skipped", Script: `true`, SkipIf: `is_bug`},
+			{Strategy: config.GenerateLabels, Script: `map(bug_labels, "found-" + #)`},
+		},
+		Actions: config.Actions{
+			{Name: "bug", If: `is_bug`},
+			{Name: "urgent-bug", If: `is_urgent_bug()`},
+		},
+	}
+
+	labels, actions, err := cfg.Evaluate(t.Context(), evalContext("bug"))
+	require.NoError(t, err)
+
+	got := map[string]bool{}
+	for _, label := range labels {
+		got[label.Name] = label.Matched
+	}
+
+	require.Equal(t, map[string]bool{"as-value": true, "as-function": true, "nested": false, "found-bug": true}, got)
+	require.Len(t, actions, 1)
+	require.Equal(t, "bug", actions[0].Name)
+}
+
+// Labels and actions of the global configuration are shared by every evaluation, so they must not keep scripts
+// compiled with the definitions of the repository evaluated first
+func TestConfig_Evaluate_definitionsPerRepository(t *testing.T) {
+	t.Parallel()
+
+	global := &config.Config{
+		Labels:  config.Labels{{Name: "flagged", Script: `flag`, SkipIf: `!flag`}},
+		Actions: config.Actions{{Name: "flagged", If: `flag`}},
+	}
+
+	for _, flag := range []string{"true", "false", "true"} {
+		cfg := global.Merge(&config.Config{Definitions: map[string]string{"flag": flag}})
+
+		labels, actions, err := cfg.Evaluate(t.Context(), evalContext())
+		require.NoError(t, err)
+
+		if flag == "true" {
+			require.Len(t, labels, 1)
+			require.True(t, labels[0].Matched)
+			require.Len(t, actions, 1)
+
+			continue
+		}
+
+		require.Empty(t, labels)
+		require.Empty(t, actions)
+	}
+}
+
+func TestConfig_Lint_definitions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		definitions map[string]string
+		script      string
+		wantError   string
+	}{
+		{name: "valid", definitions: map[string]string{"is_bug": `merge_request.has_label("bug")`}, script: `is_bug`},
+		{name: "functions taking the context", definitions: map[string]string{"is_stale": `merge_request.has_no_activity_within("30d")`}, script: `is_stale`},
+		{
+			name:        "unknown reference in a definition",
+			definitions: map[string]string{"is_bug": `is_feature || merge_request.has_label("bug")`},
+			script:      `is_bug`,
+			wantError:   `could not compile definition "is_bug" into valid expr-lang syntax: unknown name is_feature`,
+		},
+		{
+			name:        "unknown reference in a script",
+			definitions: map[string]string{"is_bug": `merge_request.has_label("bug")`},
+			script:      `is_feature`,
+			wantError:   `Label "label" failed validation: could not compile 'script' into valid expr-lang syntax: unknown name is_feature`,
+		},
+		{
+			name:        "circular reference",
+			definitions: map[string]string{"a": `b`, "b": `c && true`, "c": `a`},
+			script:      `a`,
+			wantError:   "circular reference in definitions: a -> b -> c -> a",
+		},
+		{
+			name:        "self reference",
+			definitions: map[string]string{"a": `a()`},
+			script:      `a`,
+			wantError:   "circular reference in definitions: a -> a",
+		},
+		{
+			name:        "invalid name",
+			definitions: map[string]string{"is-bug": `true`},
+			script:      `true`,
+			wantError:   `invalid definition name "is-bug"`,
+		},
+		{
+			name:        "name of an evaluation context field",
+			definitions: map[string]string{"merge_request": `true`},
+			script:      `merge_request.state == "opened"`,
+			wantError:   `invalid definition name "merge_request", it is already the name of a field or function of the evaluation context`,
+		},
+		{
+			name:        "name of a script function",
+			definitions: map[string]string{"uniq": `true`},
+			script:      `true`,
+			wantError:   `invalid definition name "uniq", it is already the name of a field or function of the evaluation context`,
+		},
+		{
+			name:        "name of an expr-lang builtin",
+			definitions: map[string]string{"filter": `true`},
+			script:      `true`,
+			wantError:   `invalid definition name "filter", it is already the name of an expr-lang builtin function`,
+		},
+		{
+			name:        "expr-lang keyword",
+			definitions: map[string]string{"nil": `true`},
+			script:      `true`,
+			wantError:   `invalid definition name "nil", it is already the name of an expr-lang keyword`,
+		},
+		{
+			name:        "variable with the name of a definition in a script",
+			definitions: map[string]string{"x": `true`},
+			script:      `let x = false; x`,
+			wantError:   `Label "label" may not declare variable "x" with 'let', since a definition has the same name`,
+		},
+		{
+			name:        "variable with the name of a definition in a definition",
+			definitions: map[string]string{"x": `true`, "y": `let x = false; x`},
+			script:      `y`,
+			wantError:   `definition "y" may not declare variable "x" with 'let', since a definition has the same name`,
+		},
+		{name: "variable with another name", definitions: map[string]string{"x": `true`}, script: `let y = x; y`},
+		{
+			name:        "wrong type",
+			definitions: map[string]string{"label_count": `len(merge_request.labels)`},
+			script:      `label_count`,
+			wantError:   "expected bool, but got int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.Config{
+				Definitions: tt.definitions,
+				Labels:      config.Labels{{Name: "label", Script: tt.script}},
+			}
+
+			err := cfg.Lint(t.Context(), evalContext())
+			if len(tt.wantError) > 0 {
+				require.ErrorContains(t, err, tt.wantError)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+// Definitions are compiled once, and used by update_description through the context
+func TestUpdateDescription_definitions(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Definitions: map[string]string{"kind": `merge_request.has_label("bug") ? "bug fix" : "feature"`}}
+
+	evalContext := evalContext("bug")
+	evalContext.MergeRequest.Description = scm.Ptr("This is a ${{KIND}}")
+
+	definitions, err := cfg.CompileDefinitions(evalContext)
+	require.NoError(t, err)
+
+	ctx := config.WithDefinitions(t.Context(), definitions)
+	require.Equal(t, definitions, config.DefinitionsFromContext(ctx))
+
+	update := &scm.UpdateMergeRequestOptions{}
+
+	err = config.UpdateDescription(evalContext, update, config.ActionStep{"replace": config.ActionStep{"${{KIND}}": "kind"}}, config.DefinitionsFromContext(ctx)...)
+	require.NoError(t, err)
+	require.Equal(t, scm.Ptr("This is a bug fix"), update.Description)
+}
+
+func TestConfig_Merge_definitions(t *testing.T) {
+	t.Parallel()
+
+	global := &config.Config{Definitions: map[string]string{"a": "true", "b": "true"}}
+	repository := &config.Config{Definitions: map[string]string{"b": "false", "c": "false"}}
+
+	merged := global.Merge(repository)
+
+	// The repository may add definitions, but not replace those of the global configuration
+	require.Equal(t, map[string]string{"a": "true", "b": "true", "c": "false"}, merged.Definitions)
+	require.Equal(t, []config.MergeChange{{Kind: "definition", Name: "b", Change: config.MergeLocked}}, merged.MergeChanges)
+	require.Equal(t, map[string]string{"a": "true", "b": "true"}, global.Definitions)
+	require.ErrorContains(t, merged.Lint(t.Context(), evalContext()), `Definition "b" may not replace the definition with the same name in the global configuration`)
+}
+
+// The 'project' includes of the global configuration are loaded after merging the repository configuration,
+// whose definitions may not replace those the included labels and actions depend on
+func TestConfig_LoadIncludes_definitions(t *testing.T) {
+	t.Parallel()
+
+	client := &includeClient{files: map[string]string{
+		"policy/org@HEAD:org.yml": `
+definitions:
+  is_protected: "true"
+  is_shared: "true"
+label:
+  - name: protected
+    script: is_protected
+    locked: true
+`,
+	}}
+
+	global := &config.Config{Includes: []config.Include{{Project: "policy/org", Files: []string{"org.yml"}}}}
+	repository := &config.Config{Definitions: map[string]string{"is_protected": "false", "is_shared": "true"}}
+
+	cfg := global.Merge(repository)
+
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client}))
+
+	// Identical definitions are not a conflict
+	require.Equal(t, []config.MergeChange{{Kind: "definition", Name: "is_protected", Change: config.MergeLocked}}, cfg.MergeChanges)
+	require.ErrorContains(t, cfg.Lint(t.Context(), evalContext()), `Definition "is_protected" may not replace the definition with the same name in the global configuration or an included file`)
+}
@@ -1,15 +1,34 @@
 package config
 
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jippi/scm-engine/pkg/scm"
+	slogctx "github.com/veqryn/slog-context"
+)
+
 type Include struct {
 	// The project to include files from
 	//
 	// See: https://jippi.github.io/scm-engine/configuration/#include.project
-	Project string `json:"project" yaml:"project"`
+	Project string `json:"project,omitempty" yaml:"project"`
 
 	// The list of files to include from the project. The paths must be relative to the repository root, e.x. label/some-config-file.yml; NOT /label/some-config-file.yml
 	//
 	// See: https://jippi.github.io/scm-engine/configuration/#include.files
-	Files []string `json:"files" yaml:"files"`
+	Files []string `json:"files,omitempty" yaml:"files"`
 
 	// (Optional) Git reference to read the configuration from; it can be a tag, branch, or commit SHA.
 	//
@@ -17,4 +36,324 @@ type Include struct {
 	//
 	// See: https://jippi.github.io/scm-engine/configuration/#include.ref
 	Ref *string `json:"ref,omitempty" yaml:"ref"`
+
+	// A file on the local filesystem to include; relative paths are relative to the configuration file including it.
+	//
+	// Only supported in configuration files read from disk, like the global configuration file.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include.local
+	Local string `json:"local,omitempty" yaml:"local"`
+
+	// An HTTPS URL to include a file from
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include.remote
+	Remote string `json:"remote,omitempty" yaml:"remote"`
+
+	// (Optional) The checksum the 'remote' file must match, in the format sha256:<hex>
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include.checksum
+	Checksum string `json:"checksum,omitempty" yaml:"checksum"`
+}
+
+// Validate checks that the include has exactly one source, and only the settings supported by it
+func (i Include) Validate() error {
+	sources := 0
+
+	for _, value := range []string{i.Project, i.Local, i.Remote} {
+		if len(value) > 0 {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return errors.New("an include must have exactly one of 'project', 'local' or 'remote'")
+	}
+
+	if len(i.Project) == 0 && (len(i.Files) > 0 || i.Ref != nil) {
+		return errors.New("'files' and 'ref' are only supported by 'project' includes")
+	}
+
+	if len(i.Checksum) > 0 {
+		if len(i.Remote) == 0 {
+			return errors.New("'checksum' is only supported by 'remote' includes")
+		}
+
+		digest, ok := strings.CutPrefix(i.Checksum, "sha256:")
+		if _, err := hex.DecodeString(digest); !ok || err != nil || len(digest) != sha256.Size*2 {
+			return fmt.Errorf("invalid checksum [%s], it must be in the format sha256:<hex>", i.Checksum)
+		}
+	}
+
+	if len(i.Remote) > 0 {
+		remote, err := url.Parse(i.Remote)
+		if err != nil || remote.Scheme != "https" || len(remote.Host) == 0 {
+			return fmt.Errorf("invalid remote [%s], it must be an https:// URL", i.Remote)
+		}
+	}
+
+	return nil
+}
+
+// IncludeOptions configures how [Config.LoadIncludes] reads included files
+type IncludeOptions struct {
+	// Reads 'project' includes; they are kept in the 'include' settings, to be loaded later, when nil
+	Client scm.Client
+
+	// Reads 'remote' includes; they are kept in the 'include' settings, to be loaded later, when nil
+	HTTPClient *http.Client
+
+	// The directory of the configuration file, which relative 'local' includes are read from.
+	//
+	// 'local' includes are rejected when empty, so a configuration file that was not read from disk,
+	// like the one of a repository evaluated by the server, can't read files from the server.
+	LocalDir string
+
+	// How deep includes may be nested, [DefaultIncludeMaxDepth] when not positive
+	MaxDepth int
+
+	// (Optional) Reports whether an include of the config is trusted, like those of the global configuration.
+	//
+	// When set, 'remote' includes that are not trusted, and those in files included by them, must be in the
+	// 'include_policy' allowlist, so a repository can't make the server send requests to any URL.
+	Trusted func(Include) bool
+}
+
+// DefaultIncludeMaxDepth is how deep 'include' settings may be nested when no limit is configured
+const DefaultIncludeMaxDepth = 5
+
+// maxRemoteIncludeSize is the largest 'remote' file that will be read
+const maxRemoteIncludeSize = 1 << 20
+
+// includedFile is a node in the tree of resolved 'include' settings, logged for debugging
+type includedFile struct {
+	// The file, in the format project@ref:path, the URL, or the local path
+	Source string `json:"source"`
+
+	// The files included by this file
+	Includes []includedFile `json:"includes,omitempty"`
+}
+
+// includeResolver walks the 'include' settings of a configuration file depth first
+type includeResolver struct {
+	options IncludeOptions
+	policy  *IncludePolicy
+
+	// Files seen so far, keyed on their source; true once all of its includes were resolved,
+	// so a file that is seen while still false includes itself
+	visited map[string]bool
+
+	// The files to merge, in the order they were resolved
+	files []includedConfig
+
+	// The includes that could not be loaded with the options, in the order they were seen
+	deferred []Include
+}
+
+type includedConfig struct {
+	source string
+	config *Config
+}
+
+// sourceFile is a file read for an include, before it was parsed
+type sourceFile struct {
+	source  string
+	content string
+
+	// The directory nested 'local' includes are read from; empty when they are not allowed
+	dir string
+}
+
+// resolve loads the files of includes, and the files included by those, where chain is the files
+// that led to includes being resolved, dir the directory 'local' includes are read from, and trusted
+// whether the file including them is trusted, see [IncludeOptions.Trusted]
+func (r *includeResolver) resolve(ctx context.Context, includes []Include, chain []string, dir string, trusted bool) ([]includedFile, error) {
+	if len(includes) == 0 {
+		return nil, nil
+	}
+
+	if len(chain) >= r.options.MaxDepth {
+		return nil, fmt.Errorf("file [%s] may not have any 'include' settings; includes may not be nested more than %d levels deep (%s)", chain[len(chain)-1], r.options.MaxDepth, strings.Join(chain, " -> "))
+	}
+
+	var tree []includedFile
+
+	for _, include := range includes {
+		ctx := slogctx.With(ctx, slog.Any("remote_include_config", include))
+
+		// Files included by an untrusted include are not trusted either
+		trusted := trusted && (len(chain) > 0 || r.options.Trusted == nil || r.options.Trusted(include))
+
+		files, err := r.read(ctx, include, chain, dir, trusted)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if done, seen := r.visited[file.source]; seen {
+				if !done {
+					return nil, fmt.Errorf("include cycle detected: %s", strings.Join(append(slices.Clip(chain), file.source), " -> "))
+				}
+
+				slogctx.Debug(ctx, fmt.Sprintf("file [%s] was already included, skipping it", file.source))
+
+				continue
+			}
+
+			remoteConfig, err := ParseFileString(file.content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse included config file [%s]: %w", file.source, err)
+			}
+
+			// Disallow changing dry run
+			if remoteConfig.DryRun != nil {
+				slogctx.Warn(ctx, fmt.Sprintf("file [%s] may not have a 'dry_run' setting; Remote include are not allowed to change this setting", file.source))
+			}
+
+			r.visited[file.source] = false
+			r.files = append(r.files, includedConfig{source: file.source, config: remoteConfig})
+
+			nested, err := r.resolve(ctx, remoteConfig.Includes, append(slices.Clip(chain), file.source), file.dir, trusted)
+			if err != nil {
+				return nil, err
+			}
+
+			r.visited[file.source] = true
+
+			tree = append(tree, includedFile{Source: file.source, Includes: nested})
+		}
+	}
+
+	return tree, nil
+}
+
+// read returns the files of include, in the order they were listed; none when the include is deferred
+func (r *includeResolver) read(ctx context.Context, include Include, chain []string, dir string, trusted bool) ([]sourceFile, error) {
+	if err := include.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.policy.check(ctx, include, r.options.Client); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(include.Local) > 0:
+		if len(dir) == 0 {
+			if len(chain) > 0 {
+				return nil, fmt.Errorf("file [%s] may not include local file [%s]; only configuration files read from disk may include local files", chain[len(chain)-1], include.Local)
+			}
+
+			return nil, fmt.Errorf("can not include local file [%s]; only configuration files read from disk may include local files", include.Local)
+		}
+
+		path := include.Local
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve included config file [%s]: %w", include.Local, err)
+		}
+
+		slogctx.Debug(ctx, fmt.Sprintf("Loading local configuration from %q", path))
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load included config file [%s]: %w", include.Local, err)
+		}
+
+		return []sourceFile{{source: path, content: string(content), dir: filepath.Dir(path)}}, nil
+
+	case len(include.Remote) > 0:
+		if !trusted && !r.policy.allowsRemote(include.Remote) {
+			return nil, fmt.Errorf("%w: remote [%s] must be in the allowlist of the global configuration to be included by a repository", ErrIncludeNotAllowed, include.Remote)
+		}
+
+		if r.options.HTTPClient == nil {
+			r.deferred = append(r.deferred, include)
+
+			return nil, nil
+		}
+
+		slogctx.Debug(ctx, fmt.Sprintf("Loading remote configuration from %q", include.Remote))
+
+		content, err := r.fetch(ctx, include)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load included config file [%s]: %w", include.Remote, err)
+		}
+
+		return []sourceFile{{source: include.Remote, content: content}}, nil
+
+	default:
+		if r.options.Client == nil {
+			r.deferred = append(r.deferred, include)
+
+			return nil, nil
+		}
+
+		slogctx.Debug(ctx, fmt.Sprintf("Loading remote configuration from project %q", include.Project))
+
+		files, err := r.options.Client.GetProjectFiles(ctx, include.Project, include.Ref, include.Files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load included config files from project [%s]: %w", include.Project, err)
+		}
+
+		// Files are returned in the order they are listed, since ranging over the map would make the merge order random
+		result := make([]sourceFile, 0, len(include.Files))
+
+		for _, fileName := range include.Files {
+			result = append(result, sourceFile{source: includeSource(include.Project, include.Ref, fileName), content: files[fileName]})
+		}
+
+		return result, nil
+	}
+}
+
+// fetch downloads a 'remote' include, and verifies its checksum when pinned
+func (r *includeResolver) fetch(ctx context.Context, include Include) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, include.Remote, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := r.options.HTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got status code %d", response.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxRemoteIncludeSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(content) > maxRemoteIncludeSize {
+		return "", fmt.Errorf("the file is larger than %d bytes", maxRemoteIncludeSize)
+	}
+
+	if len(include.Checksum) > 0 {
+		sum := sha256.Sum256(content)
+
+		if actual := "sha256:" + hex.EncodeToString(sum[:]); !strings.EqualFold(actual, include.Checksum) {
+			return "", fmt.Errorf("checksum mismatch, expected %s but got %s", include.Checksum, actual)
+		}
+	}
+
+	return string(content), nil
+}
+
+// includeSource identifies a file from an 'include' setting, in the format project@ref:path
+func includeSource(project string, ref *string, file string) string {
+	strRef := "HEAD"
+
+	if ref != nil && len(*ref) > 0 {
+		strRef = *ref
+	}
+
+	return fmt.Sprintf("%s@%s:%s", project, strRef, file)
 }
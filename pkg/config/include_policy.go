@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/jippi/scm-engine/pkg/scm"
+)
+
+// ErrIncludeNotAllowed is returned for includes that do not comply with the 'include_policy'
+var ErrIncludeNotAllowed = errors.New("include is not allowed by the 'include_policy'")
+
+const (
+	// PinnedRefCommitSHA requires 'project' includes to have a full commit SHA as 'ref'
+	PinnedRefCommitSHA = "commit_sha"
+
+	// PinnedRefCommitSHAOrSignedTag requires 'project' includes to have a full commit SHA, or a tag with a verified signature, as 'ref'
+	PinnedRefCommitSHAOrSignedTag = "commit_sha_or_signed_tag"
+)
+
+// commitSHAPattern matches full SHA-1 and SHA-256 commit hashes
+var commitSHAPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+type IncludePolicy struct {
+	// (Optional) The sources that may be included. When empty, any project or URL may be included, except by the configuration files of repositories evaluated by the server, which may only include URLs in the allowlist.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy.allow
+	Allow []IncludePolicySource `json:"allow,omitempty" yaml:"allow"`
+
+	// (Optional) Require 'project' includes to pin their 'ref' to a full commit SHA (commit_sha), or to either a full commit SHA or a tag with a verified signature (commit_sha_or_signed_tag).
+	//
+	// 'remote' includes must have a 'checksum' when set.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy.require_pinned_ref
+	RequirePinnedRef string `json:"require_pinned_ref,omitempty" yaml:"require_pinned_ref" jsonschema:"enum=commit_sha,enum=commit_sha_or_signed_tag"`
+}
+
+type IncludePolicySource struct {
+	// A project that may be included from, or a pattern like 'platform/*'
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy.allow.project
+	Project string `json:"project,omitempty" yaml:"project"`
+
+	// (Optional) The refs that may be included from the project, or patterns like 'v*'. When empty, any ref may be included.
+	//
+	// Includes without a 'ref' are matched as HEAD.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy.allow.refs
+	Refs []string `json:"refs,omitempty" yaml:"refs"`
+
+	// A URL that may be included, or a pattern like 'https://example.com/scm-engine/*'
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#include_policy.allow.remote
+	Remote string `json:"remote,omitempty" yaml:"remote"`
+}
+
+// Validate checks the policy for invalid patterns and settings
+func (p *IncludePolicy) Validate() error {
+	switch p.RequirePinnedRef {
+	case "", PinnedRefCommitSHA, PinnedRefCommitSHAOrSignedTag:
+
+	default:
+		return fmt.Errorf("invalid 'require_pinned_ref' value [%s], it must be either %q or %q", p.RequirePinnedRef, PinnedRefCommitSHA, PinnedRefCommitSHAOrSignedTag)
+	}
+
+	for _, source := range p.Allow {
+		if (len(source.Project) == 0) == (len(source.Remote) == 0) {
+			return errors.New("an 'include_policy' allow entry must have exactly one of 'project' or 'remote'")
+		}
+
+		if len(source.Remote) > 0 && len(source.Refs) > 0 {
+			return errors.New("'refs' is only supported by 'project' allow entries in the 'include_policy'")
+		}
+
+		for _, pattern := range append([]string{source.Project, source.Remote}, source.Refs...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid 'include_policy' pattern [%s]: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// check returns an error wrapping [ErrIncludeNotAllowed] when the 'project' or 'remote' include does not comply with the policy;
+// 'local' includes are always allowed, since only configuration files read from disk may have them.
+//
+// Includes are checked before they are kept for later, so 'lint' reports them too.
+func (p *IncludePolicy) check(ctx context.Context, include Include, client scm.Client) error {
+	if p == nil || len(include.Local) > 0 {
+		return nil
+	}
+
+	if len(include.Remote) > 0 {
+		if !p.allowed(func(source IncludePolicySource) bool { return match(source.Remote, include.Remote) }) {
+			return fmt.Errorf("%w: remote [%s] is not in the allowlist", ErrIncludeNotAllowed, include.Remote)
+		}
+
+		if len(p.RequirePinnedRef) > 0 && len(include.Checksum) == 0 {
+			return fmt.Errorf("%w: remote [%s] must have a 'checksum'", ErrIncludeNotAllowed, include.Remote)
+		}
+
+		return nil
+	}
+
+	ref := "HEAD"
+	if include.Ref != nil && len(*include.Ref) > 0 {
+		ref = *include.Ref
+	}
+
+	allowed := p.allowed(func(source IncludePolicySource) bool {
+		if !match(source.Project, include.Project) {
+			return false
+		}
+
+		if len(source.Refs) == 0 {
+			return true
+		}
+
+		for _, pattern := range source.Refs {
+			if match(pattern, ref) {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	if !allowed {
+		return fmt.Errorf("%w: project [%s] at ref [%s] is not in the allowlist", ErrIncludeNotAllowed, include.Project, ref)
+	}
+
+	if len(p.RequirePinnedRef) == 0 || commitSHAPattern.MatchString(ref) {
+		return nil
+	}
+
+	if p.RequirePinnedRef == PinnedRefCommitSHA {
+		return fmt.Errorf("%w: ref [%s] of project [%s] must be a full commit SHA", ErrIncludeNotAllowed, ref, include.Project)
+	}
+
+	// The signature is verified when the include is loaded with a client
+	if client == nil {
+		return nil
+	}
+
+	signed, err := client.IsSignedTag(ctx, include.Project, ref)
+	if err != nil {
+		return fmt.Errorf("could not verify the signature of tag [%s] in project [%s]: %w", ref, include.Project, err)
+	}
+
+	if !signed {
+		return fmt.Errorf("%w: ref [%s] of project [%s] must be a full commit SHA or a tag with a verified signature", ErrIncludeNotAllowed, ref, include.Project)
+	}
+
+	return nil
+}
+
+// allowed returns whether any source in the allowlist matches; everything is allowed when the allowlist is empty
+func (p *IncludePolicy) allowed(matches func(IncludePolicySource) bool) bool {
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, source := range p.Allow {
+		if matches(source) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsRemote reports whether the 'remote' include is explicitly in the allowlist, unlike [IncludePolicy.allowed]
+// which allows anything when there is no allowlist
+func (p *IncludePolicy) allowsRemote(remote string) bool {
+	if p == nil {
+		return false
+	}
+
+	return slices.ContainsFunc(p.Allow, func(source IncludePolicySource) bool {
+		return match(source.Remote, remote)
+	})
+}
+
+// match reports whether value matches the pattern; patterns were checked by [IncludePolicy.Validate]
+func match(pattern, value string) bool {
+	if len(pattern) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern, value)
+
+	return ok
+}
@@ -0,0 +1,161 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_LoadIncludes_policy(t *testing.T) {
+	t.Parallel()
+
+	sha := strings.Repeat("a", 40)
+
+	client := &includeClient{
+		files: map[string]string{
+			"platform/library@HEAD:label.yml":        "label:\n  - name: head\n",
+			"platform/library@v1.0.0:label.yml":      "label:\n  - name: tag\n",
+			"platform/library@v1.0.1:label.yml":      "label:\n  - name: signed\n",
+			"platform/library@" + sha + ":label.yml": "label:\n  - name: sha\n",
+			"platform/library@main:label.yml":        "include:\n  - project: someone/else\n    files: [label.yml]\n",
+			"someone/else@HEAD:label.yml":            "label:\n  - name: else\n",
+		},
+		signedTags: map[string]bool{"platform/library@v1.0.1": true},
+	}
+
+	allowlist := []config.IncludePolicySource{
+		{Project: "platform/*", Refs: []string{"HEAD", "main", "v*", sha}},
+		{Remote: "https://example.com/scm-engine/*"},
+	}
+
+	project := func(ref string) config.Include {
+		include := config.Include{Project: "platform/library", Files: []string{"label.yml"}}
+		if len(ref) > 0 {
+			include.Ref = scm.Ptr(ref)
+		}
+
+		return include
+	}
+
+	tests := []struct {
+		name      string
+		policy    *config.IncludePolicy
+		include   config.Include
+		wantError string
+	}{
+		{name: "no policy", include: project("")},
+		{name: "allowed project without a ref", policy: &config.IncludePolicy{Allow: allowlist}, include: project("")},
+		{name: "allowed ref pattern", policy: &config.IncludePolicy{Allow: allowlist}, include: project("v1.0.0")},
+		{
+			name:      "project not in allowlist",
+			policy:    &config.IncludePolicy{Allow: allowlist},
+			include:   config.Include{Project: "someone/else", Files: []string{"label.yml"}},
+			wantError: "include is not allowed by the 'include_policy': project [someone/else] at ref [HEAD] is not in the allowlist",
+		},
+		{
+			name:      "ref not in allowlist",
+			policy:    &config.IncludePolicy{Allow: allowlist},
+			include:   project("feature"),
+			wantError: "include is not allowed by the 'include_policy': project [platform/library] at ref [feature] is not in the allowlist",
+		},
+		{
+			name:      "nested includes are checked too",
+			policy:    &config.IncludePolicy{Allow: allowlist},
+			include:   project("main"),
+			wantError: "include is not allowed by the 'include_policy': project [someone/else] at ref [HEAD] is not in the allowlist",
+		},
+		{name: "commit sha", policy: &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHA}, include: project(sha)},
+		{
+			name:      "commit sha required",
+			policy:    &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHA},
+			include:   project("v1.0.1"),
+			wantError: "include is not allowed by the 'include_policy': ref [v1.0.1] of project [platform/library] must be a full commit SHA",
+		},
+		{name: "signed tag", policy: &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHAOrSignedTag}, include: project("v1.0.1")},
+		{name: "commit sha instead of signed tag", policy: &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHAOrSignedTag}, include: project(sha)},
+		{
+			name:      "unsigned tag",
+			policy:    &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHAOrSignedTag},
+			include:   project("v1.0.0"),
+			wantError: "include is not allowed by the 'include_policy': ref [v1.0.0] of project [platform/library] must be a full commit SHA or a tag with a verified signature",
+		},
+		{
+			name:      "remote not in allowlist",
+			policy:    &config.IncludePolicy{Allow: allowlist},
+			include:   config.Include{Remote: "https://example.org/label.yml"},
+			wantError: "include is not allowed by the 'include_policy': remote [https://example.org/label.yml] is not in the allowlist",
+		},
+		{
+			name:      "remote checksum required",
+			policy:    &config.IncludePolicy{Allow: allowlist, RequirePinnedRef: config.PinnedRefCommitSHA},
+			include:   config.Include{Remote: "https://example.com/scm-engine/label.yml"},
+			wantError: "include is not allowed by the 'include_policy': remote [https://example.com/scm-engine/label.yml] must have a 'checksum'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.Config{IncludePolicy: tt.policy, Includes: []config.Include{tt.include}}
+
+			// Remote includes are checked before they are kept for later, so they are never downloaded
+			err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client})
+			if len(tt.wantError) == 0 {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.ErrorIs(t, err, config.ErrIncludeNotAllowed)
+			require.EqualError(t, err, tt.wantError)
+		})
+	}
+}
+
+func TestIncludePolicy_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		policy    config.IncludePolicy
+		wantError string
+	}{
+		{name: "empty", policy: config.IncludePolicy{}},
+		{name: "valid", policy: config.IncludePolicy{Allow: []config.IncludePolicySource{{Project: "platform/*", Refs: []string{"v*"}}, {Remote: "https://example.com/*"}}, RequirePinnedRef: config.PinnedRefCommitSHA}},
+		{name: "unknown pinning", policy: config.IncludePolicy{RequirePinnedRef: "tag"}, wantError: `invalid 'require_pinned_ref' value [tag], it must be either "commit_sha" or "commit_sha_or_signed_tag"`},
+		{name: "no source", policy: config.IncludePolicy{Allow: []config.IncludePolicySource{{}}}, wantError: "an 'include_policy' allow entry must have exactly one of 'project' or 'remote'"},
+		{name: "refs for remote", policy: config.IncludePolicy{Allow: []config.IncludePolicySource{{Remote: "https://example.com/*", Refs: []string{"v*"}}}}, wantError: "'refs' is only supported by 'project' allow entries in the 'include_policy'"},
+		{name: "invalid pattern", policy: config.IncludePolicy{Allow: []config.IncludePolicySource{{Project: "platform/["}}}, wantError: "invalid 'include_policy' pattern [platform/[]: syntax error in pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.policy.Validate()
+			if len(tt.wantError) == 0 {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.EqualError(t, err, tt.wantError)
+		})
+	}
+}
+
+// The policy restricts what the repository configuration may include, so it can't replace it
+func TestConfig_Merge_includePolicy(t *testing.T) {
+	t.Parallel()
+
+	global := &config.Config{IncludePolicy: &config.IncludePolicy{RequirePinnedRef: config.PinnedRefCommitSHA}}
+	repository := &config.Config{IncludePolicy: &config.IncludePolicy{}}
+
+	require.Same(t, global.IncludePolicy, global.Merge(repository).IncludePolicy)
+	require.Same(t, global.IncludePolicy, global.Merge(nil).IncludePolicy)
+	require.Nil(t, (&config.Config{}).Merge(repository).IncludePolicy)
+}
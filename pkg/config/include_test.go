@@ -0,0 +1,472 @@
+package config_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/stretchr/testify/require"
+)
+
+// includeClient serves included files from memory, keyed on "project@ref:file", and signed tags keyed on "project@tag"
+type includeClient struct {
+	scm.Client
+
+	files      map[string]string
+	signedTags map[string]bool
+}
+
+func (c *includeClient) IsSignedTag(_ context.Context, project, tag string) (bool, error) {
+	return c.signedTags[project+"@"+tag], nil
+}
+
+func (c *includeClient) GetProjectFiles(_ context.Context, project string, ref *string, files []string) (map[string]string, error) {
+	strRef := "HEAD"
+	if ref != nil {
+		strRef = *ref
+	}
+
+	result := make(map[string]string, len(files))
+
+	for _, file := range files {
+		content, ok := c.files[project+"@"+strRef+":"+file]
+		if !ok {
+			return nil, fmt.Errorf("configuration file [%s] in project [%s] does not exist", file, project)
+		}
+
+		result[file] = content
+	}
+
+	return result, nil
+}
+
+func labelNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Labels))
+
+	for _, label := range cfg.Labels {
+		names = append(names, label.Name)
+	}
+
+	return names
+}
+
+func TestConfig_LoadIncludes_recursive(t *testing.T) {
+	t.Parallel()
+
+	// team includes department, which includes the org base; the org base is also included directly
+	client := &includeClient{files: map[string]string{
+		"policy/team@HEAD:team.yml": `
+include:
+  - project: policy/department
+    ref: v1
+    files: [department.yml]
+  - project: policy/org
+    files: [base.yml]
+label:
+  - name: team
+`,
+		"policy/department@v1:department.yml": `
+include:
+  - project: policy/org
+    files: [base.yml]
+label:
+  - name: department
+`,
+		"policy/org@HEAD:base.yml": `
+label:
+  - name: org
+`,
+		"policy/team@HEAD:extra.yml": `
+label:
+  - name: extra
+`,
+	}}
+
+	cfg := &config.Config{
+		Labels: config.Labels{{Name: "repository"}},
+		Includes: []config.Include{
+			{Project: "policy/team", Files: []string{"team.yml", "extra.yml"}},
+		},
+	}
+
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client}))
+
+	// Every file is followed by the files it includes, and the org base is only merged once
+	require.Equal(t, []string{"repository", "team", "department", "org", "extra"}, labelNames(cfg))
+}
+
+// Included entries follow the same override, disable and lock rules as merged configurations,
+// where the configuration including the file takes precedence over it
+func TestConfig_LoadIncludes_overrides(t *testing.T) {
+	t.Parallel()
+
+	client := &includeClient{files: map[string]string{
+		"policy/org@HEAD:org.yml": `
+label:
+  - name: optional
+    script: "true"
+  - name: required
+    script: "true"
+    locked: true
+  - name: overridden
+    script: "true"
+  - name: other
+    script: "true"
+actions:
+  - name: deploy
+    if: "true"
+`,
+		"team/repo@HEAD:sneaky.yml": `
+label:
+  - name: protected
+    script: "false"
+actions:
+  - name: deploy
+    if: "false"
+`,
+	}}
+
+	global := &config.Config{
+		Includes: []config.Include{{Project: "policy/org", Files: []string{"org.yml"}}},
+		Labels:   config.Labels{{Name: "protected", Script: "true", Locked: true}},
+	}
+
+	repository := &config.Config{
+		Includes: []config.Include{{Project: "team/repo", Files: []string{"sneaky.yml"}}},
+		Labels: config.Labels{
+			{Name: "optional", Disabled: true},
+			{Name: "required", Disabled: true},
+			{Name: "overridden", Script: "false"},
+		},
+	}
+
+	cfg := global.Merge(repository)
+
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client}))
+
+	// Every name is only used once, so evaluating does not fail on labels generated multiple times
+	require.Equal(t, []string{"protected", "optional", "required", "overridden", "other"}, labelNames(cfg))
+
+	labels := map[string]*config.Label{}
+	for _, label := range cfg.Labels {
+		labels[label.Name] = label
+	}
+
+	require.Equal(t, "true", labels["protected"].Script, "an include may not replace a locked entry")
+	require.True(t, labels["optional"].Disabled)
+	require.Equal(t, "true", labels["required"].Script, "a locked included entry may not be disabled")
+	require.Equal(t, "false", labels["overridden"].Script, "the config takes precedence over the files it includes")
+
+	// The action of the first included file is kept, and the same action from a later file does not run twice
+	require.Len(t, cfg.Actions, 1)
+	require.Equal(t, "true", cfg.Actions[0].If)
+
+	require.Equal(t, []config.MergeChange{
+		{Kind: "label", Name: "optional", Change: config.MergeDisabled},
+		{Kind: "label", Name: "required", Change: config.MergeLocked},
+		{Kind: "label", Name: "overridden", Change: config.MergeOverridden},
+		{Kind: "action", Name: "deploy", Change: config.MergeOverridden},
+		{Kind: "label", Name: "protected", Change: config.MergeLocked},
+	}, cfg.MergeChanges)
+}
+
+func TestConfig_LoadIncludes_cycle(t *testing.T) {
+	t.Parallel()
+
+	client := &includeClient{files: map[string]string{
+		"policy/a@HEAD:a.yml": `
+include:
+  - project: policy/b
+    files: [b.yml]
+`,
+		"policy/b@HEAD:b.yml": `
+include:
+  - project: policy/a
+    files: [a.yml]
+`,
+	}}
+
+	cfg := &config.Config{Includes: []config.Include{{Project: "policy/a", Files: []string{"a.yml"}}}}
+
+	err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client})
+	require.EqualError(t, err, "include cycle detected: policy/a@HEAD:a.yml -> policy/b@HEAD:b.yml -> policy/a@HEAD:a.yml")
+}
+
+func TestConfig_LoadIncludes_maxDepth(t *testing.T) {
+	t.Parallel()
+
+	client := &includeClient{files: map[string]string{
+		"policy/a@HEAD:a.yml": `
+include:
+  - project: policy/b
+    files: [b.yml]
+label:
+  - name: a
+`,
+		"policy/b@HEAD:b.yml": `
+include:
+  - project: policy/c
+    files: [c.yml]
+label:
+  - name: b
+`,
+		"policy/c@HEAD:c.yml": `
+label:
+  - name: c
+`,
+	}}
+
+	newConfig := func() *config.Config {
+		return &config.Config{Includes: []config.Include{{Project: "policy/a", Files: []string{"a.yml"}}}}
+	}
+
+	cfg := newConfig()
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client, MaxDepth: 3}))
+	require.Equal(t, []string{"a", "b", "c"}, labelNames(cfg))
+
+	cfg = newConfig()
+	err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client, MaxDepth: 2})
+	require.ErrorContains(t, err, "file [policy/b@HEAD:b.yml] may not have any 'include' settings; includes may not be nested more than 2 levels deep (policy/a@HEAD:a.yml -> policy/b@HEAD:b.yml)")
+}
+
+// Files must be merged in the order they were listed, not in the order the client returned them in
+func TestConfig_LoadIncludes_deterministicOrder(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{}
+	want := []string{}
+
+	for i := range 20 {
+		files[fmt.Sprintf("policy/a@HEAD:%02d.yml", i)] = fmt.Sprintf("label:\n  - name: label-%02d\n", i)
+		want = append(want, fmt.Sprintf("label-%02d", i))
+	}
+
+	include := config.Include{Project: "policy/a"}
+	for i := range 20 {
+		include.Files = append(include.Files, fmt.Sprintf("%02d.yml", i))
+	}
+
+	for range 10 {
+		cfg := &config.Config{Includes: []config.Include{include}}
+
+		require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: &includeClient{files: files}}))
+		require.Equal(t, want, labelNames(cfg))
+	}
+}
+
+func TestConfig_LoadIncludes_local(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "policy"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy", "team.yml"), []byte(`
+include:
+  - local: base.yml
+  - project: policy/org
+    files: [org.yml]
+label:
+  - name: team
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy", "base.yml"), []byte("label:\n  - name: base\n"), 0o600))
+
+	cfg := &config.Config{Includes: []config.Include{{Local: "policy/team.yml"}}}
+
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{LocalDir: dir}))
+
+	// Nested local paths are relative to the file including them, and project includes are kept for later
+	require.Equal(t, []string{"team", "base"}, labelNames(cfg))
+	require.Equal(t, []config.Include{{Project: "policy/org", Files: []string{"org.yml"}}}, cfg.Includes)
+
+	client := &includeClient{files: map[string]string{"policy/org@HEAD:org.yml": "label:\n  - name: org\n"}}
+
+	require.NoError(t, cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client}))
+	require.Equal(t, []string{"team", "base", "org"}, labelNames(cfg))
+	require.Empty(t, cfg.Includes)
+}
+
+// Configuration files that were not read from disk, and the files they include, may not read local files
+func TestConfig_LoadIncludes_localIsRejected(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Includes: []config.Include{{Local: "/etc/passwd"}}}
+
+	err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{})
+	require.EqualError(t, err, "can not include local file [/etc/passwd]; only configuration files read from disk may include local files")
+
+	client := &includeClient{files: map[string]string{"policy/org@HEAD:org.yml": "include:\n  - local: /etc/passwd\n"}}
+	cfg = &config.Config{Includes: []config.Include{{Project: "policy/org", Files: []string{"org.yml"}}}}
+
+	err = cfg.LoadIncludes(t.Context(), config.IncludeOptions{Client: client, LocalDir: t.TempDir()})
+	require.EqualError(t, err, "file [policy/org@HEAD:org.yml] may not include local file [/etc/passwd]; only configuration files read from disk may include local files")
+}
+
+func TestConfig_LoadIncludes_remote(t *testing.T) {
+	t.Parallel()
+
+	const content = "label:\n  - name: remote\n"
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/label.yml" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(server.Close)
+
+	sum := sha256.Sum256([]byte(content))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		include   config.Include
+		wantError string
+	}{
+		{name: "unpinned", include: config.Include{Remote: server.URL + "/label.yml"}},
+		{name: "pinned", include: config.Include{Remote: server.URL + "/label.yml", Checksum: checksum}},
+		{
+			name:      "checksum mismatch",
+			include:   config.Include{Remote: server.URL + "/label.yml", Checksum: "sha256:" + strings.Repeat("0", 64)},
+			wantError: "checksum mismatch, expected sha256:" + strings.Repeat("0", 64) + " but got " + checksum,
+		},
+		{name: "missing file", include: config.Include{Remote: server.URL + "/missing.yml"}, wantError: "got status code 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.Config{Includes: []config.Include{tt.include}}
+
+			err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{HTTPClient: server.Client()})
+			if len(tt.wantError) > 0 {
+				require.ErrorContains(t, err, tt.wantError)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, []string{"remote"}, labelNames(cfg))
+			require.Empty(t, cfg.Includes)
+		})
+	}
+}
+
+// Untrusted configurations, like the one of a repository evaluated by the server, may only include URLs in the
+// allowlist, even when the policy does not restrict anything else, so they can't make the server send requests to any URL
+func TestConfig_LoadIncludes_untrustedRemote(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "label:\n  - name: remote\n")
+	}))
+	t.Cleanup(server.Close)
+
+	global := config.Include{Project: "policy/org", Files: []string{"org.yml"}}
+
+	client := &includeClient{files: map[string]string{
+		"policy/org@HEAD:org.yml":   "include:\n  - remote: " + server.URL + "/org.yml\n",
+		"team/repo@HEAD:nested.yml": "include:\n  - remote: " + server.URL + "/nested.yml\n",
+	}}
+
+	tests := []struct {
+		name      string
+		policy    *config.IncludePolicy
+		include   config.Include
+		wantError string
+	}{
+		{
+			name:      "no policy",
+			include:   config.Include{Remote: server.URL + "/label.yml"},
+			wantError: "include is not allowed by the 'include_policy': remote [" + server.URL + "/label.yml] must be in the allowlist of the global configuration to be included by a repository",
+		},
+		{
+			name:      "policy without allowlist",
+			policy:    &config.IncludePolicy{},
+			include:   config.Include{Remote: server.URL + "/label.yml"},
+			wantError: "must be in the allowlist of the global configuration",
+		},
+		{
+			name:      "nested in an untrusted include",
+			include:   config.Include{Project: "team/repo", Files: []string{"nested.yml"}},
+			wantError: "remote [" + server.URL + "/nested.yml] must be in the allowlist of the global configuration",
+		},
+		{
+			name:    "in the allowlist",
+			policy:  &config.IncludePolicy{Allow: []config.IncludePolicySource{{Remote: server.URL + "/*"}}},
+			include: config.Include{Remote: server.URL + "/label.yml"},
+		},
+		{name: "nested in a trusted include", include: global},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.Config{IncludePolicy: tt.policy, Includes: []config.Include{tt.include}}
+
+			err := cfg.LoadIncludes(t.Context(), config.IncludeOptions{
+				Client:     client,
+				HTTPClient: server.Client(),
+				Trusted: func(include config.Include) bool {
+					return include.Project == global.Project
+				},
+			})
+			if len(tt.wantError) > 0 {
+				require.ErrorIs(t, err, config.ErrIncludeNotAllowed)
+				require.ErrorContains(t, err, tt.wantError)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, []string{"remote"}, labelNames(cfg))
+		})
+	}
+}
+
+func TestInclude_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		include   config.Include
+		wantError string
+	}{
+		{name: "project", include: config.Include{Project: "policy/org", Files: []string{"org.yml"}, Ref: scm.Ptr("v1")}},
+		{name: "local", include: config.Include{Local: "policy/org.yml"}},
+		{name: "remote", include: config.Include{Remote: "https://example.com/org.yml", Checksum: "sha256:" + strings.Repeat("a", 64)}},
+		{name: "no source", include: config.Include{}, wantError: "an include must have exactly one of 'project', 'local' or 'remote'"},
+		{name: "two sources", include: config.Include{Project: "policy/org", Local: "org.yml"}, wantError: "an include must have exactly one of 'project', 'local' or 'remote'"},
+		{name: "files without project", include: config.Include{Local: "org.yml", Files: []string{"org.yml"}}, wantError: "'files' and 'ref' are only supported by 'project' includes"},
+		{name: "checksum without remote", include: config.Include{Local: "org.yml", Checksum: "sha256:" + strings.Repeat("a", 64)}, wantError: "'checksum' is only supported by 'remote' includes"},
+		{name: "invalid checksum", include: config.Include{Remote: "https://example.com/org.yml", Checksum: "md5:abc"}, wantError: "invalid checksum [md5:abc], it must be in the format sha256:<hex>"},
+		{name: "plain http", include: config.Include{Remote: "http://example.com/org.yml"}, wantError: "invalid remote [http://example.com/org.yml], it must be an https:// URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.include.Validate()
+			if len(tt.wantError) > 0 {
+				require.EqualError(t, err, tt.wantError)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -12,9 +12,11 @@ import (
 	"github.com/expr-lang/expr/vm"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/stdlib"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	"github.com/jippi/scm-engine/pkg/tui"
 	"github.com/jippi/scm-engine/pkg/types"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // labelType is a custom type for our enum
@@ -27,16 +29,25 @@ const (
 
 type Labels []*Label
 
-func (labels Labels) Evaluate(ctx context.Context, evalContext scm.EvalContext) ([]scm.EvaluationResult, error) {
+// Evaluate evaluates the labels, where options are added to the expr-lang options every script is compiled with,
+// like the compiled [Definitions] of the configuration
+func (labels Labels) Evaluate(ctx context.Context, evalContext scm.EvalContext, options ...expr.Option) ([]scm.EvaluationResult, error) {
 	var results []scm.EvaluationResult
 
 	// Evaluate labels
 	for _, label := range labels {
+		if label.Disabled {
+			continue
+		}
+
 		ctx := slogctx.With(ctx, slog.String("label_name", label.Name))
 
 		slogctx.Debug(ctx, "Evaluating label")
 
-		evaluationResult, err := label.Evaluate(ctx, evalContext)
+		ctx, span := tracing.Start(ctx, "EvaluateLabel", attribute.String("scm_engine.label", label.Name))
+		evaluationResult, err := label.Evaluate(ctx, evalContext, options...)
+		tracing.End(span, err)
+
 		if err != nil {
 			return nil, fmt.Errorf("label: %s; %w", label.Name, err)
 		}
@@ -119,6 +130,16 @@ type Label struct {
 	// See: https://jippi.github.io/scm-engine/configuration/#label.skip_if
 	SkipIf string `json:"skip_if,omitempty" yaml:"skip_if,omitempty"`
 
+	// (Optional) Remove the label with the same name inherited from the global configuration.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#label.disabled
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	// (Optional) Prevent repository configuration files from overriding or disabling the label. Only used from the global configuration file.
+	//
+	// See: https://jippi.github.io/scm-engine/configuration/#label.locked
+	Locked bool `json:"locked,omitempty" yaml:"locked,omitempty"`
+
 	//
 	// -- Internal state
 	//
@@ -132,11 +153,21 @@ type Label struct {
 	expectedReturnType any `json:"-" yaml:"-"`
 }
 
-func (p *Label) Setup(evalContext scm.EvalContext) error {
+func (p *Label) Setup(evalContext scm.EvalContext, options ...expr.Option) error {
+	_, _, err := p.compile(evalContext, options...)
+
+	return err
+}
+
+// compile returns the compiled [Script] and [SkipIf] scripts.
+//
+// Scripts compiled with options, like the [Definitions] of the configuration, are not kept on the label, since
+// labels of the global configuration are shared by every evaluation, and the definitions differ between them.
+func (p *Label) compile(evalContext scm.EvalContext, options ...expr.Option) (script, skipIf *vm.Program, err error) {
 	var scriptReturnType expr.Option
 
 	if len(p.Script) == 0 {
-		return errors.New("required 'script' field is empty")
+		return nil, nil, errors.New("required 'script' field is empty")
 	}
 
 	// Default behavior is conditional labels
@@ -149,7 +180,7 @@ func (p *Label) Setup(evalContext scm.EvalContext) error {
 	switch p.Strategy {
 	case GenerateLabels:
 		if p.Name != "" {
-			return fmt.Errorf("[name] may only be specified when using [type: %q]", ConditionalLabel)
+			return nil, nil, fmt.Errorf("[name] may only be specified when using [type: %q]", ConditionalLabel)
 		}
 
 		p.expectedReturnType = []string{}
@@ -157,69 +188,82 @@ func (p *Label) Setup(evalContext scm.EvalContext) error {
 
 	case ConditionalLabel:
 		if p.Name == "" {
-			return fmt.Errorf("[name] is required when using [type: %q]", ConditionalLabel)
+			return nil, nil, fmt.Errorf("[name] is required when using [type: %q]", ConditionalLabel)
 		}
 
 		p.expectedReturnType = true
 		scriptReturnType = expr.AsBool()
 
 	default:
-		return fmt.Errorf("unknown label [type] %q. use %q or %q", p.Strategy, GenerateLabels, ConditionalLabel)
+		return nil, nil, fmt.Errorf("unknown label [type] %q. use %q or %q", p.Strategy, GenerateLabels, ConditionalLabel)
 	}
 
-	var err error
+	if color := tui.Replace(p.Color); color != p.Color {
+		p.Color = color
+	}
 
-	if p.scriptCompiled == nil {
-		p.Color = tui.Replace(p.Color)
+	cache := len(options) == 0
 
-		opts := make([]expr.Option, 0, len(stdlib.Functions)+4)
+	script, skipIf = p.scriptCompiled, p.skipIfCompiled
+	if !cache {
+		script, skipIf = nil, nil
+	}
+
+	if script == nil {
+		opts := make([]expr.Option, 0, len(stdlib.Functions)+len(options)+4)
 		opts = append(opts, scriptReturnType, expr.Env(evalContext), stdlib.FunctionRenamer)
 		opts = append(opts, stdlib.Functions...)
+		opts = append(opts, options...)
 		opts = append(opts, expr.Patch(patcher.WithContext{Name: "ctx"}))
 
-		p.scriptCompiled, err = expr.Compile(p.Script, opts...)
+		script, err = expr.Compile(p.Script, opts...)
 		if err != nil {
-			return fmt.Errorf("could not compile 'script' into valid expr-lang syntax: %w", err)
+			return nil, nil, fmt.Errorf("could not compile 'script' into valid expr-lang syntax: %w", err)
 		}
 	}
 
-	if p.skipIfCompiled == nil && len(p.SkipIf) > 0 {
-		p.Color = tui.Replace(p.Color)
-
-		opts := make([]expr.Option, 0, len(stdlib.Functions)+4)
+	if skipIf == nil && len(p.SkipIf) > 0 {
+		opts := make([]expr.Option, 0, len(stdlib.Functions)+len(options)+4)
 		opts = append(opts, expr.AsBool(), expr.Env(evalContext), stdlib.FunctionRenamer)
 		opts = append(opts, stdlib.Functions...)
+		opts = append(opts, options...)
 		opts = append(opts, expr.Patch(patcher.WithContext{Name: "ctx"}))
 
-		p.skipIfCompiled, err = expr.Compile(p.SkipIf, opts...)
+		skipIf, err = expr.Compile(p.SkipIf, opts...)
 		if err != nil {
-			return fmt.Errorf("could not compile 'if' into valid expr-lang syntax: %w", err)
+			return nil, nil, fmt.Errorf("could not compile 'if' into valid expr-lang syntax: %w", err)
 		}
 	}
 
-	return nil
+	if cache {
+		p.scriptCompiled, p.skipIfCompiled = script, skipIf
+	}
+
+	return script, skipIf, nil
 }
 
-func (p *Label) ShouldSkip(ctx context.Context, evalContext scm.EvalContext) (bool, error) {
-	if err := p.Setup(evalContext); err != nil {
+func (p *Label) ShouldSkip(ctx context.Context, evalContext scm.EvalContext, options ...expr.Option) (bool, error) {
+	_, skipIf, err := p.compile(evalContext, options...)
+	if err != nil {
 		return true, err
 	}
 
-	return runAndCheckBool(ctx, p.skipIfCompiled, evalContext)
+	return runAndCheckBool(ctx, skipIf, evalContext)
 }
 
-func (p *Label) Evaluate(ctx context.Context, evalContext scm.EvalContext) ([]scm.EvaluationResult, error) {
-	if err := p.Setup(evalContext); err != nil {
+func (p *Label) Evaluate(ctx context.Context, evalContext scm.EvalContext, options ...expr.Option) ([]scm.EvaluationResult, error) {
+	script, skipIf, err := p.compile(evalContext, options...)
+	if err != nil {
 		return nil, fmt.Errorf("failed to initialize expr script engine: %w", err)
 	}
 
 	// Check if the label should be skipped
-	if skip, err := p.ShouldSkip(ctx, evalContext); err != nil || skip {
+	if skip, err := runAndCheckBool(ctx, skipIf, evalContext); err != nil || skip {
 		return nil, err
 	}
 
 	// Run the compiled expr-lang script
-	output, err := expr.Run(p.scriptCompiled, evalContext)
+	output, err := expr.Run(script, evalContext)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"slices"
+
+	"github.com/invopop/jsonschema"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// The ways [Config.Merge] can change an entry inherited from the base configuration
+const (
+	MergeOverridden = "overridden"
+	MergeDisabled   = "disabled"
+	MergeLocked     = "locked"
+)
+
+// MergeChange describes a label or action inherited from the base configuration that the other
+// configuration replaced or disabled, or tried to while it was locked, or a definition the other
+// configuration tried to replace
+type MergeChange struct {
+	// "label", "action" or "definition"
+	Kind string `json:"kind"`
+
+	// The name of the label, action or definition
+	Name string `json:"name"`
+
+	// [MergeOverridden], [MergeDisabled] or [MergeLocked]
+	Change string `json:"change"`
+}
+
+// mergeable is a named entry of a configuration, which a later configuration can override
+type mergeable interface {
+	mergeName() string
+	mergeDisabled() bool
+	mergeLocked() bool
+}
+
+// mergeEntries merges other on top of base: an entry with the same name replaces the inherited one
+// in place, unless the inherited entry is locked. Entries without a name, like generated labels,
+// are always appended.
+//
+// Disabled entries are kept, and skipped when evaluating, so they also disable entries from
+// includes that are loaded after merging.
+func mergeEntries[T mergeable](kind string, base, other []T) ([]T, []MergeChange) {
+	var (
+		result  = make([]T, 0, len(base)+len(other))
+		index   = make(map[string]int, len(base))
+		changes []MergeChange
+	)
+
+	for _, entry := range base {
+		if name := entry.mergeName(); len(name) > 0 {
+			if _, ok := index[name]; !ok {
+				index[name] = len(result)
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	for _, entry := range other {
+		name := entry.mergeName()
+
+		i, inherited := index[name]
+		if len(name) == 0 || !inherited {
+			result = append(result, entry)
+
+			continue
+		}
+
+		if result[i].mergeLocked() {
+			changes = append(changes, MergeChange{Kind: kind, Name: name, Change: MergeLocked})
+
+			continue
+		}
+
+		change := MergeOverridden
+		if entry.mergeDisabled() {
+			change = MergeDisabled
+		}
+
+		result[i] = entry
+		changes = append(changes, MergeChange{Kind: kind, Name: name, Change: change})
+	}
+
+	return result, changes
+}
+
+// includeEntries merges the entries of an included file into entries, with the same rules as [mergeEntries],
+// where entries take the place of the configuration including the file: its entries replace, or disable,
+// those with the same name in the included file, unless the included entry is locked, and locked entries
+// can't be replaced by the included file. Entries without a name are always appended.
+func includeEntries[T mergeable](kind string, entries, included []T) ([]T, []MergeChange) {
+	var (
+		result  = slices.Clone(entries)
+		index   = make(map[string]int, len(entries))
+		changes []MergeChange
+	)
+
+	for i, entry := range result {
+		if name := entry.mergeName(); len(name) > 0 {
+			if _, ok := index[name]; !ok {
+				index[name] = i
+			}
+		}
+	}
+
+	for _, entry := range included {
+		name := entry.mergeName()
+
+		i, exists := index[name]
+		if len(name) == 0 || !exists {
+			if len(name) > 0 {
+				index[name] = len(result)
+			}
+
+			result = append(result, entry)
+
+			continue
+		}
+
+		switch {
+		// The config, or a file included before, has a locked entry with the same name
+		case result[i].mergeLocked():
+			changes = append(changes, MergeChange{Kind: kind, Name: name, Change: MergeLocked})
+
+		// The included entry is locked, so the config may not replace or disable it
+		case entry.mergeLocked():
+			result[i] = entry
+			changes = append(changes, MergeChange{Kind: kind, Name: name, Change: MergeLocked})
+
+		case result[i].mergeDisabled():
+			changes = append(changes, MergeChange{Kind: kind, Name: name, Change: MergeDisabled})
+
+		default:
+			changes = append(changes, MergeChange{Kind: kind, Name: name, Change: MergeOverridden})
+		}
+	}
+
+	return result, changes
+}
+
+func (p *Label) mergeName() string   { return p.Name }
+func (p *Label) mergeDisabled() bool { return p.Disabled }
+func (p *Label) mergeLocked() bool   { return p.Locked }
+
+func (p Action) mergeName() string   { return p.Name }
+func (p Action) mergeDisabled() bool { return p.Disabled }
+func (p Action) mergeLocked() bool   { return p.Locked }
+
+func (Label) JSONSchemaExtend(schema *jsonschema.Schema)  { requireUnlessDisabled(schema) }
+func (Action) JSONSchemaExtend(schema *jsonschema.Schema) { requireUnlessDisabled(schema) }
+
+// requireUnlessDisabled only requires the 'name' of disabled entries, since they are never evaluated
+func requireUnlessDisabled(schema *jsonschema.Schema) {
+	// https://json-schema.org/understanding-json-schema/reference/conditionals#ifthenelse
+	schema.If = &jsonschema.Schema{
+		Required: []string{"disabled"},
+		Properties: orderedmap.New[string, *jsonschema.Schema](
+			orderedmap.WithInitialData(
+				orderedmap.Pair[string, *jsonschema.Schema]{
+					Key:   "disabled",
+					Value: &jsonschema.Schema{Const: true},
+				},
+			),
+		),
+	}
+	schema.Then = &jsonschema.Schema{Required: []string{"name"}}
+	schema.Else = &jsonschema.Schema{Required: schema.Required}
+	schema.Required = nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/patcher"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/stdlib"
+)
+
+// UpdateDescription implements the "update_description" action, shared by all providers.
+//
+// Each key in the step 'replace' dictionary found in the description is replaced with the
+// output of its expr script. Replacements build on the description from earlier steps, and
+// the update is left untouched when no key is found. The options are added to the expr-lang options
+// the scripts are compiled with, like the compiled [Definitions] of the configuration.
+func UpdateDescription(evalContext scm.EvalContext, update *scm.UpdateMergeRequestOptions, step scm.ActionStep, options ...expr.Option) error {
+	// Use the raw MR description
+	body := evalContext.GetDescription()
+
+	// Unless something else already updated the description in the Update struct
+	if update.Description != nil {
+		body = *update.Description
+	}
+
+	replacements, err := step.Get("replace")
+	if err != nil {
+		return err
+	}
+
+	replacementSlice, ok := replacements.(ActionStep)
+	if !ok {
+		return fmt.Errorf(`step field 'replace' must be a dictionary with string key and string values ("key": "value"), got: %T`, replacements)
+	}
+
+	replacedAnything := false
+
+	// Replace in a stable order, so overlapping keys always produce the same description
+	for _, key := range slices.Sorted(maps.Keys(replacementSlice)) {
+		script := replacementSlice[key]
+
+		// If the replacement key do not exist; we can skip the replacement logic entirely!
+		if !strings.Contains(body, key) {
+			continue
+		}
+
+		replacedAnything = true
+
+		// Build the ExprLang VM program
+		opts := make([]expr.Option, 0, len(stdlib.Functions)+len(options)+5)
+		opts = append(opts, expr.AsKind(reflect.TypeFor[string]().Kind()), expr.Env(evalContext), stdlib.FunctionRenamer)
+		opts = append(opts, stdlib.Functions...)
+		opts = append(opts, options...)
+		opts = append(opts, expr.Patch(patcher.WithContext{Name: "ctx"}))
+
+		program, err := expr.Compile(fmt.Sprintf("%s", script), opts...)
+		if err != nil {
+			return fmt.Errorf("could not evaluate value for 'replace' key '%s': %w", key, err)
+		}
+
+		output, err := expr.Run(program, evalContext)
+		if err != nil {
+			return err
+		}
+
+		switch val := output.(type) {
+		case string:
+			body = strings.ReplaceAll(body, key, val)
+
+		default:
+			return fmt.Errorf("'replace' value for key '%s' did not return a string, got %T", key, output)
+		}
+	}
+
+	// Don't update the body if there were no replacements
+	if !replacedAnything {
+		return nil
+	}
+
+	update.Description = &body
+
+	return nil
+}
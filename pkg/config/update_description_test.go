@@ -0,0 +1,42 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/scm/gitlab"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateDescription_scriptsReadTheContext(t *testing.T) {
+	t.Parallel()
+
+	evalContext := &gitlab.Context{
+		MergeRequest: &gitlab.ContextMergeRequest{Description: scm.Ptr("Labels: ${{LABELS}}"), Labels: []gitlab.ContextLabel{{Title: "bug"}}},
+	}
+
+	update := &scm.UpdateMergeRequestOptions{}
+
+	err := config.UpdateDescription(evalContext, update, config.ActionStep{
+		"replace": config.ActionStep{"${{LABELS}}": `join(map(merge_request.labels, .title), ", ")`},
+	})
+	require.NoError(t, err)
+	require.Equal(t, scm.Ptr("Labels: bug"), update.Description)
+}
+
+// Keys are replaced in sorted order, so overlapping keys always give the same result
+func TestUpdateDescription_overlappingKeysAreStable(t *testing.T) {
+	t.Parallel()
+
+	for range 20 {
+		evalContext := &gitlab.Context{MergeRequest: &gitlab.ContextMergeRequest{Description: scm.Ptr("${{A}}")}}
+		update := &scm.UpdateMergeRequestOptions{}
+
+		err := config.UpdateDescription(evalContext, update, config.ActionStep{
+			"replace": config.ActionStep{"${{A}}": `"${{B}}"`, "${{B}}": `"b"`},
+		})
+		require.NoError(t, err)
+		require.Equal(t, scm.Ptr("b"), update.Description)
+	}
+}
@@ -0,0 +1,387 @@
+// Package eventstore persists webhook events between receiving them and finishing
+// their evaluation, so they survive restarts, can be retried, and end up in a
+// dead-letter list when they keep failing.
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+const (
+	// StatusPending events are waiting for their next attempt
+	StatusPending = "pending"
+
+	// StatusProcessing events are handed to a worker
+	StatusProcessing = "processing"
+
+	// StatusDead events failed too many times, and are only retried when requeued
+	StatusDead = "dead"
+)
+
+// ErrNotFound is returned when an event does not exist, or does not have the expected status
+var ErrNotFound = errors.New("event not found")
+
+// Event is a single webhook delivery, stored exactly as it was received
+type Event struct {
+	ID        int64
+	Provider  string
+	EventType string
+	Payload   []byte
+
+	// DedupeKey identifies the Merge Request the event is for; events with the same
+	// key can be collapsed by [Store.Debounce]. Empty when the event can't be collapsed
+	DedupeKey string
+
+	// CommitSHA overrides the commit SHA in the payload, when not empty; collapsed events
+	// keep the most relevant payload, which isn't always the one with the latest commit
+	CommitSHA string
+
+	Status        string
+	Attempts      int
+	LastError     string
+	ReceivedAt    time.Time
+	NextAttemptAt time.Time
+}
+
+// Store is a SQLite backed event store.
+//
+// SQLite (rather than a single-process database like bbolt) allows the CLI to inspect
+// and requeue dead letters while the server is running.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS events (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	provider        TEXT    NOT NULL,
+	event_type      TEXT    NOT NULL,
+	payload         BLOB    NOT NULL,
+	dedupe_key      TEXT    NOT NULL DEFAULT '',
+	commit_sha      TEXT    NOT NULL DEFAULT '',
+	status          TEXT    NOT NULL,
+	attempts        INTEGER NOT NULL DEFAULT 0,
+	last_error      TEXT    NOT NULL DEFAULT '',
+	received_at     INTEGER NOT NULL,
+	next_attempt_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_status_next_attempt_at ON events (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS events_dedupe_key ON events (dedupe_key, status);
+`
+
+// Open opens (and creates if missing) the event store at path.
+//
+// An empty path opens an in-memory store, which is lost when the process exits.
+func Open(ctx context.Context, path string) (*Store, error) {
+	dsn := "file::memory:"
+	if len(path) > 0 {
+		dsn = "file:" + (&url.URL{Path: path}).EscapedPath()
+	}
+
+	// Wait for locks held by other processes (like the CLI) instead of failing right away
+	dsn += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event store: %w", err)
+	}
+
+	// A single connection serializes writes within the process, and keeps the
+	// in-memory database alive (every connection would otherwise get its own)
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("could not create event store schema: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Insert stores a newly received event as being processed, and sets its ID
+func (s *Store) Insert(ctx context.Context, event *Event) error {
+	now := time.Now()
+
+	result, err := s.db.ExecContext(
+		ctx,
+		insertEvent,
+		event.Provider, event.EventType, event.Payload, event.DedupeKey, event.CommitSHA, StatusProcessing, now.UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not store event: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("could not read stored event ID: %w", err)
+	}
+
+	event.ID = id
+	event.Status = StatusProcessing
+	event.ReceivedAt = time.UnixMilli(now.UnixMilli())
+	event.NextAttemptAt = event.ReceivedAt
+
+	return nil
+}
+
+// Debounce stores a newly received event as pending until notBefore, unless a pending event
+// with the same key is already waiting for its first attempt. In that case the two events are
+// collapsed into the waiting one, which keeps its place in time, and true is returned.
+//
+// merge receives the waiting and the received event, and returns the event type, payload
+// and commit SHA to keep.
+func (s *Store) Debounce(ctx context.Context, event *Event, notBefore time.Time, merge func(waiting, received Event) Event) (bool, error) {
+	if len(event.DedupeKey) == 0 {
+		return false, errors.New("can not debounce an event without a dedupe key")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not debounce event: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT `+columns+` FROM events WHERE dedupe_key = ? AND status = ? AND attempts = 0 ORDER BY id DESC LIMIT 1`,
+		event.DedupeKey, StatusPending,
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not debounce event: %w", err)
+	}
+
+	waiting, err := scanEvents(rows)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+
+	if len(waiting) == 0 {
+		result, err := tx.ExecContext(
+			ctx,
+			insertEvent,
+			event.Provider, event.EventType, event.Payload, event.DedupeKey, event.CommitSHA, StatusPending, now.UnixMilli(), notBefore.UnixMilli(),
+		)
+		if err != nil {
+			return false, fmt.Errorf("could not store event: %w", err)
+		}
+
+		if event.ID, err = result.LastInsertId(); err != nil {
+			return false, fmt.Errorf("could not read stored event ID: %w", err)
+		}
+
+		event.Status = StatusPending
+		event.ReceivedAt = time.UnixMilli(now.UnixMilli())
+		event.NextAttemptAt = time.UnixMilli(notBefore.UnixMilli())
+
+		return false, tx.Commit()
+	}
+
+	merged := merge(waiting[0], *event)
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE events SET event_type = ?, payload = ?, commit_sha = ? WHERE id = ?`,
+		merged.EventType, merged.Payload, merged.CommitSHA, waiting[0].ID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not collapse event into event [%d]: %w", waiting[0].ID, err)
+	}
+
+	*event = waiting[0]
+	event.EventType = merged.EventType
+	event.Payload = merged.Payload
+	event.CommitSHA = merged.CommitSHA
+
+	return true, tx.Commit()
+}
+
+// Delete removes the event, regardless of its status
+func (s *Store) Delete(ctx context.Context, id int64) error {
+	return s.exec(ctx, id, `DELETE FROM events WHERE id = ?`, id)
+}
+
+// ClaimDue marks up to limit pending events that are due for an attempt as being
+// processed, and returns them oldest first
+func (s *Store) ClaimDue(ctx context.Context, now time.Time, limit int) ([]Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not claim due events: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT `+columns+` FROM events WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		StatusPending, now.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not claim due events: %w", err)
+	}
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		if _, err := tx.ExecContext(ctx, `UPDATE events SET status = ? WHERE id = ?`, StatusProcessing, events[i].ID); err != nil {
+			return nil, fmt.Errorf("could not claim event [%d]: %w", events[i].ID, err)
+		}
+
+		events[i].Status = StatusProcessing
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not claim due events: %w", err)
+	}
+
+	return events, nil
+}
+
+// Retry records a failed attempt, and schedules the next one
+func (s *Store) Retry(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt time.Time) error {
+	return s.exec(
+		ctx,
+		id,
+		`UPDATE events SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+		StatusPending, attempts, lastError, nextAttemptAt.UnixMilli(), id,
+	)
+}
+
+// Bury records the final failed attempt, and moves the event to the dead letters
+func (s *Store) Bury(ctx context.Context, id int64, attempts int, lastError string) error {
+	return s.exec(
+		ctx,
+		id,
+		`UPDATE events SET status = ?, attempts = ?, last_error = ? WHERE id = ?`,
+		StatusDead, attempts, lastError, id,
+	)
+}
+
+// Release hands a claimed event back without counting it as an attempt,
+// for example when no worker could take it
+func (s *Store) Release(ctx context.Context, id int64) error {
+	return s.exec(ctx, id, `UPDATE events SET status = ? WHERE id = ? AND status = ?`, StatusPending, id, StatusProcessing)
+}
+
+// ReleaseAll hands back every claimed event; used on startup, to replay the events that
+// were being processed when the previous process stopped
+func (s *Store) ReleaseAll(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE events SET status = ? WHERE status = ?`, StatusPending, StatusProcessing)
+	if err != nil {
+		return 0, fmt.Errorf("could not release events: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Requeue moves a dead letter back to the pending events, with a fresh set of attempts
+func (s *Store) Requeue(ctx context.Context, id int64) error {
+	return s.exec(
+		ctx,
+		id,
+		`UPDATE events SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?`,
+		StatusPending, time.Now().UnixMilli(), id, StatusDead,
+	)
+}
+
+// DeleteDead removes a dead letter
+func (s *Store) DeleteDead(ctx context.Context, id int64) error {
+	return s.exec(ctx, id, `DELETE FROM events WHERE id = ? AND status = ?`, id, StatusDead)
+}
+
+// Get returns a single event
+func (s *Store) Get(ctx context.Context, id int64) (*Event, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+columns+` FROM events WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not read event [%d]: %w", id, err)
+	}
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("event [%d]: %w", id, ErrNotFound)
+	}
+
+	return &events[0], nil
+}
+
+// List returns the events with the given status, oldest first
+func (s *Store) List(ctx context.Context, status string) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+columns+` FROM events WHERE status = ? ORDER BY id`, status)
+	if err != nil {
+		return nil, fmt.Errorf("could not list %s events: %w", status, err)
+	}
+
+	return scanEvents(rows)
+}
+
+const insertEvent = `INSERT INTO events (provider, event_type, payload, dedupe_key, commit_sha, status, received_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+const columns = `id, provider, event_type, payload, dedupe_key, commit_sha, status, attempts, last_error, received_at, next_attempt_at`
+
+func scanEvents(rows *sql.Rows) ([]Event, error) {
+	defer rows.Close()
+
+	var events []Event
+
+	for rows.Next() {
+		var (
+			event                     Event
+			receivedAt, nextAttemptAt int64
+		)
+
+		if err := rows.Scan(&event.ID, &event.Provider, &event.EventType, &event.Payload, &event.DedupeKey, &event.CommitSHA, &event.Status, &event.Attempts, &event.LastError, &receivedAt, &nextAttemptAt); err != nil {
+			return nil, fmt.Errorf("could not read event: %w", err)
+		}
+
+		event.ReceivedAt = time.UnixMilli(receivedAt)
+		event.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read events: %w", err)
+	}
+
+	return events, nil
+}
+
+// exec runs a statement that must affect exactly the event with the given ID
+func (s *Store) exec(ctx context.Context, id int64, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not update event [%d]: %w", id, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update event [%d]: %w", id, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event [%d]: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package eventstore_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/eventstore"
+	"github.com/stretchr/testify/require"
+)
+
+func open(t *testing.T, path string) *eventstore.Store {
+	t.Helper()
+
+	store, err := eventstore.Open(t.Context(), path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func insert(t *testing.T, store *eventstore.Store, eventType string) eventstore.Event {
+	t.Helper()
+
+	event := eventstore.Event{Provider: "gitlab", EventType: eventType, Payload: []byte(`{"event_type":"` + eventType + `"}`)}
+	require.NoError(t, store.Insert(t.Context(), &event))
+
+	return event
+}
+
+func ids(events []eventstore.Event) []int64 {
+	result := make([]int64, 0, len(events))
+
+	for _, event := range events {
+		result = append(result, event.ID)
+	}
+
+	return result
+}
+
+func TestStore_Insert(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+
+	first := insert(t, store, "merge_request")
+	second := insert(t, store, "note")
+
+	require.NotZero(t, first.ID)
+	require.Greater(t, second.ID, first.ID)
+
+	stored, err := store.Get(t.Context(), first.ID)
+	require.NoError(t, err)
+	require.Equal(t, "gitlab", stored.Provider)
+	require.Equal(t, "merge_request", stored.EventType)
+	require.JSONEq(t, `{"event_type":"merge_request"}`, string(stored.Payload))
+	require.Equal(t, eventstore.StatusProcessing, stored.Status)
+	require.Zero(t, stored.Attempts)
+	require.WithinDuration(t, time.Now(), stored.ReceivedAt, 5*time.Second)
+}
+
+func TestStore_Get_notFound(t *testing.T) {
+	t.Parallel()
+
+	_, err := open(t, "").Get(t.Context(), 42)
+	require.ErrorIs(t, err, eventstore.ErrNotFound)
+}
+
+func TestStore_ClaimDue(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+	now := time.Now()
+
+	due := insert(t, store, "due")
+	require.NoError(t, store.Retry(t.Context(), due.ID, 1, "boom", now.Add(-time.Minute)))
+
+	later := insert(t, store, "later")
+	require.NoError(t, store.Retry(t.Context(), later.ID, 1, "boom", now.Add(time.Hour)))
+
+	insert(t, store, "already claimed")
+
+	claimed, err := store.ClaimDue(t.Context(), now, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{due.ID}, ids(claimed))
+	require.Equal(t, eventstore.StatusProcessing, claimed[0].Status)
+	require.Equal(t, 1, claimed[0].Attempts)
+	require.Equal(t, "boom", claimed[0].LastError)
+
+	// Claimed events are not handed out twice
+	claimed, err = store.ClaimDue(t.Context(), now, 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	// ... unless they are released again
+	require.NoError(t, store.Release(t.Context(), due.ID))
+
+	claimed, err = store.ClaimDue(t.Context(), now, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{due.ID}, ids(claimed))
+}
+
+func TestStore_ClaimDue_respectsLimit(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+
+	for range 3 {
+		event := insert(t, store, "merge_request")
+		require.NoError(t, store.Release(t.Context(), event.ID))
+	}
+
+	claimed, err := store.ClaimDue(t.Context(), time.Now(), 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+}
+
+func TestStore_ReleaseAll(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+
+	insert(t, store, "merge_request")
+	insert(t, store, "note")
+
+	released, err := store.ReleaseAll(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), released)
+
+	pending, err := store.List(t.Context(), eventstore.StatusPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+}
+
+func TestStore_deadLetters(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+
+	event := insert(t, store, "merge_request")
+	alive := insert(t, store, "note")
+
+	// Only dead letters can be requeued or deleted as such
+	require.ErrorIs(t, store.Requeue(t.Context(), event.ID), eventstore.ErrNotFound)
+	require.ErrorIs(t, store.DeleteDead(t.Context(), alive.ID), eventstore.ErrNotFound)
+
+	require.NoError(t, store.Bury(t.Context(), event.ID, 5, "boom"))
+
+	dead, err := store.List(t.Context(), eventstore.StatusDead)
+	require.NoError(t, err)
+	require.Equal(t, []int64{event.ID}, ids(dead))
+	require.Equal(t, 5, dead[0].Attempts)
+	require.Equal(t, "boom", dead[0].LastError)
+
+	// Requeued dead letters are due right away, with a fresh set of attempts
+	require.NoError(t, store.Requeue(t.Context(), event.ID))
+
+	claimed, err := store.ClaimDue(t.Context(), time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{event.ID}, ids(claimed))
+	require.Zero(t, claimed[0].Attempts)
+
+	require.NoError(t, store.Bury(t.Context(), event.ID, 5, "boom"))
+	require.NoError(t, store.DeleteDead(t.Context(), event.ID))
+
+	_, err = store.Get(t.Context(), event.ID)
+	require.ErrorIs(t, err, eventstore.ErrNotFound)
+}
+
+// Events must survive the process stopping, and another process (like the CLI)
+// must be able to work on the same file while the server has it open.
+func TestStore_persistsToFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	server := open(t, path)
+	event := insert(t, server, "merge_request")
+	require.NoError(t, server.Bury(t.Context(), event.ID, 5, "boom"))
+
+	cli := open(t, path)
+	require.NoError(t, cli.Requeue(t.Context(), event.ID))
+	require.NoError(t, cli.Close())
+
+	require.NoError(t, server.Close())
+
+	restarted := open(t, path)
+
+	pending, err := restarted.List(t.Context(), eventstore.StatusPending)
+	require.NoError(t, err)
+	require.Equal(t, []int64{event.ID}, ids(pending))
+}
+
+func TestStore_Debounce(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "")
+	notBefore := time.Now().Add(time.Minute)
+
+	// keepReceived collapses events by keeping the newest one
+	keepReceived := func(_, received eventstore.Event) eventstore.Event { return received }
+
+	debounce := func(eventType, key string) (eventstore.Event, bool) {
+		t.Helper()
+
+		event := eventstore.Event{Provider: "gitlab", EventType: eventType, Payload: []byte(`{}`), DedupeKey: key, CommitSHA: eventType + "-sha"}
+
+		collapsed, err := store.Debounce(t.Context(), &event, notBefore, keepReceived)
+		require.NoError(t, err)
+
+		return event, collapsed
+	}
+
+	first, collapsed := debounce("merge_request", "gitlab/jippi/scm-engine/1")
+	require.False(t, collapsed)
+	require.Equal(t, eventstore.StatusPending, first.Status)
+	require.WithinDuration(t, notBefore, first.NextAttemptAt, time.Millisecond)
+
+	// Nothing is due before the debounce window is over
+	claimed, err := store.ClaimDue(t.Context(), time.Now(), 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	second, collapsed := debounce("note", "gitlab/jippi/scm-engine/1")
+	require.True(t, collapsed)
+	require.Equal(t, first.ID, second.ID)
+	require.Equal(t, "note", second.EventType)
+
+	other, collapsed := debounce("note", "gitlab/jippi/scm-engine/2")
+	require.False(t, collapsed, "events for other Merge Requests are kept apart")
+	require.NotEqual(t, first.ID, other.ID)
+
+	stored, err := store.Get(t.Context(), first.ID)
+	require.NoError(t, err)
+	require.Equal(t, "note", stored.EventType)
+	require.Equal(t, "note-sha", stored.CommitSHA)
+	require.Equal(t, first.NextAttemptAt, stored.NextAttemptAt, "collapsing must not push the event further out")
+
+	// Once the event is claimed by a worker, new events start a new window
+	claimed, err = store.ClaimDue(t.Context(), notBefore, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+
+	third, collapsed := debounce("merge_request", "gitlab/jippi/scm-engine/1")
+	require.False(t, collapsed)
+	require.NotEqual(t, first.ID, third.ID)
+
+	// ... as do events that have already been attempted
+	require.NoError(t, store.Retry(t.Context(), third.ID, 1, "boom", notBefore))
+
+	fourth, collapsed := debounce("merge_request", "gitlab/jippi/scm-engine/1")
+	require.False(t, collapsed)
+	require.NotEqual(t, third.ID, fourth.ID)
+}
+
+func TestStore_Debounce_requiresDedupeKey(t *testing.T) {
+	t.Parallel()
+
+	event := eventstore.Event{Provider: "github", EventType: "check_suite", Payload: []byte(`{}`)}
+
+	_, err := open(t, "").Debounce(t.Context(), &event, time.Now(), func(_, received eventstore.Event) eventstore.Event { return received })
+	require.ErrorContains(t, err, "without a dedupe key")
+}
@@ -0,0 +1,19 @@
+package history
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+// WithStore makes evaluations record their outcome in store
+func WithStore(ctx context.Context, store *Store) context.Context {
+	return context.WithValue(ctx, contextKey{}, store)
+}
+
+// FromContext returns the store evaluations are recorded in, or nil when history is disabled
+func FromContext(ctx context.Context) *Store {
+	store, _ := ctx.Value(contextKey{}).(*Store)
+
+	return store
+}
@@ -0,0 +1,269 @@
+// Package history persists what every evaluation of a Merge Request decided and did,
+// so "why did scm-engine add this label or close this MR?" can be answered after the fact.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// Record is the outcome of a single evaluation of a Merge Request
+type Record struct {
+	ID             int64  `json:"id"`
+	EvaluationID   string `json:"eval_id"`
+	Provider       string `json:"provider"`
+	ProjectID      string `json:"project_id"`
+	MergeRequestID string `json:"merge_request_id"`
+	CommitSHA      string `json:"commit_sha"`
+
+	// Trigger is what started the evaluation, like the webhook event type or "periodic_evaluation"
+	Trigger string `json:"trigger"`
+
+	// ConfigSourceRef is the git ref the configuration file was read from
+	ConfigSourceRef string `json:"config_source_ref"`
+
+	DryRun          bool            `json:"dry_run"`
+	MatchedLabels   []string        `json:"matched_labels"`
+	UnmatchedLabels []string        `json:"unmatched_labels"`
+	Actions         []Action        `json:"actions"`
+	Update          json.RawMessage `json:"update,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	StartedAt       time.Time       `json:"started_at"`
+	Duration        time.Duration   `json:"duration_ns"`
+}
+
+// Action is an action that was executed, with the steps it was configured with
+type Action struct {
+	Name  string           `json:"name"`
+	Group string           `json:"group,omitempty"`
+	Steps []map[string]any `json:"steps"`
+	Error string           `json:"error,omitempty"`
+}
+
+// Store is a SQLite backed evaluation history
+type Store struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS evaluations (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	eval_id           TEXT    NOT NULL,
+	provider          TEXT    NOT NULL,
+	project_id        TEXT    NOT NULL,
+	merge_request_id  TEXT    NOT NULL,
+	commit_sha        TEXT    NOT NULL DEFAULT '',
+	trigger_name      TEXT    NOT NULL DEFAULT '',
+	config_source_ref TEXT    NOT NULL DEFAULT '',
+	dry_run           INTEGER NOT NULL DEFAULT 0,
+	matched_labels    TEXT    NOT NULL DEFAULT '[]',
+	unmatched_labels  TEXT    NOT NULL DEFAULT '[]',
+	actions           TEXT    NOT NULL DEFAULT '[]',
+	update_payload    TEXT    NOT NULL DEFAULT '',
+	error             TEXT    NOT NULL DEFAULT '',
+	started_at        INTEGER NOT NULL,
+	duration          INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS evaluations_merge_request ON evaluations (provider, project_id, merge_request_id, id);
+CREATE INDEX IF NOT EXISTS evaluations_started_at ON evaluations (started_at);
+`
+
+// Open opens (and creates if missing) the evaluation history at path.
+//
+// An empty path opens an in-memory store, which is lost when the process exits.
+// When retention is set, records older than that are removed as new ones are inserted.
+func Open(ctx context.Context, path string, retention time.Duration) (*Store, error) {
+	dsn := "file::memory:"
+	if len(path) > 0 {
+		dsn = "file:" + (&url.URL{Path: path}).EscapedPath()
+	}
+
+	// Wait for locks held by other processes (like the CLI) instead of failing right away
+	dsn += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open evaluation history: %w", err)
+	}
+
+	// A single connection serializes writes within the process, and keeps the
+	// in-memory database alive (every connection would otherwise get its own)
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("could not create evaluation history schema: %w", err)
+	}
+
+	return &Store{db: db, retention: retention}, nil
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Insert stores the record, sets its ID, and removes records past the retention
+func (s *Store) Insert(ctx context.Context, record *Record) error {
+	matched, err := json.Marshal(nonNil(record.MatchedLabels))
+	if err != nil {
+		return fmt.Errorf("could not encode matched labels: %w", err)
+	}
+
+	unmatched, err := json.Marshal(nonNil(record.UnmatchedLabels))
+	if err != nil {
+		return fmt.Errorf("could not encode unmatched labels: %w", err)
+	}
+
+	actions, err := json.Marshal(nonNil(record.Actions))
+	if err != nil {
+		return fmt.Errorf("could not encode actions: %w", err)
+	}
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO evaluations (`+insertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.EvaluationID,
+		record.Provider,
+		record.ProjectID,
+		record.MergeRequestID,
+		record.CommitSHA,
+		record.Trigger,
+		record.ConfigSourceRef,
+		record.DryRun,
+		string(matched),
+		string(unmatched),
+		string(actions),
+		string(record.Update),
+		record.Error,
+		record.StartedAt.UnixMilli(),
+		record.Duration.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not store evaluation: %w", err)
+	}
+
+	if record.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("could not read stored evaluation ID: %w", err)
+	}
+
+	if s.retention > 0 {
+		if _, err := s.Prune(ctx, time.Now().Add(-s.retention)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prune removes the records of evaluations started before the given time
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM evaluations WHERE started_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("could not prune evaluation history: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Timeline returns the latest evaluations of a Merge Request, up to limit, oldest first
+func (s *Store) Timeline(ctx context.Context, provider, projectID, mergeRequestID string, limit int) ([]Record, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT * FROM (
+			SELECT id, `+insertColumns+` FROM evaluations
+			WHERE provider = ? AND project_id = ? AND merge_request_id = ?
+			ORDER BY id DESC LIMIT ?
+		) ORDER BY id`,
+		provider, projectID, mergeRequestID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not read evaluation history: %w", err)
+	}
+
+	return scanRecords(rows)
+}
+
+const insertColumns = `eval_id, provider, project_id, merge_request_id, commit_sha, trigger_name, config_source_ref, dry_run, matched_labels, unmatched_labels, actions, update_payload, error, started_at, duration`
+
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	records := []Record{}
+
+	for rows.Next() {
+		var (
+			record                      Record
+			matched, unmatched, actions string
+			update                      string
+			startedAt, duration         int64
+		)
+
+		err := rows.Scan(
+			&record.ID,
+			&record.EvaluationID,
+			&record.Provider,
+			&record.ProjectID,
+			&record.MergeRequestID,
+			&record.CommitSHA,
+			&record.Trigger,
+			&record.ConfigSourceRef,
+			&record.DryRun,
+			&matched,
+			&unmatched,
+			&actions,
+			&update,
+			&record.Error,
+			&startedAt,
+			&duration,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not read evaluation: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(matched), &record.MatchedLabels); err != nil {
+			return nil, fmt.Errorf("could not decode matched labels of evaluation [%d]: %w", record.ID, err)
+		}
+
+		if err := json.Unmarshal([]byte(unmatched), &record.UnmatchedLabels); err != nil {
+			return nil, fmt.Errorf("could not decode unmatched labels of evaluation [%d]: %w", record.ID, err)
+		}
+
+		if err := json.Unmarshal([]byte(actions), &record.Actions); err != nil {
+			return nil, fmt.Errorf("could not decode actions of evaluation [%d]: %w", record.ID, err)
+		}
+
+		if len(update) > 0 {
+			record.Update = json.RawMessage(update)
+		}
+
+		record.StartedAt = time.UnixMilli(startedAt)
+		record.Duration = time.Duration(duration) * time.Millisecond
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read evaluations: %w", err)
+	}
+
+	return records, nil
+}
+
+// nonNil makes sure empty lists are stored as '[]' rather than 'null'
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+
+	return list
+}
@@ -0,0 +1,148 @@
+package history_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/history"
+	"github.com/stretchr/testify/require"
+)
+
+func open(t *testing.T, path string, retention time.Duration) *history.Store {
+	t.Helper()
+
+	store, err := history.Open(t.Context(), path, retention)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func insert(t *testing.T, store *history.Store, mergeRequestID, evaluationID string, startedAt time.Time) history.Record {
+	t.Helper()
+
+	record := history.Record{
+		EvaluationID:   evaluationID,
+		Provider:       "gitlab",
+		ProjectID:      "jippi/scm-engine",
+		MergeRequestID: mergeRequestID,
+		StartedAt:      startedAt,
+	}
+	require.NoError(t, store.Insert(t.Context(), &record))
+
+	return record
+}
+
+func evaluationIDs(records []history.Record) []string {
+	result := make([]string, 0, len(records))
+
+	for _, record := range records {
+		result = append(result, record.EvaluationID)
+	}
+
+	return result
+}
+
+func TestStore_Insert(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "", 0)
+	startedAt := time.UnixMilli(time.Now().UnixMilli())
+
+	record := history.Record{
+		EvaluationID:    "eval",
+		Provider:        "gitlab",
+		ProjectID:       "jippi/scm-engine",
+		MergeRequestID:  "1",
+		CommitSHA:       "abc123",
+		Trigger:         "merge_request",
+		ConfigSourceRef: "HEAD",
+		DryRun:          true,
+		MatchedLabels:   []string{"bug"},
+		UnmatchedLabels: []string{"feature"},
+		Actions: []history.Action{
+			{Name: "close", Group: "state", Steps: []map[string]any{{"action": "close"}}},
+		},
+		Update:    json.RawMessage(`{"add_labels":["bug"]}`),
+		Error:     "boom",
+		StartedAt: startedAt,
+		Duration:  1500 * time.Millisecond,
+	}
+	require.NoError(t, store.Insert(t.Context(), &record))
+	require.NotZero(t, record.ID)
+
+	timeline, err := store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Equal(t, []history.Record{record}, timeline)
+}
+
+func TestStore_Insert_empty(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "", 0)
+	insert(t, store, "1", "eval", time.Now())
+
+	timeline, err := store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Len(t, timeline, 1)
+	require.Empty(t, timeline[0].MatchedLabels)
+	require.NotNil(t, timeline[0].MatchedLabels)
+	require.NotNil(t, timeline[0].Actions)
+	require.Nil(t, timeline[0].Update)
+}
+
+func TestStore_Timeline(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "", 0)
+	now := time.Now()
+
+	insert(t, store, "1", "first", now)
+	insert(t, store, "2", "other", now)
+	insert(t, store, "1", "second", now)
+	insert(t, store, "1", "third", now)
+
+	timeline, err := store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second", "third"}, evaluationIDs(timeline))
+
+	// The limit keeps the latest evaluations
+	timeline, err = store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"second", "third"}, evaluationIDs(timeline))
+
+	timeline, err = store.Timeline(t.Context(), "github", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Empty(t, timeline)
+}
+
+func TestStore_retention(t *testing.T) {
+	t.Parallel()
+
+	store := open(t, "", time.Hour)
+	now := time.Now()
+
+	insert(t, store, "1", "expired", now.Add(-2*time.Hour))
+	insert(t, store, "1", "recent", now.Add(-time.Minute))
+
+	timeline, err := store.Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"recent"}, evaluationIDs(timeline))
+}
+
+func TestStore_reopen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "history.db")
+
+	store := open(t, path, 0)
+	insert(t, store, "1", "eval", time.Now())
+	require.NoError(t, store.Close())
+
+	timeline, err := open(t, path, 0).Timeline(t.Context(), "gitlab", "jippi/scm-engine", "1", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"eval"}, evaluationIDs(timeline))
+}
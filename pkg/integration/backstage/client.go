@@ -45,6 +45,25 @@ func (c *Client) Client() *go_backstage.Client {
 	return c.wrapped
 }
 
+// Ping verifies the catalog can be reached (and the token is accepted) with a query matching no entities
+func (c *Client) Ping(ctx context.Context) error {
+	_, response, err := c.wrapped.Catalog.Entities.List(ctx, &backstage.ListEntityOptions{
+		Filters: []string{"kind=scm-engine-readiness-check"},
+		Fields:  []string{"metadata.name"},
+	})
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Backstage catalog responded with: %s", response.Status)
+	}
+
+	return nil
+}
+
 // GetEntityOwner returns the entity reference for the entity owner.
 //
 // Entity References https://backstage.io/docs/features/software-catalog/references#string-references
@@ -134,10 +153,24 @@ func (c *Client) ListGroupMembers(ctx context.Context, groupEntityRef *EntityRef
 
 func (c *Client) GetOwnersForGitLabProject(ctx context.Context, projectName string) ([]scm.Actor, error) {
 	// (kind=system AND metadata.name=?) OR (...)
-	entityRef, err := c.GetEntityOwner(ctx,
+	return c.getOwners(ctx, convertBackstageEntitiesToGitLabActors,
 		"kind=system,metadata.name="+projectName,
 		"kind=system,metadata.annotations.gitlab.com/project="+projectName,
 	)
+}
+
+// GetOwnersForGitHubProject returns the owners of a GitHub repository ("owner/repository") based on
+// the "github.com/project-slug" annotation of a system in the catalog.
+//
+// Users are mapped to GitHub users through their "github.com/user-login" annotation.
+func (c *Client) GetOwnersForGitHubProject(ctx context.Context, projectSlug string) ([]scm.Actor, error) {
+	return c.getOwners(ctx, convertBackstageEntitiesToGitHubActors,
+		"kind=system,metadata.annotations.github.com/project-slug="+projectSlug,
+	)
+}
+
+func (c *Client) getOwners(ctx context.Context, convert func(...go_backstage.Entity) []scm.Actor, filters ...string) ([]scm.Actor, error) {
+	entityRef, err := c.GetEntityOwner(ctx, filters...)
 	if err != nil {
 		return nil, err
 	}
@@ -150,14 +183,14 @@ func (c *Client) GetOwnersForGitLabProject(ctx context.Context, projectName stri
 			return nil, err
 		}
 
-		actors = convertBackstageEntitiesToGitLabActors(userEntity.Entity)
+		actors = convert(userEntity.Entity)
 	} else if entityRef.IsGroup() {
 		entities, err := c.ListGroupMembers(ctx, entityRef)
 		if err != nil {
 			return nil, err
 		}
 
-		actors = convertBackstageEntitiesToGitLabActors(entities...)
+		actors = convert(entities...)
 	}
 
 	return actors, nil
@@ -249,3 +282,21 @@ func convertBackstageEntitiesToGitLabActors(entities ...go_backstage.Entity) []s
 
 	return actors
 }
+
+// Helper function to convert Backstage user entities to GitHub actors
+func convertBackstageEntitiesToGitHubActors(entities ...go_backstage.Entity) []scm.Actor {
+	actors := make([]scm.Actor, 0, len(entities))
+
+	for _, entity := range entities {
+		login, ok := entity.Metadata.Annotations["github.com/user-login"]
+		if !ok {
+			continue
+		}
+
+		actors = append(actors, scm.Actor{
+			Username: login,
+		})
+	}
+
+	return actors
+}
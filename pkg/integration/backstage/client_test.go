@@ -2,6 +2,8 @@ package backstage_test
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	go_backstage "github.com/datolabs-io/go-backstage/v3"
@@ -240,3 +242,89 @@ func TestClient_GetOwnersForGitLabProject(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_GetOwnersForGitHubProject(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		arg     string
+		want    []scm.Actor
+		wantErr error
+	}{
+		{
+			name: "found",
+			arg:  "example/test-system",
+			want: []scm.Actor{
+				{
+					Username: "test-user",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := testutils.GetRecorder(t)
+			defer r.Stop()
+
+			client, err := backstage.NewClient(t.Context(), "https://backstage.example.com", "", r.GetDefaultClient())
+			require.NoError(t, err)
+
+			owners, err := client.GetOwnersForGitHubProject(t.Context(), tt.arg)
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.ErrorContains(t, tt.wantErr, err.Error())
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.DeepEqual(t, tt.want, owners)
+		})
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "reachable", status: http.StatusOK},
+		{name: "token rejected", status: http.StatusUnauthorized, wantErr: "401 Unauthorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/catalog/entities" {
+					w.WriteHeader(http.StatusNotFound)
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`[]`))
+			}))
+			t.Cleanup(server.Close)
+
+			client, err := backstage.NewClient(t.Context(), server.URL, "", server.Client())
+			require.NoError(t, err)
+
+			err = client.Ping(t.Context())
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
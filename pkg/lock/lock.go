@@ -0,0 +1,68 @@
+// Package lock provides the backends used to make sure a Merge Request is only
+// evaluated by one worker at a time.
+package lock
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Locker serializes work on a key
+type Locker interface {
+	// Lock blocks until the lock for key is acquired, or the context is done.
+	//
+	// The returned function releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+
+	// Held lists the keys that are currently locked, by anyone using the backend
+	Held(ctx context.Context) ([]string, error)
+
+	// Name identifies the backend in logs
+	Name() string
+}
+
+var _ Locker = (*Memory)(nil)
+
+// Memory is an in-process Locker; it only serializes work within a single scm-engine process
+type Memory struct {
+	locks sync.Map // Zero value is empty and ready for use
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Name() string {
+	return "memory"
+}
+
+func (m *Memory) Lock(ctx context.Context, key string) (func(), error) {
+	// A buffered channel rather than a sync.Mutex, so waiting can be cancelled
+	value, _ := m.locks.LoadOrStore(key, make(chan struct{}, 1))
+	sem := value.(chan struct{}) //nolint:forcetypeassert
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *Memory) Held(context.Context) ([]string, error) {
+	var keys []string
+
+	m.locks.Range(func(key, value any) bool {
+		if len(value.(chan struct{})) > 0 { //nolint:forcetypeassert
+			keys = append(keys, key.(string)) //nolint:forcetypeassert
+		}
+
+		return true
+	})
+
+	slices.Sort(keys)
+
+	return keys, nil
+}
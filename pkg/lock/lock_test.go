@@ -0,0 +1,211 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedis(t *testing.T, ttl time.Duration) (*lock.Redis, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	locker, err := lock.NewRedisFromURL("redis://"+server.Addr(), ttl)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { locker.Close() })
+
+	return locker, server
+}
+
+// Both backends must provide the same guarantees
+func TestLocker(t *testing.T) {
+	t.Parallel()
+
+	backends := map[string]func(t *testing.T) lock.Locker{
+		"memory": func(*testing.T) lock.Locker { return lock.NewMemory() },
+		"redis": func(t *testing.T) lock.Locker {
+			t.Helper()
+
+			locker, _ := newRedis(t, lock.DefaultRedisTTL)
+
+			return locker
+		},
+	}
+
+	for name, newLocker := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("serializes the same key", func(t *testing.T) {
+				t.Parallel()
+
+				locker := newLocker(t)
+
+				unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+				require.NoError(t, err)
+
+				acquired := make(chan func())
+
+				go func() {
+					unlock, err := locker.Lock(context.Background(), "gitlab/jippi/scm-engine/1")
+					if err == nil {
+						acquired <- unlock
+					}
+				}()
+
+				select {
+				case <-acquired:
+					require.FailNow(t, "the lock was acquired twice")
+
+				case <-time.After(100 * time.Millisecond):
+				}
+
+				unlock()
+
+				select {
+				case unlock := <-acquired:
+					unlock()
+
+				case <-time.After(5 * time.Second):
+					require.FailNow(t, "the lock was not acquired after being released")
+				}
+			})
+
+			t.Run("keeps keys apart", func(t *testing.T) {
+				t.Parallel()
+
+				locker := newLocker(t)
+
+				unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+				require.NoError(t, err)
+				defer unlock()
+
+				other, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/2")
+				require.NoError(t, err)
+				other()
+			})
+
+			t.Run("lists held keys", func(t *testing.T) {
+				t.Parallel()
+
+				locker := newLocker(t)
+
+				held, err := locker.Held(t.Context())
+				require.NoError(t, err)
+				require.Empty(t, held)
+
+				unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/2")
+				require.NoError(t, err)
+
+				other, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+				require.NoError(t, err)
+
+				held, err = locker.Held(t.Context())
+				require.NoError(t, err)
+				require.Equal(t, []string{"gitlab/jippi/scm-engine/1", "gitlab/jippi/scm-engine/2"}, held)
+
+				unlock()
+				other()
+
+				held, err = locker.Held(t.Context())
+				require.NoError(t, err)
+				require.Empty(t, held)
+			})
+
+			t.Run("stops waiting when the context is done", func(t *testing.T) {
+				t.Parallel()
+
+				locker := newLocker(t)
+
+				unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+				require.NoError(t, err)
+				defer unlock()
+
+				ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+				defer cancel()
+
+				_, err = locker.Lock(ctx, "gitlab/jippi/scm-engine/1")
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			})
+		})
+	}
+}
+
+// The lease of a replica that crashed while holding it must expire
+func TestRedis_leaseExpires(t *testing.T) {
+	t.Parallel()
+
+	locker, server := newRedis(t, time.Minute)
+
+	crashed, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.NoError(t, err)
+	defer crashed()
+
+	server.FastForward(time.Minute)
+
+	unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestRedis_renewsLeaseWhileHeld(t *testing.T) {
+	t.Parallel()
+
+	ttl := 300 * time.Millisecond
+	locker, server := newRedis(t, ttl)
+
+	unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.NoError(t, err)
+	defer unlock()
+
+	key := "scm-engine:lock:gitlab/jippi/scm-engine/1"
+
+	server.FastForward(ttl - 50*time.Millisecond)
+	require.Equal(t, 50*time.Millisecond, server.TTL(key))
+
+	// The lease is renewed every third of the TTL
+	require.Eventually(t, func() bool { return server.TTL(key) > 50*time.Millisecond }, 5*time.Second, 10*time.Millisecond)
+}
+
+// Releasing a lease that expired must not release the lock another replica took over
+func TestRedis_releaseOnlyOwnLease(t *testing.T) {
+	t.Parallel()
+
+	locker, server := newRedis(t, time.Minute)
+
+	unlock, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.NoError(t, err)
+
+	key := "scm-engine:lock:gitlab/jippi/scm-engine/1"
+	require.NoError(t, server.Set(key, "another-replica"))
+
+	unlock()
+
+	value, err := server.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, "another-replica", value)
+}
+
+func TestNewRedisFromURL_invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := lock.NewRedisFromURL("http://localhost", time.Minute)
+	require.ErrorContains(t, err, "invalid Redis URL")
+}
+
+func TestRedis_serverUnavailable(t *testing.T) {
+	t.Parallel()
+
+	locker := lock.NewRedis(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}), time.Minute)
+	t.Cleanup(func() { locker.Close() })
+
+	_, err := locker.Lock(t.Context(), "gitlab/jippi/scm-engine/1")
+	require.ErrorContains(t, err, "could not acquire lock lease")
+}
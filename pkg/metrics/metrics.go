@@ -0,0 +1,167 @@
+// Package metrics holds the Prometheus metrics exposed by the scm-engine server on "GET /metrics".
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "scm_engine"
+
+// Registry holds all scm-engine metrics, along with the Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// WebhookEventsReceived counts webhook deliveries by how the server responded to them.
+	//
+	// Labels: provider, event_type, outcome (accepted, ignored, queue_full, rejected)
+	WebhookEventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_received_total",
+		Help:      "Webhook deliveries received, by how they were handled.",
+	}, []string{"provider", "event_type", "outcome"})
+
+	// WebhookEventsProcessed counts attempts at processing stored webhook events.
+	//
+	// Labels: provider, event_type, outcome (succeeded, failed, retried, dead_lettered)
+	WebhookEventsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_processed_total",
+		Help:      "Attempts at processing webhook events, by outcome.",
+	}, []string{"provider", "event_type", "outcome"})
+
+	// EvaluationDuration observes how long evaluating a Merge Request took, including waiting for its lock.
+	//
+	// Labels: provider, outcome (success, error)
+	EvaluationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "evaluation_duration_seconds",
+		Help:      "Time spent evaluating a Merge Request.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12), // 100ms to ~3.5m
+	}, []string{"provider", "outcome"})
+
+	// Labels counts labels created or updated in the SCM.
+	//
+	// Labels: operation (created, updated)
+	Labels = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "labels_total",
+		Help:      "Labels created or updated.",
+	}, []string{"operation"})
+
+	// Actions counts actions applied to Merge Requests.
+	//
+	// Labels: action (the action name from the configuration file), outcome (success, error)
+	Actions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_total",
+		Help:      "Actions applied to Merge Requests, by action name.",
+	}, []string{"action", "outcome"})
+
+	// APIRequests counts HTTP requests made to the SCM API.
+	//
+	// Labels: provider, code (the HTTP status code, or "error" when no response was received)
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "HTTP requests made to the SCM API, by status code.",
+	}, []string{"provider", "code"})
+
+	// APIErrors counts HTTP requests to the SCM API that failed, or got a 4xx or 5xx response.
+	//
+	// Labels: provider
+	APIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_errors_total",
+		Help:      "HTTP requests made to the SCM API that failed or got an error response.",
+	}, []string{"provider"})
+
+	// PeriodicEvaluationDuration observes how long a periodic evaluation cycle took
+	PeriodicEvaluationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "periodic_evaluation_duration_seconds",
+		Help:      "Time spent on a periodic evaluation cycle.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12), // 1s to ~34m
+	})
+
+	// PeriodicEvaluationMergeRequests is the number of Merge Requests found by the latest periodic evaluation cycle
+	PeriodicEvaluationMergeRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "periodic_evaluation_merge_requests",
+		Help:      "Merge Requests found by the latest periodic evaluation cycle.",
+	})
+
+	// LockWaitDuration observes how long an evaluation waited for the lock on its Merge Request.
+	//
+	// Labels: backend (memory, redis)
+	LockWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lock_wait_duration_seconds",
+		Help:      "Time spent waiting for the lock on a Merge Request.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to ~4m
+	}, []string{"backend"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		WebhookEventsReceived,
+		WebhookEventsProcessed,
+		EvaluationDuration,
+		Labels,
+		Actions,
+		APIRequests,
+		APIErrors,
+		PeriodicEvaluationDuration,
+		PeriodicEvaluationMergeRequests,
+		LockWaitDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Outcome returns the "outcome" label value for an operation that returned err
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+// Transport wraps base so requests made through it are counted in [APIRequests] and [APIErrors]
+func Transport(provider string, base http.RoundTripper) http.RoundTripper {
+	return &transport{provider: provider, base: base}
+}
+
+type transport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+// RoundTrip implements [http.RoundTripper]
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		APIRequests.WithLabelValues(t.provider, "error").Inc()
+		APIErrors.WithLabelValues(t.provider).Inc()
+
+		return resp, err
+	}
+
+	APIRequests.WithLabelValues(t.provider, strconv.Itoa(resp.StatusCode)).Inc()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		APIErrors.WithLabelValues(t.provider).Inc()
+	}
+
+	return resp, nil
+}
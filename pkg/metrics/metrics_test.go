@@ -0,0 +1,87 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		wantCode  string
+		wantError bool
+	}{
+		{name: "success", status: http.StatusOK, wantCode: "200"},
+		{name: "not found", status: http.StatusNotFound, wantCode: "404", wantError: true},
+		{name: "server error", status: http.StatusBadGateway, wantCode: "502", wantError: true},
+		{name: "no response", err: errors.New("connection reset"), wantCode: "error", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// A unique provider keeps the metrics of the parallel tests apart
+			provider := t.Name()
+
+			client := &http.Client{
+				Transport: metrics.Transport(provider, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+
+					recorder := httptest.NewRecorder()
+					recorder.WriteHeader(tt.status)
+
+					return recorder.Result(), nil
+				})),
+			}
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://scm.example.com/api/v4/projects", nil)
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			require.InDelta(t, 1, testutil.ToFloat64(metrics.APIRequests.WithLabelValues(provider, tt.wantCode)), 0)
+
+			wantErrors := 0.0
+			if tt.wantError {
+				wantErrors = 1
+			}
+
+			require.InDelta(t, wantErrors, testutil.ToFloat64(metrics.APIErrors.WithLabelValues(provider)), 0)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	metrics.Actions.WithLabelValues("TestHandler", "success").Inc()
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `scm_engine_actions_total{action="TestHandler",outcome="success"} 1`)
+	require.Contains(t, recorder.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,343 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	go_github "github.com/google/go-github/v72/github"
+	"github.com/jippi/scm-engine/pkg/metrics"
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+	"golang.org/x/sync/singleflight"
+)
+
+// installationTokenRefreshWindow is how long before expiry an installation token is
+// replaced, so a token never expires in the middle of an evaluation
+const installationTokenRefreshWindow = 5 * time.Minute
+
+type installationIDContextKey struct{}
+
+// withInstallationID pins the GitHub App installation to use for API requests made with the context,
+// for requests that are not scoped to a single repository (e.g. listing the repositories of an installation)
+func withInstallationID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, installationIDContextKey{}, id)
+}
+
+type installationProjectContextKey struct{}
+
+// withInstallationProject makes API requests made with the context use the GitHub App installation of
+// project, for requests reading another repository than the one being evaluated (e.g. includes)
+func withInstallationProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, installationProjectContextKey{}, project)
+}
+
+// appTransport authenticates API requests as a GitHub App installation.
+//
+// The installation is resolved from the repository (project ID) in the request context, and
+// its access token is cached until shortly before it expires. Installation tokens can only access
+// the repositories of their installation, so reading another repository (e.g. for includes) uses the
+// installation of that repository, and fails when the App is not installed there.
+type appTransport struct {
+	appID      int64
+	privateKey *rsa.PrivateKey
+
+	// base is the transport used for all requests
+	base http.RoundTripper
+
+	// app is a client authenticated as the GitHub App itself (using a JWT), used to find
+	// installations and create installation access tokens
+	app *go_github.Client
+
+	// mu only guards the caches; it is never held during HTTP requests, so a slow token refresh
+	// for one installation does not hold up requests for others
+	mu            sync.Mutex
+	installations map[string]int64
+	tokens        map[int64]*go_github.InstallationToken
+
+	// lookups makes concurrent requests needing the same installation or token share a single HTTP request
+	lookups singleflight.Group
+}
+
+func newAppTransport(appID int64, privateKeyPEM, baseURL string) (*appTransport, error) {
+	privateKey, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &appTransport{
+		appID:         appID,
+		privateKey:    privateKey,
+		base:          metrics.Transport("github", http.DefaultTransport),
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]*go_github.InstallationToken),
+	}
+
+	transport.app, err = newRESTClient(&http.Client{Transport: &jwtTransport{app: transport}}, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return transport, nil
+}
+
+// RoundTrip implements [http.RoundTripper]
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	installationID, err := t.installationID(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+
+		return nil, err
+	}
+
+	token, err := t.installationToken(req.Context(), installationID)
+	if err != nil {
+		closeRequestBody(req)
+
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := t.base.RoundTrip(req)
+
+	// The token was revoked, or the App was reinstalled with a new installation; look both up again on the next request
+	if err == nil && response.StatusCode == http.StatusUnauthorized {
+		t.forget(req.Context(), installationID)
+	}
+
+	return response, err
+}
+
+// installationID returns the installation pinned in the context, or the installation of the repository in the context
+func (t *appTransport) installationID(ctx context.Context) (int64, error) {
+	if id, ok := ctx.Value(installationIDContextKey{}).(int64); ok {
+		return id, nil
+	}
+
+	project, ok := ctx.Value(installationProjectContextKey{}).(string)
+	if !ok {
+		project, ok = state.LookupProjectID(ctx)
+	}
+
+	if !ok {
+		return 0, errors.New("GitHub App authentication requires a repository or installation to be known for the request")
+	}
+
+	t.mu.Lock()
+	id, ok := t.installations[project]
+	t.mu.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	result, err, _ := t.lookups.Do("installation:"+project, func() (any, error) {
+		// Shared with concurrent requests, so one of them being canceled must not fail the others
+		ctx := context.WithoutCancel(ctx)
+
+		owner, repo, err := ParseProject(project)
+		if err != nil {
+			return int64(0), err
+		}
+
+		installation, _, err := t.app.Apps.FindRepositoryInstallation(ctx, owner, repo)
+		if err != nil {
+			return int64(0), fmt.Errorf("could not find GitHub App installation for repository [%s]: %w", project, err)
+		}
+
+		slogctx.Debug(ctx, "Found GitHub App installation for repository", slog.Int64("installation_id", installation.GetID()))
+
+		t.mu.Lock()
+		t.installations[project] = installation.GetID()
+		t.mu.Unlock()
+
+		return installation.GetID(), nil
+	})
+
+	return result.(int64), err //nolint:forcetypeassert // always an int64, see above
+}
+
+// installationToken returns a cached access token for the installation, creating a new one if
+// there is none or it's about to expire
+func (t *appTransport) installationToken(ctx context.Context, installationID int64) (string, error) {
+	t.mu.Lock()
+	token, ok := t.tokens[installationID]
+	t.mu.Unlock()
+
+	if ok && time.Until(token.GetExpiresAt().Time) > installationTokenRefreshWindow {
+		return token.GetToken(), nil
+	}
+
+	result, err, _ := t.lookups.Do("token:"+strconv.FormatInt(installationID, 10), func() (any, error) {
+		// Shared with concurrent requests, so one of them being canceled must not fail the others
+		ctx := context.WithoutCancel(ctx)
+
+		token, _, err := t.app.Apps.CreateInstallationToken(ctx, installationID, nil)
+		if err != nil {
+			// The installation was removed, e.g. when the App was reinstalled; look it up again on the next request
+			var errResponse *go_github.ErrorResponse
+			if errors.As(err, &errResponse) && errResponse.Response != nil {
+				switch errResponse.Response.StatusCode {
+				case http.StatusUnauthorized, http.StatusNotFound:
+					t.forget(ctx, installationID)
+				}
+			}
+
+			return "", fmt.Errorf("could not create access token for GitHub App installation [%d]: %w", installationID, err)
+		}
+
+		slogctx.Debug(ctx, "Created GitHub App installation access token", slog.Int64("installation_id", installationID), slog.Time("expires_at", token.GetExpiresAt().Time))
+
+		t.mu.Lock()
+		t.tokens[installationID] = token
+		t.mu.Unlock()
+
+		return token.GetToken(), nil
+	})
+
+	return result.(string), err //nolint:forcetypeassert // always a string, see above
+}
+
+// forget removes the cached token of the installation, and the repositories resolved to it
+func (t *appTransport) forget(ctx context.Context, installationID int64) {
+	slogctx.Debug(ctx, "Forgetting cached GitHub App installation", slog.Int64("installation_id", installationID))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.tokens, installationID)
+
+	for project, id := range t.installations {
+		if id == installationID {
+			delete(t.installations, project)
+		}
+	}
+}
+
+// listInstallations returns the IDs of every installation of the GitHub App
+func (t *appTransport) listInstallations(ctx context.Context) ([]int64, error) {
+	var (
+		result  []int64
+		options = &go_github.ListOptions{PerPage: 100}
+	)
+
+	for {
+		installations, response, err := t.app.Apps.ListInstallations(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("could not list GitHub App installations: %w", err)
+		}
+
+		for _, installation := range installations {
+			result = append(result, installation.GetID())
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+
+		options.Page = response.NextPage
+	}
+
+	return result, nil
+}
+
+// jwt creates a JSON Web Token authenticating as the GitHub App itself
+//
+// See: https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (t *appTransport) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		// Issued 60 seconds in the past to allow for clock drift
+		"iat": now.Add(-60 * time.Second).Unix(),
+		// GitHub allows at most 10 minutes into the future
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(t.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign GitHub App JWT: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtTransport authenticates API requests as the GitHub App itself
+type jwtTransport struct {
+	app *appTransport
+}
+
+// RoundTrip implements [http.RoundTripper]
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt(time.Now())
+	if err != nil {
+		closeRequestBody(req)
+
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return t.app.base.RoundTrip(req)
+}
+
+// closeRequestBody closes the body of a request that won't be sent, since a [http.RoundTripper]
+// must close it even when it returns an error
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// parsePrivateKey parses the PEM encoded private key GitHub generates for an App (PKCS#1),
+// or the same key converted to PKCS#8
+func parsePrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse GitHub App private key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key must be an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,403 @@
+//nolint:testpackage // the GitHub App transport and its token cache are unexported
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHubApp is a GitHub Enterprise Server stand-in that hands out installation tokens
+type fakeGitHubApp struct {
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	// tokenTTL is how long the installation tokens handed out are valid for
+	tokenTTL time.Duration
+
+	// slowTokens, when set, holds up creating tokens for installation 7 until it's closed
+	slowTokens chan struct{}
+
+	mu            sync.Mutex
+	lookups       int
+	tokensCreated int
+	authorization []string
+
+	// revoked answers the next API request with 401, like GitHub does for a revoked token
+	revoked bool
+
+	// uninstalled answers requests for installation 7 with 404, like GitHub does after the App was reinstalled
+	uninstalled bool
+}
+
+func newFakeGitHubApp(t *testing.T, tokenTTL time.Duration) (*fakeGitHubApp, *appTransport) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	fake := &fakeGitHubApp{t: t, key: key, tokenTTL: tokenTTL}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	transport, err := newAppTransport(1234, string(privateKeyPEM), server.URL+"/")
+	require.NoError(t, err)
+
+	return fake, transport
+}
+
+func (fake *fakeGitHubApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v3/app/installations/7/access_tokens" && fake.slowTokens != nil {
+		<-fake.slowTokens
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v3/repos/jippi/scm-engine/installation":
+		fake.requireJWT(r)
+		fake.lookups++
+
+		fmt.Fprint(w, `{"id": 7}`)
+
+	case "/api/v3/repos/policy/org/installation":
+		fake.requireJWT(r)
+		fake.lookups++
+
+		fmt.Fprint(w, `{"id": 8}`)
+
+	case "/api/v3/app/installations/7/access_tokens", "/api/v3/app/installations/8/access_tokens":
+		fake.requireJWT(r)
+
+		if fake.uninstalled && strings.Contains(r.URL.Path, "/7/") {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+
+			return
+		}
+
+		fake.tokensCreated++
+
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`, fake.tokensCreated, time.Now().Add(fake.tokenTTL).Format(time.RFC3339))
+
+	default:
+		fake.authorization = append(fake.authorization, r.Header.Get("Authorization"))
+
+		if fake.revoked {
+			fake.revoked = false
+
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+
+			return
+		}
+
+		fmt.Fprint(w, `{}`)
+	}
+}
+
+// requireJWT verifies the request is authenticated with a JWT signed by the App private key
+func (fake *fakeGitHubApp) requireJWT(r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	require.True(fake.t, ok)
+
+	parts := strings.Split(token, ".")
+	require.Len(fake.t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(fake.t, err)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(fake.t, rsa.VerifyPKCS1v15(&fake.key.PublicKey, crypto.SHA256, digest[:], signature))
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(fake.t, err)
+
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+
+	require.NoError(fake.t, json.Unmarshal(rawClaims, &claims))
+	require.Equal(fake.t, "1234", claims.Issuer)
+	require.Less(fake.t, claims.IssuedAt, time.Now().Unix())
+	require.LessOrEqual(fake.t, claims.ExpiresAt, time.Now().Add(10*time.Minute).Unix())
+}
+
+func doRequest(t *testing.T, client *http.Client, req *http.Request) {
+	t.Helper()
+
+	response, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+}
+
+// The installation and its access token are looked up once, and then reused for every request
+func TestAppTransport_cachesInstallationToken(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	client := &http.Client{Transport: transport}
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, transport.app.BaseURL.String()+"repos/jippi/scm-engine", nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+	}
+
+	require.Equal(t, 1, fake.lookups)
+	require.Equal(t, 1, fake.tokensCreated)
+	require.Equal(t, []string{"Bearer token-1", "Bearer token-1"}, fake.authorization)
+}
+
+// A token about to expire is replaced before it's used
+func TestAppTransport_refreshesExpiringToken(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, installationTokenRefreshWindow/2)
+	client := &http.Client{Transport: transport}
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, transport.app.BaseURL.String()+"repos/jippi/scm-engine", nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+	}
+
+	require.Equal(t, 1, fake.lookups)
+	require.Equal(t, 2, fake.tokensCreated)
+	require.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, fake.authorization)
+}
+
+// A pinned installation skips the repository lookup
+func TestAppTransport_pinnedInstallation(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(withInstallationID(t.Context(), 7), http.MethodGet, transport.app.BaseURL.String()+"installation/repositories", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+
+	require.Equal(t, 0, fake.lookups)
+	require.Equal(t, []string{"Bearer token-1"}, fake.authorization)
+}
+
+// A slow token refresh for one installation does not hold up requests for other installations
+func TestAppTransport_slowTokenDoesNotBlockOtherInstallations(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	fake.slowTokens = make(chan struct{})
+	client := &http.Client{Transport: transport}
+
+	slow := make(chan struct{})
+
+	go func() {
+		defer close(slow)
+
+		req, err := http.NewRequestWithContext(withInstallationID(t.Context(), 7), http.MethodGet, transport.app.BaseURL.String()+"installation/repositories", nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+	}()
+
+	req, err := http.NewRequestWithContext(withInstallationID(t.Context(), 8), http.MethodGet, transport.app.BaseURL.String()+"installation/repositories", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+
+	close(fake.slowTokens)
+	<-slow
+
+	require.Equal(t, 2, fake.tokensCreated)
+}
+
+// A revoked token is replaced, and the installation looked up again, on the next request
+func TestAppTransport_forgetsRevokedToken(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	fake.revoked = true
+	client := &http.Client{Transport: transport}
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, transport.app.BaseURL.String()+"repos/jippi/scm-engine", nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+	}
+
+	require.Equal(t, 2, fake.lookups)
+	require.Equal(t, 2, fake.tokensCreated)
+	require.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, fake.authorization)
+}
+
+// An installation that no longer exists, e.g. after the App was reinstalled, is looked up again on the next request
+func TestAppTransport_forgetsRemovedInstallation(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	fake.uninstalled = true
+	client := &http.Client{Transport: transport}
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, transport.app.BaseURL.String()+"repos/jippi/scm-engine", nil)
+	require.NoError(t, err)
+
+	_, err = client.Do(req) //nolint:bodyclose // the request never reaches the API
+	require.ErrorContains(t, err, "could not create access token for GitHub App installation [7]")
+
+	fake.mu.Lock()
+	fake.uninstalled = false
+	fake.mu.Unlock()
+
+	doRequest(t, client, req)
+
+	require.Equal(t, 2, fake.lookups)
+	require.Equal(t, []string{"Bearer token-1"}, fake.authorization)
+}
+
+func TestAppTransport_requiresRepositoryOrInstallation(t *testing.T) {
+	t.Parallel()
+
+	_, transport := newFakeGitHubApp(t, time.Hour)
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, transport.app.BaseURL.String()+"user", nil)
+	require.NoError(t, err)
+
+	_, err = client.Do(req) //nolint:bodyclose // the request never reaches the server
+	require.ErrorContains(t, err, "requires a repository or installation")
+}
+
+// Requests reading another repository, like includes, use the installation of that repository
+func TestAppTransport_installationProject(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	client := &http.Client{Transport: transport}
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+	for _, ctx := range []context.Context{ctx, withInstallationProject(ctx, "policy/org")} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, transport.app.BaseURL.String()+"repos/policy/org", nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+	}
+
+	require.Equal(t, 2, fake.lookups)
+	require.Equal(t, map[string]int64{"jippi/scm-engine": 7, "policy/org": 8}, transport.installations)
+	require.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, fake.authorization)
+}
+
+// closeRecorder is a request body recording whether it was closed
+type closeRecorder struct {
+	io.Reader
+
+	closed bool
+}
+
+func (body *closeRecorder) Close() error {
+	body.closed = true
+
+	return nil
+}
+
+// A RoundTripper must close the request body, even when the request is never sent
+func TestAppTransport_closesBodyOnError(t *testing.T) {
+	t.Parallel()
+
+	fake, transport := newFakeGitHubApp(t, time.Hour)
+	fake.uninstalled = true
+
+	tests := []struct {
+		name      string
+		ctx       context.Context //nolint:containedctx // the context decides which error the request fails with
+		wantError string
+	}{
+		{name: "unknown installation", ctx: t.Context(), wantError: "requires a repository or installation"},
+		{name: "token error", ctx: withInstallationID(t.Context(), 7), wantError: "could not create access token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			body := &closeRecorder{Reader: strings.NewReader("{}")}
+
+			req, err := http.NewRequestWithContext(tt.ctx, http.MethodPost, transport.app.BaseURL.String()+"user", body)
+			require.NoError(t, err)
+
+			_, err = transport.RoundTrip(req) //nolint:bodyclose // the request never reaches the server
+			require.ErrorContains(t, err, tt.wantError)
+			require.True(t, body.closed)
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	t.Run("PKCS#1", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+		require.NoError(t, err)
+		require.True(t, key.Equal(got))
+	})
+
+	t.Run("PKCS#8", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+		require.NoError(t, err)
+		require.True(t, key.Equal(got))
+	})
+
+	t.Run("not PEM encoded", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := parsePrivateKey("not a key")
+		require.ErrorContains(t, err, "not PEM encoded")
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")})))
+		require.ErrorContains(t, err, "could not parse GitHub App private key")
+	})
+}
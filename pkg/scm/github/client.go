@@ -3,28 +3,115 @@ package github
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/aquilax/truncate"
 	go_github "github.com/google/go-github/v72/github"
+	"github.com/hasura/go-graphql-client"
+	"github.com/jippi/scm-engine/pkg/integration/backstage"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+	"golang.org/x/oauth2"
 )
 
+// Skip the "update commit status" step if the HEAD commit status check rollup is any
+// of the configured options
+//
+// Disable updating commit statuses when running periodic evaluations in the background
+// to avoid sending "checks failed" notifications to users every time the background
+// evaluation process runs.
+//
+// Possible values:
+//
+// - ERROR
+// - EXPECTED
+// - FAILURE
+// - PENDING
+// - SUCCESS
+var SkipPipelineUpdateIfPeriodicAndStatusCheckRollupIs = []string{
+	"ERROR",
+	"FAILURE",
+}
+
+var pipelineName = "scm-engine"
+
+// DefaultBaseURL is the REST API base URL for github.com
+const DefaultBaseURL = "https://api.github.com/"
+
 // Ensure the GitLab client implements the [scm.Client]
 var _ scm.Client = (*Client)(nil)
 
 // Client is a wrapper around the GitLab specific implementation of [scm.Client] interface
 type Client struct {
-	wrapped *go_github.Client
+	wrapped   *go_github.Client
+	backstage *backstage.Client
+
+	// app is set when authenticating as a GitHub App
+	app *appTransport
+
+	// checkRuns maps an evaluation ID to the check run created for it by [Client.Start]
+	checkRuns sync.Map
+
+	// commitStatuses holds the evaluation IDs [Client.Start] fell back to a commit status for
+	commitStatuses sync.Map
 
 	labels        *LabelClient
 	mergeRequests *MergeRequestClient
 }
 
-// NewClient creates a new GitLab client
-func NewClient(ctx context.Context) *Client {
-	client := go_github.NewClient(nil).WithAuthToken(state.Token(ctx))
+// NewClient creates a new GitHub client
+//
+// When a GitHub App is configured, requests are authenticated with installation access tokens
+// instead of the static API token.
+//
+// When the base URL is not the public GitHub API, it's treated as a GitHub Enterprise Server instance
+func NewClient(ctx context.Context, backstageClient *backstage.Client) (*Client, error) {
+	baseURL := state.BaseURL(ctx)
+
+	if appID := state.GitHubAppID(ctx); appID != 0 {
+		transport, err := newAppTransport(appID, state.GitHubAppPrivateKey(ctx), baseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := newRESTClient(&http.Client{Transport: transport}, baseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Client{wrapped: client, app: transport, backstage: backstageClient}, nil
+	}
+
+	client, err := newRESTClient(&http.Client{Transport: metrics.Transport("github", http.DefaultTransport)}, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{wrapped: client.WithAuthToken(state.Token(ctx)), backstage: backstageClient}, nil
+}
+
+// newRESTClient creates a go-github client for the public GitHub API, or a GitHub Enterprise Server instance
+func newRESTClient(httpClient *http.Client, baseURL string) (*go_github.Client, error) {
+	client := go_github.NewClient(httpClient)
 
-	return &Client{wrapped: client}
+	if len(baseURL) == 0 || baseURL == DefaultBaseURL {
+		return client, nil
+	}
+
+	client, err := client.WithEnterpriseURLs(baseURL, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub base URL [%s]: %w", baseURL, err)
+	}
+
+	return client, nil
 }
 
 // Labels returns a client target at managing labels/tags
@@ -45,13 +132,245 @@ func (client *Client) MergeRequests() scm.MergeRequestClient {
 	return client.mergeRequests
 }
 
-func (client *Client) FindMergeRequestsForPeriodicEvaluation(context.Context, scm.MergeRequestListFilters) ([]scm.PeriodicEvaluationMergeRequest, error) {
-	return nil, errors.New("not implemented yet")
+// FindMergeRequestsForPeriodicEvaluation will find all Pull Requests legible for
+// periodic re-evaluation.
+func (client *Client) FindMergeRequestsForPeriodicEvaluation(ctx context.Context, filters scm.MergeRequestListFilters) ([]scm.PeriodicEvaluationMergeRequest, error) {
+	configFilePath := filters.SCMConfigurationFilePath
+	if len(configFilePath) == 0 {
+		configFilePath = ".scm-engine.yml"
+	}
+
+	// Check if the evaluation should update CI pipelines by default
+	updatePipeline, _ := state.ShouldUpdatePipeline(ctx)
+
+	// A GitHub App has no "viewer" repositories, so the repositories of each installation are used instead
+	if client.app != nil {
+		return client.findMergeRequestsForPeriodicEvaluationAsApp(ctx, filters, configFilePath, updatePipeline)
+	}
+
+	// Repositories the token is a direct owner or collaborator of
+	affiliations := []RepositoryAffiliation{RepositoryAffiliationOwner, RepositoryAffiliationCollaborator}
+
+	// Without the membership requirement, include every repository visible through organization membership as well
+	if !filters.OnlyProjectsWithMembership {
+		affiliations = append(affiliations, RepositoryAffiliationOrganizationMember)
+	}
+
+	var (
+		result        []scm.PeriodicEvaluationMergeRequest
+		graphqlClient = client.newGraphQLClient(ctx)
+		variables     = map[string]any{
+			"cursor":                     (*string)(nil),
+			"affiliations":               affiliations,
+			"scm_config_file_expression": "HEAD:" + configFilePath,
+		}
+	)
+
+	for {
+		var response PeriodicEvaluationResult
+
+		if err := graphqlClient.Query(ctx, &response, variables); err != nil {
+			return nil, err
+		}
+
+		slogctx.Debug(ctx, fmt.Sprintf("Found %d repositories", len(response.Viewer.Repositories.Nodes)))
+
+		for _, repository := range response.Viewer.Repositories.Nodes {
+			if err := readRemainingPullRequests(ctx, graphqlClient, &repository); err != nil {
+				return nil, err
+			}
+
+			result = append(result, periodicEvaluationMergeRequests(ctx, filters, repository, updatePipeline)...)
+		}
+
+		pageInfo := response.Viewer.Repositories.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			break
+		}
+
+		variables["cursor"] = pageInfo.EndCursor
+	}
+
+	return result, nil
+}
+
+// findMergeRequestsForPeriodicEvaluationAsApp finds Pull Requests legible for periodic re-evaluation
+// in every (non-archived) repository the GitHub App is installed in.
+//
+// Installations only grant access to the selected repositories, so the membership filter does not apply.
+func (client *Client) findMergeRequestsForPeriodicEvaluationAsApp(ctx context.Context, filters scm.MergeRequestListFilters, configFilePath string, updatePipeline bool) ([]scm.PeriodicEvaluationMergeRequest, error) {
+	installations, err := client.app.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []scm.PeriodicEvaluationMergeRequest
+
+	for _, installationID := range installations {
+		ctx := withInstallationID(ctx, installationID)
+		graphqlClient := client.newGraphQLClient(ctx)
+		options := &go_github.ListOptions{PerPage: 100}
+
+		for {
+			repositories, response, err := client.wrapped.Apps.ListRepos(ctx, options)
+			if err != nil {
+				return nil, fmt.Errorf("could not list repositories for GitHub App installation [%d]: %w", installationID, err)
+			}
+
+			slogctx.Debug(ctx, fmt.Sprintf("Found %d repositories", len(repositories.Repositories)), slog.Int64("installation_id", installationID))
+
+			for _, repository := range repositories.Repositories {
+				if repository.GetArchived() {
+					continue
+				}
+
+				var (
+					node      PeriodicEvaluationRepositoryResult
+					variables = map[string]any{
+						"owner":                      repository.GetOwner().GetLogin(),
+						"repo":                       repository.GetName(),
+						"scm_config_file_expression": "HEAD:" + configFilePath,
+					}
+				)
+
+				if err := graphqlClient.Query(ctx, &node, variables); err != nil {
+					return nil, err
+				}
+
+				if node.Repository == nil {
+					continue
+				}
+
+				if err := readRemainingPullRequests(ctx, graphqlClient, node.Repository); err != nil {
+					return nil, err
+				}
+
+				result = append(result, periodicEvaluationMergeRequests(ctx, filters, *node.Repository, updatePipeline)...)
+			}
+
+			if response.NextPage == 0 {
+				break
+			}
+
+			options.Page = response.NextPage
+		}
+	}
+
+	return result, nil
+}
+
+// readRemainingPullRequests adds the Pull Requests of the repository that did not fit in the first page
+func readRemainingPullRequests(ctx context.Context, graphqlClient *graphql.Client, repository *PeriodicEvaluationRepositoryNode) error {
+	pageInfo := repository.PullRequests.PageInfo
+	if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+		return nil
+	}
+
+	owner, repo, err := ParseProject(repository.NameWithOwner)
+	if err != nil {
+		return err
+	}
+
+	variables := map[string]any{
+		"owner":  owner,
+		"repo":   repo,
+		"cursor": pageInfo.EndCursor,
+	}
+
+	for {
+		var response PeriodicEvaluationPullRequestsResult
+
+		if err := graphqlClient.Query(ctx, &response, variables); err != nil {
+			return fmt.Errorf("could not read Pull Requests of repository [%s]: %w", repository.NameWithOwner, err)
+		}
+
+		if response.Repository == nil {
+			return nil
+		}
+
+		repository.PullRequests.Nodes = append(repository.PullRequests.Nodes, response.Repository.PullRequests.Nodes...)
+
+		pageInfo = response.Repository.PullRequests.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return nil
+		}
+
+		variables["cursor"] = pageInfo.EndCursor
+	}
+}
+
+// periodicEvaluationMergeRequests applies the filters GitHub can't do server-side to a single
+// repository and converts its Pull Requests into periodic evaluation candidates.
+//
+// The topic and label filters all require *every* listed value to be present, matching the GitLab semantics.
+func periodicEvaluationMergeRequests(ctx context.Context, filters scm.MergeRequestListFilters, repository PeriodicEvaluationRepositoryNode, updatePipeline bool) []scm.PeriodicEvaluationMergeRequest {
+	topics := make([]string, 0, len(repository.RepositoryTopics.Nodes))
+	for _, node := range repository.RepositoryTopics.Nodes {
+		topics = append(topics, node.Topic.Name)
+	}
+
+	if !containsAll(topics, filters.OnlyProjectsWithTopics) {
+		return nil
+	}
+
+	slogctx.Debug(ctx, fmt.Sprintf("Repository %s has %d Pull Requests", repository.NameWithOwner, len(repository.PullRequests.Nodes)))
+
+	var result []scm.PeriodicEvaluationMergeRequest
+
+	for _, pullRequest := range repository.PullRequests.Nodes {
+		labels := make([]string, 0, len(pullRequest.Labels.Nodes))
+		for _, label := range pullRequest.Labels.Nodes {
+			labels = append(labels, label.Name)
+		}
+
+		if !containsAll(labels, filters.OnlyMergeRequestsWithLabels) {
+			continue
+		}
+
+		if slices.ContainsFunc(filters.IgnoreMergeRequestWithLabels, func(label string) bool { return slices.Contains(labels, label) }) {
+			continue
+		}
+
+		item := scm.PeriodicEvaluationMergeRequest{
+			Project:        repository.NameWithOwner,
+			MergeRequestID: strconv.Itoa(pullRequest.Number),
+			SHA:            pullRequest.HeadRefOid,
+			UpdatePipeline: updatePipeline,
+		}
+
+		// If periodic evaluation are updating commit statuses, check if the combined status of the HEAD commit
+		// is in a state where re-triggering it would potentially send the PR creator a "checks failed"
+		// notification every time we evaluate the PR in the background (spammy!)
+		if item.UpdatePipeline && len(pullRequest.Commits.Nodes) == 1 {
+			if rollup := pullRequest.Commits.Nodes[0].Commit.StatusCheckRollup; rollup != nil && slices.Contains(SkipPipelineUpdateIfPeriodicAndStatusCheckRollupIs, rollup.State) {
+				item.UpdatePipeline = false
+			}
+		}
+
+		// Only set the ConfigBlob struct if the config file exists in the repository
+		if repository.Config != nil && repository.Config.Blob.Text != nil {
+			item.ConfigBlob = *repository.Config.Blob.Text
+		}
+
+		result = append(result, item)
+	}
+
+	return result
+}
+
+func containsAll(haystack, needles []string) bool {
+	for _, needle := range needles {
+		if !slices.Contains(haystack, needle) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // EvalContext creates a new evaluation context for GitLab specific usage
 func (client *Client) EvalContext(ctx context.Context) (scm.EvalContext, error) {
-	res, err := NewContext(ctx, "https://api.github.com/", state.Token(ctx))
+	res, err := NewContext(ctx, state.BaseURL(ctx), client.httpClient(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -59,17 +378,266 @@ func (client *Client) EvalContext(ctx context.Context) (scm.EvalContext, error)
 	return res, nil
 }
 
+// IsSignedTag returns whether tag in project is an annotated tag with a verified signature
+func (client *Client) IsSignedTag(ctx context.Context, project, tag string) (bool, error) {
+	owner, repo, err := ParseProject(project)
+	if err != nil {
+		return false, err
+	}
+
+	// The tag may be in a repository of another GitHub App installation
+	ctx = withInstallationProject(ctx, project)
+
+	ref, _, err := client.wrapped.Git.GetRef(ctx, owner, repo, "tags/"+tag)
+	if err != nil {
+		return false, err
+	}
+
+	// Lightweight tags point directly at a commit, and can't be signed
+	if ref.GetObject().GetType() != "tag" {
+		return false, nil
+	}
+
+	annotated, _, err := client.wrapped.Git.GetTag(ctx, owner, repo, ref.GetObject().GetSHA())
+	if err != nil {
+		return false, err
+	}
+
+	return annotated.GetVerification().GetVerified(), nil
+}
+
+// HeadCommitSHA returns the SHA of the HEAD commit of the Pull Request in the context
+func (client *Client) HeadCommitSHA(ctx context.Context) (string, error) {
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	pullRequest, _, err := client.wrapped.PullRequests.Get(ctx, owner, repo, state.MergeRequestIDInt(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	return pullRequest.GetHead().GetSHA(), nil
+}
+
+// Ping verifies the credentials with a cheap authenticated API call
+//
+// A GitHub App is verified as the App itself, since installation tokens are scoped to a repository
+func (client *Client) Ping(ctx context.Context) error {
+	if client.app != nil {
+		if _, _, err := client.app.app.Apps.Get(ctx, ""); err != nil {
+			return fmt.Errorf("could not verify the GitHub App credentials: %w", err)
+		}
+
+		return nil
+	}
+
+	// The rate limit endpoint does not count against the rate limit, yet rejects invalid tokens
+	if _, _, err := client.wrapped.RateLimit.Get(ctx); err != nil {
+		return fmt.Errorf("could not verify the GitHub token: %w", err)
+	}
+
+	return nil
+}
+
 // Start pipeline
+//
+// A "scm-engine" check run is created on the HEAD commit of the Pull Request. Check runs can only be
+// created by GitHub Apps, so when the token is not allowed to create them a commit status is used instead.
 func (client *Client) Start(ctx context.Context) error {
-	return nil
+	ok, pattern := state.ShouldUpdatePipeline(ctx)
+	if !ok {
+		return nil
+	}
+
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	targetURL := pipelineTargetURL(ctx, pattern, false)
+
+	checkRun, response, err := client.wrapped.Checks.CreateCheckRun(ctx, owner, repo, go_github.CreateCheckRunOptions{
+		Name:       pipelineName,
+		HeadSHA:    state.CommitSHA(ctx),
+		DetailsURL: targetURL,
+		ExternalID: scm.Ptr(state.EvaluationID(ctx)),
+		Status:     scm.Ptr("in_progress"),
+		StartedAt:  &go_github.Timestamp{Time: state.StartTime(ctx)},
+		Output: &go_github.CheckRunOutput{
+			Title:   scm.Ptr("Currently evaluating Pull Request"),
+			Summary: scm.Ptr("Currently evaluating Pull Request"),
+		},
+	})
+
+	switch {
+	case err == nil:
+		client.checkRuns.Store(state.EvaluationID(ctx), checkRun.GetID())
+
+		return nil
+
+	case client.checkRunsNotAllowed(response):
+		slogctx.Debug(ctx, "could not create check run, falling back to commit status", slog.Any("err", err))
+
+		client.commitStatuses.Store(state.EvaluationID(ctx), struct{}{})
+
+		return client.setCommitStatus(ctx, "pending", "Currently evaluating Pull Request", targetURL)
+
+	default:
+		return err
+	}
 }
 
 // Stop pipeline
-func (client *Client) Stop(ctx context.Context, err error, allowPipelineFailure bool) error {
-	return nil
+func (client *Client) Stop(ctx context.Context, evalError error, allowPipelineFailure bool) error {
+	ok, pattern := state.ShouldUpdatePipeline(ctx)
+	if !ok {
+		return nil
+	}
+
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	targetURL := pipelineTargetURL(ctx, pattern, true)
+
+	var (
+		status      = "success"
+		title       = "OK"
+		description = "OK"
+	)
+
+	if evalError != nil {
+		if allowPipelineFailure {
+			status = "failure"
+		}
+
+		title = truncate.Truncate(evalError.Error(), 250, "...", truncate.PositionEnd)
+		description = evalError.Error()
+	}
+
+	output := &go_github.CheckRunOutput{
+		Title:   scm.Ptr(title),
+		Summary: scm.Ptr(description),
+	}
+
+	// Complete the check run created by [Client.Start]
+	if checkRunID, ok := client.checkRuns.LoadAndDelete(state.EvaluationID(ctx)); ok {
+		_, _, err := client.wrapped.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID.(int64), go_github.UpdateCheckRunOptions{ //nolint:forcetypeassert
+			Name:        pipelineName,
+			DetailsURL:  targetURL,
+			Status:      scm.Ptr("completed"),
+			Conclusion:  scm.Ptr(status),
+			CompletedAt: &go_github.Timestamp{Time: time.Now()},
+			Output:      output,
+		})
+
+		return err
+	}
+
+	// Check runs are not allowed, as [Client.Start] found out already
+	if _, ok := client.commitStatuses.LoadAndDelete(state.EvaluationID(ctx)); ok {
+		return client.setCommitStatus(ctx, status, title, targetURL)
+	}
+
+	// [Client.Start] never got to create the check run
+	_, response, err := client.wrapped.Checks.CreateCheckRun(ctx, owner, repo, go_github.CreateCheckRunOptions{
+		Name:        pipelineName,
+		HeadSHA:     state.CommitSHA(ctx),
+		DetailsURL:  targetURL,
+		ExternalID:  scm.Ptr(state.EvaluationID(ctx)),
+		Status:      scm.Ptr("completed"),
+		Conclusion:  scm.Ptr(status),
+		StartedAt:   &go_github.Timestamp{Time: state.StartTime(ctx)},
+		CompletedAt: &go_github.Timestamp{Time: time.Now()},
+		Output:      output,
+	})
+
+	switch {
+	case err == nil:
+		return nil
+
+	case client.checkRunsNotAllowed(response):
+		return client.setCommitStatus(ctx, status, title, targetURL)
+
+	default:
+		return err
+	}
+}
+
+// setCommitStatus sets the "scm-engine" commit status on the HEAD commit of the Pull Request
+func (client *Client) setCommitStatus(ctx context.Context, status, description string, targetURL *string) error {
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = client.wrapped.Repositories.CreateStatus(ctx, owner, repo, state.CommitSHA(ctx), &go_github.RepoStatus{
+		State:       scm.Ptr(status),
+		Context:     scm.Ptr(pipelineName),
+		Description: scm.Ptr(truncate.Truncate(description, 140, "...", truncate.PositionEnd)),
+		TargetURL:   targetURL,
+	})
+
+	return err
+}
+
+func (client *Client) newGraphQLClient(ctx context.Context) *graphql.Client {
+	return graphql.NewClient(graphqlURL(state.BaseURL(ctx)), client.httpClient(ctx))
 }
 
-// Get Project Files
+// httpClient returns an HTTP client authenticating requests the same way as the REST client
+func (client *Client) httpClient(ctx context.Context) *http.Client {
+	if client.app != nil {
+		return &http.Client{Transport: client.app}
+	}
+
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: state.Token(ctx)}),
+			Base:   metrics.Transport("github", http.DefaultTransport),
+		},
+	}
+}
+
+// GetProjectFiles reads a list of files from a repository at the provided git reference in a single GraphQL request
 func (client *Client) GetProjectFiles(ctx context.Context, project string, ref *string, files []string) (map[string]string, error) {
-	return nil, errors.New("not implemented yet")
+	if len(project) == 0 {
+		return nil, errors.New("Missing required 'project' value for include")
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Missing list of files to include from project [%s]", project)
+	}
+
+	owner, repo, err := ParseProject(project)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files may be in a repository of another GitHub App installation
+	ctx = withInstallationProject(ctx, project)
+
+	gitRef := "HEAD"
+	if ref != nil && len(*ref) > 0 {
+		gitRef = *ref
+	}
+
+	variables := map[string]any{
+		"owner": owner,
+		"repo":  repo,
+	}
+
+	for i, file := range files {
+		variables[includeConfigurationAlias(i)] = gitRef + ":" + file
+	}
+
+	response, err := client.newGraphQLClient(ctx).ExecRaw(ctx, includeConfigurationQuery(len(files)), variables)
+	if err != nil {
+		return nil, fmt.Errorf("GraphQL query failed while trying to read remote configuration files [%v] for project [%s]: %w", files, project, err)
+	}
+
+	return parseIncludeConfigurationResult(project, files, response)
 }
@@ -7,13 +7,17 @@ import (
 	"log/slog"
 
 	go_github "github.com/google/go-github/v72/github"
+	"github.com/jippi/scm-engine/pkg/config"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
 )
 
 func (c *Client) ApplyStep(ctx context.Context, evalContext scm.EvalContext, update *scm.UpdateMergeRequestOptions, step scm.ActionStep) error {
-	owner, repo := ownerAndRepo(ctx)
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return err
+	}
 
 	action, err := step.RequiredString("action")
 	if err != nil {
@@ -21,6 +25,9 @@ func (c *Client) ApplyStep(ctx context.Context, evalContext scm.EvalContext, upd
 	}
 
 	switch action {
+	case "update_description":
+		return config.UpdateDescription(evalContext, update, step, config.DefinitionsFromContext(ctx)...)
+
 	case "add_label":
 		name, err := step.RequiredString("label")
 		if err != nil {
@@ -87,6 +94,9 @@ func (c *Client) ApplyStep(ctx context.Context, evalContext scm.EvalContext, upd
 
 		return err
 
+	case "assign_reviewers":
+		return c.AssignReviewers(ctx, evalContext, update, step)
+
 	case "comment":
 		msg, err := step.RequiredString("message")
 		if err != nil {
@@ -98,12 +108,13 @@ func (c *Client) ApplyStep(ctx context.Context, evalContext scm.EvalContext, upd
 		}
 
 		if state.IsDryRun(ctx) {
-			slogctx.Info(ctx, "Commenting on MR", slog.String("message", msg))
+			slogctx.Info(ctx, "(Dry Run) Commenting on PR", slog.String("message", msg))
 
 			return nil
 		}
 
-		_, _, err = c.wrapped.PullRequests.CreateComment(ctx, owner, repo, state.MergeRequestIDInt(ctx), &go_github.PullRequestComment{
+		// Pull Request conversation comments are Issue comments; Pull Request comments are review comments on a line of code
+		_, _, err = c.wrapped.Issues.CreateComment(ctx, owner, repo, state.MergeRequestIDInt(ctx), &go_github.IssueComment{
 			Body: scm.Ptr(msg),
 		})
 
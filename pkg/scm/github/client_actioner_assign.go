@@ -0,0 +1,68 @@
+package github
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// AssignReviewers requests reviews from users picked from the configured source.
+//
+// GitHub identifies reviewers by their username (login), so "user_ids" for the "static"
+// source must be GitHub usernames.
+func (c *Client) AssignReviewers(ctx context.Context, evalContext scm.EvalContext, update *scm.UpdateMergeRequestOptions, step scm.ActionStep) error {
+	selection, err := scm.SelectReviewers(ctx, evalContext, step, reviewerSources{client: c})
+	if err != nil {
+		return err
+	}
+
+	if len(selection.Reviewers) == 0 {
+		return nil
+	}
+
+	usernames := make([]string, 0, len(selection.Reviewers))
+	for _, reviewer := range selection.Reviewers {
+		usernames = append(usernames, reviewer.Username)
+	}
+
+	if state.IsDryRun(ctx) {
+		slogctx.Info(ctx, "(Dry Run) Assigning PR", slog.String("source", selection.Source), slog.Int("limit", selection.Limit), slog.String("mode", selection.Mode), slog.Any("reviewers", usernames))
+
+		return nil
+	}
+
+	// GitHub adds requested reviewers to the existing ones, so only the new reviewers are requested
+	update.AppendReviewers(usernames)
+
+	return nil
+}
+
+// reviewerSources looks up reviewers for [scm.SelectReviewers], identifying them by their username
+type reviewerSources struct {
+	client *Client
+}
+
+func (s reviewerSources) CodeOwners(ctx context.Context, evalContext scm.EvalContext) scm.Actors {
+	return s.client.codeOwners(ctx, evalContext)
+}
+
+func (s reviewerSources) Backstage(ctx context.Context) (scm.Actors, error) {
+	if s.client.backstage == nil {
+		slogctx.Warn(ctx, "Backstage client not initialized and source is backstage, skipping")
+
+		return nil, nil
+	}
+
+	return s.client.backstage.GetOwnersForGitHubProject(ctx, state.ProjectID(ctx))
+}
+
+func (s reviewerSources) StaticReviewer(username string) scm.Actor {
+	return scm.Actor{Username: username}
+}
+
+func (s reviewerSources) ReviewerKey(actor scm.Actor) string {
+	return actor.Username
+}
@@ -0,0 +1,186 @@
+package github_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/scm/github"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// reviewersContext is a minimal [scm.EvalContext] exposing the reviewer related accessors
+type reviewersContext struct {
+	scm.EvalContext
+
+	author     scm.Actor
+	codeOwners scm.Actors
+	reviewers  scm.Actors
+}
+
+func (c *reviewersContext) GetAuthor() scm.Actor       { return c.author }
+func (c *reviewersContext) GetCodeOwners() scm.Actors  { return c.codeOwners }
+func (c *reviewersContext) GetReviewers() scm.Actors   { return c.reviewers }
+func (c *reviewersContext) IsValid() bool              { return true }
+func (c *reviewersContext) SetContext(context.Context) {}
+
+func assignReviewers(t *testing.T, evalContext scm.EvalContext, step config.ActionStep, dryRun bool) (*scm.UpdateMergeRequestOptions, error) {
+	t.Helper()
+
+	ctx := state.WithDryRun(t.Context(), dryRun)
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithRandomSeed(ctx, 1)
+
+	update := &scm.UpdateMergeRequestOptions{}
+
+	return update, (&github.Client{}).AssignReviewers(ctx, evalContext, update, step)
+}
+
+func TestAssignReviewers_codeowners(t *testing.T) {
+	t.Parallel()
+
+	codeOwners := scm.Actors{{Username: "user1"}, {Username: "user2"}, {Username: "user3"}}
+
+	tests := []struct {
+		name       string
+		step       config.ActionStep
+		reviewers  scm.Actors
+		codeOwners scm.Actors
+		wantCount  int
+	}{
+		{
+			name:      "no code owners",
+			step:      config.ActionStep{"limit": 2},
+			wantCount: 0,
+		},
+		{
+			name:       "defaults to a single reviewer",
+			step:       config.ActionStep{"source": "codeowners"},
+			codeOwners: codeOwners,
+			wantCount:  1,
+		},
+		{
+			name:       "picks up to the limit",
+			step:       config.ActionStep{"source": "codeowners", "limit": 2},
+			codeOwners: codeOwners,
+			wantCount:  2,
+		},
+		{
+			name:       "limit higher than the eligible reviewers",
+			step:       config.ActionStep{"source": "codeowners", "limit": 6},
+			codeOwners: codeOwners,
+			wantCount:  3,
+		},
+		{
+			name:       "tops up existing reviewers",
+			step:       config.ActionStep{"source": "codeowners", "limit": 2},
+			reviewers:  scm.Actors{{Username: "user1"}},
+			codeOwners: codeOwners,
+			wantCount:  1,
+		},
+		{
+			name:       "limit already satisfied",
+			step:       config.ActionStep{"source": "codeowners", "limit": 2},
+			reviewers:  scm.Actors{{Username: "user1"}, {Username: "user3"}},
+			codeOwners: codeOwners,
+			wantCount:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			update, err := assignReviewers(t, &reviewersContext{codeOwners: tt.codeOwners, reviewers: tt.reviewers}, tt.step, false)
+			require.NoError(t, err)
+
+			if tt.wantCount == 0 {
+				require.Nil(t, update.Reviewers)
+
+				return
+			}
+
+			require.NotNil(t, update.Reviewers)
+			require.Len(t, *update.Reviewers, tt.wantCount)
+
+			for _, reviewer := range *update.Reviewers {
+				require.True(t, tt.codeOwners.Has(scm.Actor{Username: reviewer}), "reviewer %s is not a code owner", reviewer)
+				require.False(t, tt.reviewers.Has(scm.Actor{Username: reviewer}), "reviewer %s was already assigned", reviewer)
+			}
+		})
+	}
+}
+
+func TestAssignReviewers_static(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		step      config.ActionStep
+		reviewers scm.Actors
+		want      *[]string
+		wantErr   string
+	}{
+		{
+			name:    "requires user_ids",
+			step:    config.ActionStep{"source": "static"},
+			wantErr: "Required 'step' key 'user_ids' is missing",
+		},
+		{
+			name: "random mode honors the limit",
+			step: config.ActionStep{"source": "static", "user_ids": []any{"user1"}, "limit": 1},
+			want: &[]string{"user1"},
+		},
+		{
+			name:      "static mode assigns everyone not yet assigned",
+			step:      config.ActionStep{"source": "static", "mode": "static", "user_ids": []any{"user1", "user2", "user3", "user1"}},
+			reviewers: scm.Actors{{Username: "user2"}},
+			want:      &[]string{"user1", "user3"},
+		},
+		{
+			name:      "static mode with everyone assigned",
+			step:      config.ActionStep{"source": "static", "mode": "static", "user_ids": []any{"user1"}},
+			reviewers: scm.Actors{{Username: "user1"}},
+			want:      nil,
+		},
+		{
+			name:    "static mode requires the static source",
+			step:    config.ActionStep{"source": "codeowners", "mode": "static"},
+			wantErr: "step field 'mode: static' is only supported with 'source: static'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			update, err := assignReviewers(t, &reviewersContext{reviewers: tt.reviewers}, tt.step, false)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, update.Reviewers)
+		})
+	}
+}
+
+func TestAssignReviewers_backstageWithoutClient(t *testing.T) {
+	t.Parallel()
+
+	update, err := assignReviewers(t, &reviewersContext{}, config.ActionStep{"source": "backstage"}, false)
+	require.NoError(t, err)
+	require.Nil(t, update.Reviewers)
+}
+
+func TestAssignReviewers_dryRun(t *testing.T) {
+	t.Parallel()
+
+	update, err := assignReviewers(t, &reviewersContext{codeOwners: scm.Actors{{Username: "user1"}}}, config.ActionStep{"source": "codeowners"}, true)
+	require.NoError(t, err)
+	require.Nil(t, update.Reviewers)
+}
@@ -190,23 +190,42 @@ func TestApplyStep_dryRunSkipsAPICalls(t *testing.T) {
 	}
 }
 
-// update_description and assign_reviewers are implemented for GitLab only. They
-// are documented without a provider caveat, so this records the actual GitHub
-// behaviour: the action is rejected rather than silently ignored.
-func TestApplyStep_gitLabOnlyActionsAreRejected(t *testing.T) {
+// descriptionContext is a minimal [scm.EvalContext] exposing the Pull Request description
+type descriptionContext struct {
+	scm.EvalContext
+
+	description string
+}
+
+func (c *descriptionContext) GetDescription() string { return c.description }
+
+func TestApplyStep_updateDescription(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name string
-		step config.ActionStep
+		name        string
+		description string
+		replace     any
+		want        *string
+		wantErr     string
 	}{
 		{
-			name: "update_description",
-			step: config.ActionStep{"action": "update_description", "replace": config.ActionStep{"a": `"b"`}},
+			name:        "replaces a placeholder with a script result",
+			description: "Pull Request ${{ID}} is ready",
+			replace:     config.ActionStep{"${{ID}}": `"42"`},
+			want:        scm.Ptr("Pull Request 42 is ready"),
+		},
+		{
+			name:        "description is left alone when no key matches",
+			description: "nothing to replace here",
+			replace:     config.ActionStep{"${{MISSING}}": `"value"`},
+			want:        nil,
 		},
 		{
-			name: "assign_reviewers",
-			step: config.ActionStep{"action": "assign_reviewers", "source": "codeowners"},
+			name:        "replace must be a dictionary",
+			description: "anything",
+			replace:     "not-a-dictionary",
+			wantErr:     "step field 'replace' must be a dictionary",
 		},
 	}
 
@@ -214,8 +233,18 @@ func TestApplyStep_gitLabOnlyActionsAreRejected(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := applyStep(t, tt.step)
-			require.ErrorContains(t, err, "GitHub client does not know how to apply action")
+			update := &scm.UpdateMergeRequestOptions{}
+			ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+
+			err := (&github.Client{}).ApplyStep(ctx, &descriptionContext{description: tt.description}, update, config.ActionStep{"action": "update_description", "replace": tt.replace})
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, update.Description)
 		})
 	}
 }
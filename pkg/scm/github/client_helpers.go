@@ -2,7 +2,13 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	go_github "github.com/google/go-github/v72/github"
 	"github.com/jippi/scm-engine/pkg/scm"
@@ -33,9 +39,165 @@ func convertResponse(upstream *go_github.Response) *scm.Response {
 	}
 }
 
-func ownerAndRepo(ctx context.Context) (string, string) {
-	project := state.ProjectID(ctx)
-	chunks := strings.Split(project, "/")
+// ParseProject splits a GitHub project, like "jippi/scm-engine", into its owner and repository name
+func ParseProject(project string) (string, string, error) {
+	owner, repo, ok := strings.Cut(project, "/")
+	if !ok || len(owner) == 0 || len(repo) == 0 || strings.Contains(repo, "/") {
+		return "", "", fmt.Errorf("invalid project [%s], it must be in the format owner/repository", project)
+	}
+
+	return owner, repo, nil
+}
+
+// ownerAndRepo returns the owner and repository name of the project in the context
+func ownerAndRepo(ctx context.Context) (string, string, error) {
+	return ParseProject(state.ProjectID(ctx))
+}
+
+func includeConfigurationAlias(index int) string {
+	return "file_" + strconv.Itoa(index)
+}
+
+// includeConfigurationQuery builds the GraphQL query for reading [count] files from a repository,
+// with one aliased "object" lookup per file since GitHub has no batch lookup for blobs.
+//
+// GraphQL query (for count = 2):
+//
+//	query ($owner: String!, $repo: String!, $file_0: String!, $file_1: String!) {
+//	  repository(owner: $owner, name: $repo) {
+//	    file_0: object(expression: $file_0) {
+//	      ... on Blob {
+//	        text
+//	      }
+//	    }
+//	    file_1: object(expression: $file_1) {
+//	      ... on Blob {
+//	        text
+//	      }
+//	    }
+//	  }
+//	}
+//
+// Query Variables
+//
+//	{
+//	   "owner": "jippi",
+//	   "repo": "scm-engine-library",
+//	   "file_0": "HEAD:label/change-type.yml",
+//	   "file_1": "HEAD:life-cycle/close-pull-request-3-weeks.yml"
+//	}
+func includeConfigurationQuery(count int) string {
+	var (
+		arguments strings.Builder
+		fields    strings.Builder
+	)
+
+	arguments.WriteString("$owner: String!, $repo: String!")
+
+	for i := range count {
+		alias := includeConfigurationAlias(i)
+
+		fmt.Fprintf(&arguments, ", $%s: String!", alias)
+		fmt.Fprintf(&fields, " %s: object(expression: $%s) { ... on Blob { text } }", alias, alias)
+	}
+
+	return fmt.Sprintf("query (%s) { repository(owner: $owner, name: $repo) {%s } }", arguments.String(), fields.String())
+}
+
+// parseIncludeConfigurationResult converts the response of [includeConfigurationQuery] into a map of file name to content
+func parseIncludeConfigurationResult(project string, files []string, data []byte) (map[string]string, error) {
+	var response struct {
+		Repository map[string]*struct {
+			Text *string `json:"text"`
+		} `json:"repository"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("could not decode remote configuration files for project [%s]: %w", project, err)
+	}
+
+	fileContents := map[string]string{}
+
+	// Check if the files provided as input all exist in the file content and is not empty
+	for i, file := range files {
+		blob, ok := response.Repository[includeConfigurationAlias(i)]
+		if !ok || blob == nil || blob.Text == nil {
+			return nil, fmt.Errorf("configuration file [%s] in project [%s] does not exist (or could not be read)", file, project)
+		}
+
+		if len(*blob.Text) == 0 {
+			return nil, fmt.Errorf("configuration file [%s] in project [%s] is empty", file, project)
+		}
+
+		fileContents[file] = *blob.Text
+	}
+
+	return fileContents, nil
+}
+
+// pipelineTargetURL expands the "--update-pipeline-url" pattern for the current evaluation
+func pipelineTargetURL(ctx context.Context, pattern string, stopped bool) *string {
+	if len(pattern) == 0 {
+		return nil
+	}
+
+	stopTime := ""
+	if stopped {
+		stopTime = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	}
+
+	link := pattern
+	link = strings.ReplaceAll(link, "__ID__", state.EvaluationID(ctx))
+	link = strings.ReplaceAll(link, "__MR_ID__", state.MergeRequestID(ctx))
+	link = strings.ReplaceAll(link, "__PROJECT_ID__", state.ProjectID(ctx))
+	link = strings.ReplaceAll(link, "__START_TS_MS__", strconv.FormatInt(state.StartTime(ctx).UnixMilli(), 10))
+	link = strings.ReplaceAll(link, "__STOP_TS_MS__", stopTime)
+
+	return &link
+}
+
+// checkRunsNotAllowed reports if a check run request was rejected because the token is not allowed to
+// manage check runs, which is the case for anything but GitHub App installation tokens
+func (client *Client) checkRunsNotAllowed(response *go_github.Response) bool {
+	if response == nil {
+		return false
+	}
+
+	switch response.StatusCode {
+	case http.StatusForbidden:
+		return true
+
+	// Some tokens get a 404 rather than a 403 for check runs, while for an installation token
+	// a 404 means the repository or commit can't be found, which a commit status won't fix
+	case http.StatusNotFound:
+		return client.app == nil
+
+	default:
+		return false
+	}
+}
+
+// graphqlURL returns the GraphQL endpoint matching the REST API base URL
+//
+//   - github.com: "https://api.github.com/" => "https://api.github.com/graphql"
+//   - GitHub Enterprise Cloud with data residency: "https://api.example.ghe.com/" => "https://api.example.ghe.com/graphql"
+//   - GitHub Enterprise Server: "https://github.example.com/" or "https://github.example.com/api/v3/" => "https://github.example.com/api/graphql"
+func graphqlURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	if len(baseURL) == 0 {
+		baseURL = strings.TrimSuffix(DefaultBaseURL, "/")
+	}
+
+	if enterprise, ok := strings.CutSuffix(baseURL, "/api/v3"); ok {
+		return enterprise + "/api/graphql"
+	}
+
+	// Only github.com and GitHub Enterprise Cloud serve the API from a dedicated host, any other
+	// host (even one named "api.") is a GitHub Enterprise Server instance
+	if parsed, err := url.Parse(baseURL); err == nil && (parsed.Hostname() == "api.github.com" || strings.HasSuffix(parsed.Hostname(), ".ghe.com")) {
+		return baseURL + "/graphql"
+	}
 
-	return chunks[0], chunks[1]
+	return baseURL + "/api/graphql"
 }
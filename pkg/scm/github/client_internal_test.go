@@ -0,0 +1,562 @@
+//nolint:testpackage // the periodic evaluation filters are applied by an unexported helper, and the API base URL is unexported
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	go_github "github.com/google/go-github/v72/github"
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func periodicRepository(topics []string, config *string, pullRequests ...PeriodicEvaluationPullRequestNode) PeriodicEvaluationRepositoryNode {
+	repository := PeriodicEvaluationRepositoryNode{
+		NameWithOwner: "jippi/scm-engine",
+		PullRequests:  PeriodicEvaluationPullRequestConnection{Nodes: pullRequests},
+	}
+
+	for _, topic := range topics {
+		repository.RepositoryTopics.Nodes = append(repository.RepositoryTopics.Nodes, RepositoryTopicNode{Topic: TopicNode{Name: topic}})
+	}
+
+	if config != nil {
+		repository.Config = &BlobObject{Blob: BlobNode{Text: config}}
+	}
+
+	return repository
+}
+
+func periodicPullRequest(number int, rollup string, labels ...string) PeriodicEvaluationPullRequestNode {
+	pullRequest := PeriodicEvaluationPullRequestNode{Number: number, HeadRefOid: "sha"}
+
+	for _, label := range labels {
+		pullRequest.Labels.Nodes = append(pullRequest.Labels.Nodes, LabelNode{Name: label})
+	}
+
+	commit := StatusCheckRollupNode{}
+	if rollup != "" {
+		commit.Commit.StatusCheckRollup = &StatusCheckRollup{State: rollup}
+	}
+
+	pullRequest.Commits.Nodes = []StatusCheckRollupNode{commit}
+
+	return pullRequest
+}
+
+func pullRequestNumbers(items []scm.PeriodicEvaluationMergeRequest) []string {
+	numbers := make([]string, 0, len(items))
+
+	for _, item := range items {
+		numbers = append(numbers, item.MergeRequestID)
+	}
+
+	return numbers
+}
+
+func TestPeriodicEvaluationMergeRequests_convertsPullRequests(t *testing.T) {
+	t.Parallel()
+
+	config := "label: []"
+	repository := periodicRepository(nil, &config, periodicPullRequest(1, "SUCCESS"))
+
+	got := periodicEvaluationMergeRequests(t.Context(), scm.MergeRequestListFilters{}, repository, true)
+
+	require.Equal(t, []scm.PeriodicEvaluationMergeRequest{{
+		Project:        "jippi/scm-engine",
+		MergeRequestID: "1",
+		SHA:            "sha",
+		ConfigBlob:     "label: []",
+		UpdatePipeline: true,
+	}}, got)
+}
+
+// Repositories with more than 100 open Pull Requests are read page by page
+func TestFindMergeRequestsForPeriodicEvaluation_paginatesPullRequests(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables map[string]any `json:"variables"`
+		}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		switch request.Variables["cursor"] {
+		case nil:
+			w.Write([]byte(`{"data":{"viewer":{"repositories":{"pageInfo":{"hasNextPage":false},"nodes":[{"nameWithOwner":"jippi/scm-engine","pullRequests":{"pageInfo":{"hasNextPage":true,"endCursor":"page-2"},"nodes":[{"number":1}]}}]}}}}`))
+
+		case "page-2":
+			require.Equal(t, "jippi", request.Variables["owner"])
+			require.Equal(t, "scm-engine", request.Variables["repo"])
+
+			w.Write([]byte(`{"data":{"repository":{"pullRequests":{"pageInfo":{"hasNextPage":true,"endCursor":"page-3"},"nodes":[{"number":2}]}}}}`))
+
+		case "page-3":
+			w.Write([]byte(`{"data":{"repository":{"pullRequests":{"pageInfo":{"hasNextPage":false,"endCursor":"page-4"},"nodes":[{"number":3}]}}}}`))
+
+		default:
+			t.Errorf("unexpected cursor %v", request.Variables["cursor"])
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL)
+	ctx = state.WithUpdatePipeline(ctx, false, "")
+
+	client, err := NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	got, err := client.FindMergeRequestsForPeriodicEvaluation(ctx, scm.MergeRequestListFilters{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, pullRequestNumbers(got))
+}
+
+// A repository without the config file is still returned, so the caller can
+// log that it was skipped.
+func TestPeriodicEvaluationMergeRequests_missingConfigFile(t *testing.T) {
+	t.Parallel()
+
+	got := periodicEvaluationMergeRequests(t.Context(), scm.MergeRequestListFilters{}, periodicRepository(nil, nil, periodicPullRequest(1, "")), false)
+
+	require.Len(t, got, 1)
+	require.Empty(t, got[0].ConfigBlob)
+}
+
+func TestPeriodicEvaluationMergeRequests_requiresEveryTopic(t *testing.T) {
+	t.Parallel()
+
+	filters := scm.MergeRequestListFilters{OnlyProjectsWithTopics: []string{"scm-engine", "golang"}}
+
+	tests := []struct {
+		name   string
+		topics []string
+		want   int
+	}{
+		{name: "all topics", topics: []string{"golang", "scm-engine", "other"}, want: 1},
+		{name: "some topics", topics: []string{"scm-engine"}, want: 0},
+		{name: "no topics", topics: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := periodicEvaluationMergeRequests(t.Context(), filters, periodicRepository(tt.topics, nil, periodicPullRequest(1, "")), false)
+			require.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestPeriodicEvaluationMergeRequests_labelFilters(t *testing.T) {
+	t.Parallel()
+
+	repository := periodicRepository(nil, nil,
+		periodicPullRequest(1, ""),
+		periodicPullRequest(2, "", "stale"),
+		periodicPullRequest(3, "", "stale", "security"),
+		periodicPullRequest(4, "", "stale", "team/a"),
+	)
+
+	tests := []struct {
+		name    string
+		filters scm.MergeRequestListFilters
+		want    []string
+	}{
+		{
+			name: "no filters",
+			want: []string{"1", "2", "3", "4"},
+		},
+		{
+			name:    "required labels must all be present",
+			filters: scm.MergeRequestListFilters{OnlyMergeRequestsWithLabels: []string{"stale", "team/a"}},
+			want:    []string{"4"},
+		},
+		{
+			name:    "any ignored label excludes the Pull Request",
+			filters: scm.MergeRequestListFilters{IgnoreMergeRequestWithLabels: []string{"security", "team/a"}},
+			want:    []string{"1", "2"},
+		},
+		{
+			name: "ignored labels win over required labels",
+			filters: scm.MergeRequestListFilters{
+				OnlyMergeRequestsWithLabels:  []string{"stale"},
+				IgnoreMergeRequestWithLabels: []string{"security"},
+			},
+			want: []string{"2", "4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := periodicEvaluationMergeRequests(t.Context(), tt.filters, repository, false)
+			require.Equal(t, tt.want, pullRequestNumbers(got))
+		})
+	}
+}
+
+// A failing HEAD commit must not get its status re-set by every background cycle.
+func TestPeriodicEvaluationMergeRequests_skipsPipelineUpdateForFailingCommits(t *testing.T) {
+	t.Parallel()
+
+	repository := periodicRepository(nil, nil,
+		periodicPullRequest(1, "SUCCESS"),
+		periodicPullRequest(2, "FAILURE"),
+		periodicPullRequest(3, "ERROR"),
+		periodicPullRequest(4, ""),
+	)
+
+	got := periodicEvaluationMergeRequests(t.Context(), scm.MergeRequestListFilters{}, repository, true)
+	require.Len(t, got, 4)
+
+	updates := map[string]bool{}
+	for _, item := range got {
+		updates[item.MergeRequestID] = item.UpdatePipeline
+	}
+
+	require.Equal(t, map[string]bool{"1": true, "2": false, "3": false, "4": true}, updates)
+
+	// When updating is disabled to begin with, it stays disabled
+	for _, item := range periodicEvaluationMergeRequests(t.Context(), scm.MergeRequestListFilters{}, repository, false) {
+		require.False(t, item.UpdatePipeline)
+	}
+}
+
+func TestIncludeConfigurationQuery(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t,
+		"query ($owner: String!, $repo: String!, $file_0: String!, $file_1: String!) { repository(owner: $owner, name: $repo) {"+
+			" file_0: object(expression: $file_0) { ... on Blob { text } }"+
+			" file_1: object(expression: $file_1) { ... on Blob { text } } } }",
+		includeConfigurationQuery(2),
+	)
+}
+
+func TestParseIncludeConfigurationResult(t *testing.T) {
+	t.Parallel()
+
+	files := []string{"label/a.yml", "label/b.yml"}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "all files exist",
+			data: `{"repository":{"file_0":{"text":"label: []"},"file_1":{"text":"actions: []"}}}`,
+			want: map[string]string{"label/a.yml": "label: []", "label/b.yml": "actions: []"},
+		},
+		{
+			name:    "missing file",
+			data:    `{"repository":{"file_0":{"text":"label: []"},"file_1":null}}`,
+			wantErr: "configuration file [label/b.yml] in project [jippi/library] does not exist (or could not be read)",
+		},
+		{
+			name:    "path is not a blob",
+			data:    `{"repository":{"file_0":{},"file_1":{"text":"label: []"}}}`,
+			wantErr: "configuration file [label/a.yml] in project [jippi/library] does not exist (or could not be read)",
+		},
+		{
+			name:    "empty file",
+			data:    `{"repository":{"file_0":{"text":"label: []"},"file_1":{"text":""}}}`,
+			wantErr: "configuration file [label/b.yml] in project [jippi/library] is empty",
+		},
+		{
+			name:    "repository not found",
+			data:    `{"repository":null}`,
+			wantErr: "configuration file [label/a.yml] in project [jippi/library] does not exist (or could not be read)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseIncludeConfigurationResult("jippi/library", files, []byte(tt.data))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// pipelineTestClient returns a client talking to a fake GitHub Enterprise Server API, and the list of
+// requests it received (without the "/api/v3" prefix)
+func pipelineTestClient(t *testing.T, allowCheckRuns bool) (*Client, *[]string, map[string]map[string]any) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []string
+		bodies   = map[string]map[string]any{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path, ok := strings.CutPrefix(r.URL.Path, "/api/v3")
+		require.True(t, ok, "GitHub Enterprise Server API requests must use the /api/v3 prefix")
+
+		request := r.Method + " " + path
+		requests = append(requests, request)
+
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		bodies[request] = body
+
+		if strings.Contains(r.URL.Path, "/check-runs") && !allowCheckRuns {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Resource not accessible by personal access token"}`))
+
+			return
+		}
+
+		w.Write([]byte(`{"id":1337}`))
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL)
+
+	client, err := NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	return client, &requests, bodies
+}
+
+func pipelineTestContext(t *testing.T, updatePipeline bool) context.Context {
+	t.Helper()
+
+	ctx := state.WithProjectID(t.Context(), "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "42")
+	ctx = state.WithCommitSHA(ctx, "abc123")
+	ctx = state.WithEvaluationID(ctx, "eval-1")
+	ctx = state.WithStartTime(ctx, time.Now())
+	ctx = state.WithUpdatePipeline(ctx, updatePipeline, "https://example.com/__MR_ID__/__ID__")
+
+	return ctx
+}
+
+func TestClient_StartStop_checkRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                 string
+		evalError            error
+		allowPipelineFailure bool
+		wantConclusion       string
+	}{
+		{name: "success", wantConclusion: "success"},
+		{name: "error without allowing failure", evalError: errors.New("boom"), wantConclusion: "success"},
+		{name: "error allowing failure", evalError: errors.New("boom"), allowPipelineFailure: true, wantConclusion: "failure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, requests, bodies := pipelineTestClient(t, true)
+			ctx := pipelineTestContext(t, true)
+
+			require.NoError(t, client.Start(ctx))
+			require.NoError(t, client.Stop(ctx, tt.evalError, tt.allowPipelineFailure))
+
+			require.Equal(t, []string{
+				"POST /repos/jippi/scm-engine/check-runs",
+				"PATCH /repos/jippi/scm-engine/check-runs/1337",
+			}, *requests)
+
+			started := bodies["POST /repos/jippi/scm-engine/check-runs"]
+			require.Equal(t, "scm-engine", started["name"])
+			require.Equal(t, "abc123", started["head_sha"])
+			require.Equal(t, "in_progress", started["status"])
+			require.Equal(t, "https://example.com/42/eval-1", started["details_url"])
+
+			stopped := bodies["PATCH /repos/jippi/scm-engine/check-runs/1337"]
+			require.Equal(t, "completed", stopped["status"])
+			require.Equal(t, tt.wantConclusion, stopped["conclusion"])
+
+			if tt.evalError != nil {
+				require.Equal(t, tt.evalError.Error(), stopped["output"].(map[string]any)["title"]) //nolint:forcetypeassert
+			}
+		})
+	}
+}
+
+// Personal access tokens can't create check runs, so commit statuses are used instead
+func TestClient_StartStop_fallsBackToCommitStatus(t *testing.T) {
+	t.Parallel()
+
+	client, requests, bodies := pipelineTestClient(t, false)
+	ctx := pipelineTestContext(t, true)
+
+	require.NoError(t, client.Start(ctx))
+	require.NoError(t, client.Stop(ctx, errors.New(strings.Repeat("x", 200)), true))
+
+	// Stop knows check runs are not allowed, so it does not try to create one again
+	require.Equal(t, []string{
+		"POST /repos/jippi/scm-engine/check-runs",
+		"POST /repos/jippi/scm-engine/statuses/abc123",
+		"POST /repos/jippi/scm-engine/statuses/abc123",
+	}, *requests)
+
+	// Only the last status is kept, since the same request path is used twice
+	status := bodies["POST /repos/jippi/scm-engine/statuses/abc123"]
+	require.Equal(t, "scm-engine", status["context"])
+	require.Equal(t, "failure", status["state"])
+	require.Len(t, status["description"], 140)
+}
+
+// Without [Client.Start], Stop tries to create a completed check run before falling back to a commit status
+func TestClient_Stop_withoutStart(t *testing.T) {
+	t.Parallel()
+
+	client, requests, bodies := pipelineTestClient(t, false)
+	ctx := pipelineTestContext(t, true)
+
+	require.NoError(t, client.Stop(ctx, nil, false))
+
+	require.Equal(t, []string{
+		"POST /repos/jippi/scm-engine/check-runs",
+		"POST /repos/jippi/scm-engine/statuses/abc123",
+	}, *requests)
+
+	require.Equal(t, "success", bodies["POST /repos/jippi/scm-engine/statuses/abc123"]["state"])
+}
+
+func TestClient_checkRunsNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		app    bool
+		status int
+		want   bool
+	}{
+		{name: "forbidden", status: http.StatusForbidden, want: true},
+		{name: "forbidden for an app", app: true, status: http.StatusForbidden, want: true},
+		{name: "not found", status: http.StatusNotFound, want: true},
+		{name: "not found for an app", app: true, status: http.StatusNotFound, want: false},
+		{name: "server error", status: http.StatusInternalServerError, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{}
+			if tt.app {
+				client.app = &appTransport{}
+			}
+
+			require.Equal(t, tt.want, client.checkRunsNotAllowed(&go_github.Response{Response: &http.Response{StatusCode: tt.status}}))
+		})
+	}
+
+	require.False(t, (&Client{}).checkRunsNotAllowed(nil))
+}
+
+func TestClient_StartStop_disabled(t *testing.T) {
+	t.Parallel()
+
+	client, requests, _ := pipelineTestClient(t, true)
+	ctx := pipelineTestContext(t, false)
+
+	require.NoError(t, client.Start(ctx))
+	require.NoError(t, client.Stop(ctx, nil, false))
+	require.Empty(t, *requests)
+}
+
+func TestMergeRequestClient_Update_requestsReviewers(t *testing.T) {
+	t.Parallel()
+
+	client, requests, bodies := pipelineTestClient(t, true)
+	ctx := pipelineTestContext(t, false)
+
+	_, err := client.MergeRequests().Update(ctx, &scm.UpdateMergeRequestOptions{Reviewers: &[]string{"alice", "bob"}})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"POST /repos/jippi/scm-engine/pulls/42/requested_reviewers",
+		"PATCH /repos/jippi/scm-engine/pulls/42",
+	}, *requests)
+
+	require.Equal(t, []any{"alice", "bob"}, bodies["POST /repos/jippi/scm-engine/pulls/42/requested_reviewers"]["reviewers"])
+}
+
+func TestMergeRequestClient_Update_description(t *testing.T) {
+	t.Parallel()
+
+	client, requests, bodies := pipelineTestClient(t, true)
+	ctx := pipelineTestContext(t, false)
+
+	_, err := client.MergeRequests().Update(ctx, &scm.UpdateMergeRequestOptions{Description: scm.Ptr("new description")})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"PATCH /repos/jippi/scm-engine/pulls/42"}, *requests)
+	require.Equal(t, "new description", bodies["PATCH /repos/jippi/scm-engine/pulls/42"]["body"])
+}
+
+// Comments go to the Pull Request conversation, not to a line of code in the diff
+func TestClient_ApplyStep_comment(t *testing.T) {
+	t.Parallel()
+
+	client, requests, bodies := pipelineTestClient(t, true)
+	ctx := pipelineTestContext(t, false)
+	ctx = state.WithDryRun(ctx, false)
+
+	require.NoError(t, client.ApplyStep(ctx, nil, &scm.UpdateMergeRequestOptions{}, config.ActionStep{"action": "comment", "message": "hello"}))
+
+	require.Equal(t, []string{"POST /repos/jippi/scm-engine/issues/42/comments"}, *requests)
+	require.Equal(t, "hello", bodies["POST /repos/jippi/scm-engine/issues/42/comments"]["body"])
+}
+
+func TestGraphqlURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: "", want: "https://api.github.com/graphql"},
+		{baseURL: "https://api.github.com/", want: "https://api.github.com/graphql"},
+		{baseURL: "https://api.github.com", want: "https://api.github.com/graphql"},
+		{baseURL: "https://api.example.ghe.com/", want: "https://api.example.ghe.com/graphql"},
+		{baseURL: "https://github.example.com/", want: "https://github.example.com/api/graphql"},
+		{baseURL: "https://github.example.com", want: "https://github.example.com/api/graphql"},
+		{baseURL: "https://github.example.com/api/v3/", want: "https://github.example.com/api/graphql"},
+		{baseURL: "https://github.example.com/api/v3", want: "https://github.example.com/api/graphql"},
+		{baseURL: "https://api.example.com/", want: "https://api.example.com/api/graphql"},
+		{baseURL: "https://github.api.example.com/", want: "https://github.api.example.com/api/graphql"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, graphqlURL(tt.baseURL))
+		})
+	}
+}
@@ -63,7 +63,10 @@ func (client *LabelClient) List(ctx context.Context) ([]*scm.Label, error) {
 }
 
 func (client *LabelClient) list(ctx context.Context, opt *scm.ListLabelsOptions) ([]*scm.Label, *scm.Response, error) {
-	owner, repo := ownerAndRepo(ctx)
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	githubLabels, response, err := client.client.wrapped.Issues.ListLabels(ctx, owner, repo, &go_github.ListOptions{PerPage: opt.PerPage, Page: opt.Page})
 	if err != nil {
@@ -83,7 +86,10 @@ func (client *LabelClient) Create(ctx context.Context, opt *scm.CreateLabelOptio
 	// Invalidate cache
 	client.cache = nil
 
-	owner, repo := ownerAndRepo(ctx)
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	label, resp, err := client.client.wrapped.Issues.CreateLabel(ctx, owner, repo, &go_github.Label{
 		Name:        opt.Name,
@@ -98,7 +104,10 @@ func (client *LabelClient) Update(ctx context.Context, opt *scm.UpdateLabelOptio
 	// Invalidate cache
 	client.cache = nil
 
-	owner, repo := ownerAndRepo(ctx)
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	updateLabel := &go_github.Label{}
 	updateLabel.Name = opt.Name
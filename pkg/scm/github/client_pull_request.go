@@ -2,8 +2,10 @@ package github
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	go_github "github.com/google/go-github/v72/github"
 	"github.com/jippi/scm-engine/pkg/scm"
@@ -21,11 +23,16 @@ func NewMergeRequestClient(client *Client) *MergeRequestClient {
 }
 
 func (client *MergeRequestClient) Update(ctx context.Context, opt *scm.UpdateMergeRequestOptions) (*scm.Response, error) {
-	owner, repo := ownerAndRepo(ctx)
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Add labels
-	if _, resp, err := client.client.wrapped.Issues.AddLabelsToIssue(ctx, owner, repo, state.MergeRequestIDInt(ctx), *opt.AddLabels); err != nil {
-		return convertResponse(resp), err
+	if opt.AddLabels != nil && len(*opt.AddLabels) > 0 {
+		if _, resp, err := client.client.wrapped.Issues.AddLabelsToIssue(ctx, owner, repo, state.MergeRequestIDInt(ctx), *opt.AddLabels); err != nil {
+			return convertResponse(resp), err
+		}
 	}
 
 	// Remove labels
@@ -43,8 +50,16 @@ func (client *MergeRequestClient) Update(ctx context.Context, opt *scm.UpdateMer
 		}
 	}
 
+	// Request reviewers; unlike GitLab, this adds to the existing reviewers rather than replacing them
+	if opt.Reviewers != nil && len(*opt.Reviewers) > 0 {
+		if _, resp, err := client.client.wrapped.PullRequests.RequestReviewers(ctx, owner, repo, state.MergeRequestIDInt(ctx), go_github.ReviewersRequest{Reviewers: *opt.Reviewers}); err != nil {
+			return convertResponse(resp), err
+		}
+	}
+
 	// Update MR
 	updatePullRequest := &go_github.PullRequest{
+		Body:   opt.Description,
 		Locked: opt.DiscussionLocked,
 	}
 
@@ -54,7 +69,26 @@ func (client *MergeRequestClient) Update(ctx context.Context, opt *scm.UpdateMer
 }
 
 func (client *MergeRequestClient) GetRemoteConfig(ctx context.Context, filename, ref string) (io.Reader, error) {
-	return nil, nil //nolint:nilnil
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, _, _, err := client.client.wrapped.Repositories.GetContents(ctx, owner, repo, filename, &go_github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote raw file: %w", err)
+	}
+
+	if file == nil {
+		return nil, fmt.Errorf("remote path [%s] is not a file", filename)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode remote raw file: %w", err)
+	}
+
+	return strings.NewReader(content), nil
 }
 
 func (client *MergeRequestClient) List(ctx context.Context, options *scm.ListMergeRequestsOptions) ([]scm.ListMergeRequest, error) {
@@ -0,0 +1,175 @@
+package github_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/scm/github"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// The input is validated before any request is sent, with the same errors the
+// GitLab client produces.
+func TestClient_GetProjectFiles_validatesInput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		project string
+		files   []string
+		wantErr string
+	}{
+		{name: "missing project", files: []string{"a.yml"}, wantErr: "Missing required 'project' value for include"},
+		{name: "missing files", project: "jippi/library", wantErr: "Missing list of files to include from project [jippi/library]"},
+		{name: "project without owner", project: "library", files: []string{"a.yml"}, wantErr: "it must be in the format owner/repository"},
+		{name: "nested project", project: "jippi/group/library", files: []string{"a.yml"}, wantErr: "it must be in the format owner/repository"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := state.WithToken(t.Context(), "token")
+			ctx = state.WithBaseURL(ctx, github.DefaultBaseURL)
+
+			client, err := github.NewClient(ctx, nil)
+			require.NoError(t, err)
+
+			_, err = client.GetProjectFiles(ctx, tt.project, nil, tt.files)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// GitHub Enterprise Server serves GraphQL from "/api/graphql" rather than "/graphql"
+func TestClient_GetProjectFiles_enterpriseServer(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"repository":{"file_0":{"text":"label: []"}}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL+"/")
+
+	client, err := github.NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	files, err := client.GetProjectFiles(ctx, "jippi/library", nil, []string{"label.yml"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"label.yml": "label: []"}, files)
+}
+
+func TestClient_Ping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "valid token", status: http.StatusOK},
+		{name: "invalid token", status: http.StatusUnauthorized, wantErr: "could not verify the GitHub token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/rate_limit" || r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusNotFound)
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"resources":{}}`))
+			}))
+			t.Cleanup(server.Close)
+
+			ctx := state.WithToken(t.Context(), "token")
+			ctx = state.WithBaseURL(ctx, server.URL)
+
+			client, err := github.NewClient(ctx, nil)
+			require.NoError(t, err)
+
+			err = client.Ping(ctx)
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_IsSignedTag(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v3/repos/platform/library/git/ref/tags/v1.0.0":
+			w.Write([]byte(`{"ref":"refs/tags/v1.0.0","object":{"type":"tag","sha":"signed"}}`))
+
+		case "/api/v3/repos/platform/library/git/ref/tags/v1.0.1":
+			w.Write([]byte(`{"ref":"refs/tags/v1.0.1","object":{"type":"tag","sha":"unverified"}}`))
+
+		case "/api/v3/repos/platform/library/git/ref/tags/lightweight":
+			w.Write([]byte(`{"ref":"refs/tags/lightweight","object":{"type":"commit","sha":"abc"}}`))
+
+		case "/api/v3/repos/platform/library/git/tags/signed":
+			w.Write([]byte(`{"sha":"signed","verification":{"verified":true,"reason":"valid"}}`))
+
+		case "/api/v3/repos/platform/library/git/tags/unverified":
+			w.Write([]byte(`{"sha":"unverified","verification":{"verified":false,"reason":"unsigned"}}`))
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL+"/")
+
+	client, err := github.NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		tag     string
+		want    bool
+		wantErr bool
+	}{
+		{tag: "v1.0.0", want: true},
+		{tag: "v1.0.1"},
+		{tag: "lightweight"},
+		{tag: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		signed, err := client.IsSignedTag(ctx, "platform/library", tt.tag)
+		if tt.wantErr {
+			require.Error(t, err, tt.tag)
+
+			continue
+		}
+
+		require.NoError(t, err, tt.tag)
+		require.Equal(t, tt.want, signed, tt.tag)
+	}
+}
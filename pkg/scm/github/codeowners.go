@@ -0,0 +1,296 @@
+package github
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+	"github.com/jippi/scm-engine/pkg/scm"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// codeOwnersPaths are the locations GitHub looks for a CODEOWNERS file, in order of precedence
+//
+// See: https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners#codeowners-file-location
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeOwnersRule is a single line in a CODEOWNERS file
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+
+	// owners are the "@user" and "@org/team" owners of the rule, without the "@" prefix.
+	// Email owners can't be mapped to a GitHub user and are ignored.
+	owners []string
+}
+
+// parseCodeOwners parses the content of a CODEOWNERS file.
+//
+// Lines that can't be parsed are skipped, like GitHub does.
+func parseCodeOwners(content string) []codeOwnersRule {
+	var rules []codeOwnersRule
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Strip trailing comments
+		if idx := strings.Index(line, " #"); idx != -1 {
+			line = line[:idx]
+		}
+
+		fields := strings.Fields(line)
+
+		pattern, err := codeOwnersPattern(fields[0])
+		if err != nil {
+			continue
+		}
+
+		rule := codeOwnersRule{pattern: pattern}
+
+		for _, owner := range fields[1:] {
+			if name, ok := strings.CutPrefix(owner, "@"); ok && len(name) > 0 {
+				rule.owners = append(rule.owners, name)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// codeOwnersPattern converts a CODEOWNERS path pattern into a regular expression.
+//
+// The syntax follows .gitignore, with the exception that a trailing "/*" only matches
+// files directly within the directory, not in nested directories.
+func codeOwnersPattern(pattern string) (*regexp.Regexp, error) {
+	// A pattern with a slash at the beginning or middle is relative to the repository root,
+	// otherwise it matches at any depth
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	directory := strings.HasSuffix(pattern, "/")
+
+	pattern = strings.Trim(pattern, "/")
+
+	var expr strings.Builder
+
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+
+			i += 2
+
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+
+			i++
+
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+
+	switch {
+	// "docs/" matches everything within the directory
+	case directory:
+		expr.WriteString("/.*$")
+
+	// "docs/*" and "*.js" only match the files themselves
+	case strings.HasSuffix(pattern, "*"):
+		expr.WriteString("$")
+
+	// "docs" matches both a file and everything within a directory with that name
+	default:
+		expr.WriteString("(?:/.*)?$")
+	}
+
+	return regexp.Compile(expr.String())
+}
+
+// codeOwnersForFiles returns the owners of the provided files, in the order they are listed.
+//
+// The last matching rule in the CODEOWNERS file takes precedence for each file.
+func codeOwnersForFiles(rules []codeOwnersRule, files []string) []string {
+	var owners []string
+
+	seen := map[string]struct{}{}
+
+	for _, file := range files {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if !rules[i].pattern.MatchString(file) {
+				continue
+			}
+
+			for _, owner := range rules[i].owners {
+				if _, ok := seen[owner]; ok {
+					continue
+				}
+
+				seen[owner] = struct{}{}
+				owners = append(owners, owner)
+			}
+
+			break
+		}
+	}
+
+	return owners
+}
+
+// codeOwners returns the code owners of the Pull Request, loading them on first use.
+//
+// The CODEOWNERS file is only needed when assigning reviewers from it, so it's not read by [NewContext].
+// Failing to read it is logged, and leaves the Pull Request without code owners.
+func (client *Client) codeOwners(ctx context.Context, evalContext scm.EvalContext) scm.Actors {
+	githubContext, ok := evalContext.(*Context)
+	if !ok || githubContext.PullRequest.CodeOwners != nil {
+		return evalContext.GetCodeOwners()
+	}
+
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		slogctx.Warn(ctx, "Could not load the code owners of the Pull Request", slog.Any("error", err))
+
+		return nil
+	}
+
+	users, err := loadCodeOwners(ctx, client.newGraphQLClient(ctx), owner, repo, githubContext.PullRequest)
+	if err != nil {
+		slogctx.Warn(ctx, "Could not load the code owners of the Pull Request", slog.Any("error", err))
+
+		return nil
+	}
+
+	// A non-nil list marks the code owners as loaded, even when there are none
+	githubContext.PullRequest.CodeOwners = append([]ContextUser{}, users...)
+
+	return evalContext.GetCodeOwners()
+}
+
+// loadCodeOwners returns the users owning the files changed in the Pull Request, according to the
+// CODEOWNERS file of the base branch. Team owners are resolved into their members.
+//
+// The Pull Request author is never considered a code owner, since they can't review their own changes.
+func loadCodeOwners(ctx context.Context, client *graphql.Client, owner, repo string, pullRequest *ContextPullRequest) ([]ContextUser, error) {
+	var (
+		result    *CodeOwnersResult
+		variables = map[string]any{
+			"owner":  owner,
+			"repo":   repo,
+			"github": pullRequest.BaseRefName + ":" + codeOwnersPaths[0],
+			"root":   pullRequest.BaseRefName + ":" + codeOwnersPaths[1],
+			"docs":   pullRequest.BaseRefName + ":" + codeOwnersPaths[2],
+		}
+	)
+
+	if err := client.Query(ctx, &result, variables); err != nil {
+		return nil, fmt.Errorf("failed to read CODEOWNERS file: %w", err)
+	}
+
+	content := result.content()
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	files := make([]string, 0, len(pullRequest.Files))
+	for _, file := range pullRequest.Files {
+		files = append(files, file.Path)
+	}
+
+	var (
+		users []ContextUser
+		seen  = map[string]struct{}{}
+	)
+
+	if pullRequest.Author != nil {
+		seen[pullRequest.Author.Login] = struct{}{}
+	}
+
+	add := func(login string) {
+		if _, ok := seen[login]; ok {
+			return
+		}
+
+		seen[login] = struct{}{}
+		users = append(users, ContextUser{Login: login})
+	}
+
+	for _, codeOwner := range codeOwnersForFiles(parseCodeOwners(content), files) {
+		org, team, isTeam := strings.Cut(codeOwner, "/")
+		if !isTeam {
+			add(codeOwner)
+
+			continue
+		}
+
+		for _, member := range loadTeamMembers(ctx, client, org, team) {
+			add(member.Login)
+		}
+	}
+
+	return users, nil
+}
+
+// loadTeamMembers returns the members of an organization team.
+//
+// A team that can't be found (or isn't visible to the token) has no members.
+func loadTeamMembers(ctx context.Context, client *graphql.Client, org, team string) []ContextUser {
+	var (
+		result    *TeamMembersResult
+		variables = map[string]any{
+			"org":  org,
+			"slug": team,
+		}
+	)
+
+	// Reading teams requires the "read:org" scope (or "members" permission for GitHub Apps), which the token
+	// might not have; that should not fail the whole evaluation
+	if err := client.Query(ctx, &result, variables); err != nil {
+		slogctx.Warn(ctx, "Could not read members of code owner team, ignoring it", slog.String("team", org+"/"+team), slog.Any("error", err))
+
+		return nil
+	}
+
+	if result == nil || result.Organization == nil || result.Organization.Team == nil {
+		slogctx.Warn(ctx, "Could not find code owner team, ignoring it", slog.String("team", org+"/"+team))
+
+		return nil
+	}
+
+	return result.Organization.Team.Members.Nodes
+}
+
+// content returns the first CODEOWNERS file found, in the order GitHub looks for them
+func (result *CodeOwnersResult) content() string {
+	if result == nil || result.Repository == nil {
+		return ""
+	}
+
+	for _, object := range []*BlobObject{result.Repository.GitHub, result.Repository.Root, result.Repository.Docs} {
+		if object != nil && object.Blob.Text != nil {
+			return *object.Blob.Text
+		}
+	}
+
+	return ""
+}
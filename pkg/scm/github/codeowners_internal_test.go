@@ -0,0 +1,209 @@
+//nolint:testpackage // the CODEOWNERS parser is unexported
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from the GitHub documentation on CODEOWNERS syntax
+func TestCodeOwnersPattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "*",
+			match:   []string{"README.md", "src/main.go"},
+		},
+		{
+			pattern: "*.js",
+			match:   []string{"app.js", "src/app.js"},
+			noMatch: []string{"app.jsx", "app.ts"},
+		},
+		{
+			pattern: "/build/logs/",
+			match:   []string{"build/logs/today.log", "build/logs/nested/today.log"},
+			noMatch: []string{"src/build/logs/today.log", "build/logs"},
+		},
+		{
+			pattern: "docs/*",
+			match:   []string{"docs/getting-started.md"},
+			noMatch: []string{"docs/build-app/troubleshooting.md", "src/docs/getting-started.md"},
+		},
+		{
+			pattern: "apps/",
+			match:   []string{"apps/web/index.js", "src/apps/web/index.js"},
+			noMatch: []string{"apps"},
+		},
+		{
+			pattern: "/docs",
+			match:   []string{"docs", "docs/index.md", "docs/nested/index.md"},
+			noMatch: []string{"src/docs/index.md", "docs.md"},
+		},
+		{
+			pattern: "**/logs",
+			match:   []string{"logs/today.log", "build/logs/today.log", "deeply/nested/logs/today.log"},
+			noMatch: []string{"build/logs.txt"},
+		},
+		{
+			pattern: "/apps/**/config.yml",
+			match:   []string{"apps/config.yml", "apps/web/config.yml", "apps/web/nested/config.yml"},
+			noMatch: []string{"src/apps/config.yml"},
+		},
+		{
+			pattern: "file?.txt",
+			match:   []string{"file1.txt"},
+			noMatch: []string{"file10.txt", "file.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			t.Parallel()
+
+			pattern, err := codeOwnersPattern(tt.pattern)
+			require.NoError(t, err)
+
+			for _, path := range tt.match {
+				require.True(t, pattern.MatchString(path), "expected [%s] to match [%s]", tt.pattern, path)
+			}
+
+			for _, path := range tt.noMatch {
+				require.False(t, pattern.MatchString(path), "expected [%s] to not match [%s]", tt.pattern, path)
+			}
+		})
+	}
+}
+
+func TestCodeOwnersForFiles(t *testing.T) {
+	t.Parallel()
+
+	rules := parseCodeOwners(`
+# Default owners for everything in the repo
+*       @global-owner user@example.com
+
+*.js    @js-owner # JavaScript
+/docs/  @jippi/docs-team @docs-owner
+
+# Nobody owns the generated files
+/docs/generated/
+`)
+
+	require.Len(t, rules, 4)
+
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{name: "default owner", files: []string{"main.go"}, want: []string{"global-owner"}},
+		{name: "last matching rule wins", files: []string{"src/app.js"}, want: []string{"js-owner"}},
+		{name: "team owner", files: []string{"docs/index.md"}, want: []string{"jippi/docs-team", "docs-owner"}},
+		{name: "rule without owners", files: []string{"docs/generated/api.md"}, want: nil},
+		{
+			name:  "owners of every file, without duplicates",
+			files: []string{"main.go", "docs/index.md", "app.js", "other.go"},
+			want:  []string{"global-owner", "jippi/docs-team", "docs-owner", "js-owner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, codeOwnersForFiles(rules, tt.files))
+		})
+	}
+}
+
+func TestCodeOwnersResult_content(t *testing.T) {
+	t.Parallel()
+
+	github, root := "* @github", "* @root"
+
+	require.Empty(t, (*CodeOwnersResult)(nil).content())
+	require.Empty(t, (&CodeOwnersResult{}).content())
+	require.Empty(t, (&CodeOwnersResult{Repository: &CodeOwnersRepository{}}).content())
+	require.Equal(t, root, (&CodeOwnersResult{Repository: &CodeOwnersRepository{
+		Root: &BlobObject{Blob: BlobNode{Text: &root}},
+	}}).content())
+
+	// ".github/CODEOWNERS" takes precedence over the other locations
+	require.Equal(t, github, (&CodeOwnersResult{Repository: &CodeOwnersRepository{
+		GitHub: &BlobObject{Blob: BlobNode{Text: &github}},
+		Root:   &BlobObject{Blob: BlobNode{Text: &root}},
+	}}).content())
+}
+
+// The CODEOWNERS file is read when the code owners are first needed, and a failure to read it leaves
+// the Pull Request without code owners instead of failing the evaluation
+func TestClient_codeOwners(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   scm.Actors
+	}{
+		{
+			name:   "loaded",
+			status: http.StatusOK,
+			body:   `{"data":{"repository":{"github":{"text":"* @user1 @author"},"root":null,"docs":null}}}`,
+			want:   scm.Actors{{Username: "user1"}},
+		},
+		{
+			name:   "failure",
+			status: http.StatusInternalServerError,
+			body:   `{"message":"boom"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+
+				require.Equal(t, "/api/graphql", r.URL.Path)
+
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(server.Close)
+
+			ctx := state.WithToken(t.Context(), "token")
+			ctx = state.WithBaseURL(ctx, server.URL)
+			ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+
+			client, err := NewClient(ctx, nil)
+			require.NoError(t, err)
+
+			evalContext := &Context{PullRequest: &ContextPullRequest{
+				BaseRefName: "main",
+				Author:      &ContextUser{Login: "author"},
+				Files:       []PullRequestChangedFile{{Path: "main.go"}},
+			}}
+
+			require.Equal(t, tt.want, client.codeOwners(ctx, evalContext))
+			require.Equal(t, tt.want, client.codeOwners(ctx, evalContext))
+
+			if tt.status == http.StatusOK {
+				require.Equal(t, int32(1), requests.Load(), "the code owners are only loaded once")
+			}
+		})
+	}
+}
@@ -2,29 +2,23 @@ package github
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"github.com/hasura/go-graphql-client"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
-	"golang.org/x/oauth2"
 )
 
 var _ scm.EvalContext = (*Context)(nil)
 
-func NewContext(ctx context.Context, _, token string) (*Context, error) {
-	httpClient := oauth2.NewClient(
-		ctx,
-		oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: token,
-			},
-		),
-	)
-
-	owner, repo := ownerAndRepo(ctx)
+func NewContext(ctx context.Context, baseURL string, httpClient *http.Client) (*Context, error) {
+	owner, repo, err := ownerAndRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	client := graphql.NewClient("https://api.github.com/graphql", httpClient)
+	client := graphql.NewClient(graphqlURL(baseURL), httpClient)
 
 	var (
 		evalContext *Context
@@ -35,7 +29,8 @@ func NewContext(ctx context.Context, _, token string) (*Context, error) {
 		}
 	)
 
-	if err := client.Query(ctx, &evalContext, variables); err != nil {
+	err = client.Query(ctx, &evalContext, variables)
+	if err != nil {
 		return nil, err
 	}
 
@@ -77,6 +72,42 @@ func NewContext(ctx context.Context, _, token string) (*Context, error) {
 		evalContext.PullRequest.TimeBetweenFirstAndLastCommit = &tmp
 	}
 
+	evalContext.PullRequest.CurrentUser = evalContext.Viewer
+
+	// Move 'comments' to PR context without nesting
+	if evalContext.PullRequest.ResponseComments != nil {
+		evalContext.PullRequest.Comments = evalContext.PullRequest.ResponseComments.Nodes
+		evalContext.PullRequest.ResponseComments = nil
+	}
+
+	// Move 'reviews' to PR context without nesting
+	if evalContext.PullRequest.ResponseReviews != nil {
+		evalContext.PullRequest.Reviews = evalContext.PullRequest.ResponseReviews.Nodes
+		evalContext.PullRequest.ResponseReviews = nil
+	}
+
+	// Flatten the comments of all review threads into the PR context
+	if evalContext.PullRequest.ResponseReviewThreads != nil {
+		for _, thread := range evalContext.PullRequest.ResponseReviewThreads.Nodes {
+			if thread.ResponseComments != nil {
+				evalContext.PullRequest.ReviewComments = append(evalContext.PullRequest.ReviewComments, thread.ResponseComments.Nodes...)
+			}
+		}
+
+		evalContext.PullRequest.ResponseReviewThreads = nil
+	}
+
+	// Move the matching fragment of each timeline item to PR context without nesting
+	if evalContext.PullRequest.ResponseTimelineItems != nil {
+		for _, item := range evalContext.PullRequest.ResponseTimelineItems.Nodes {
+			if event := item.event(); event != nil {
+				evalContext.PullRequest.TimelineEvents = append(evalContext.PullRequest.TimelineEvents, *event)
+			}
+		}
+
+		evalContext.PullRequest.ResponseTimelineItems = nil
+	}
+
 	return evalContext, nil
 }
 
@@ -126,19 +157,58 @@ func (c *Context) AllowPipelineFailure(ctx context.Context) bool {
 	return len(c.PullRequest.findModifiedFiles(state.ConfigFilePath(ctx))) == 1
 }
 
+// GetCodeOwners returns the eligible code owners for the Pull Request
+//
+// This is based on the CODEOWNERS file of the base branch, with teams resolved into their members.
+// The code owners are only known once loaded by [Client.AssignReviewers].
 func (c *Context) GetCodeOwners() scm.Actors {
-	// unimplemented
-	return make(scm.Actors, 0)
+	actors := make(scm.Actors, 0, len(c.PullRequest.CodeOwners))
+
+	for _, user := range c.PullRequest.CodeOwners {
+		actors.Add(user.ToActor())
+	}
+
+	return actors
 }
 
+// GetReviewers returns the users requested to review the Pull Request, including the
+// ones that already submitted a review.
 func (c *Context) GetReviewers() scm.Actors {
-	// unimplemented
-	return make(scm.Actors, 0)
+	actors := make(scm.Actors, 0)
+
+	if c.PullRequest.ResponseReviewRequests != nil {
+		for _, request := range c.PullRequest.ResponseReviewRequests.Nodes {
+			if request.RequestedReviewer == nil || request.RequestedReviewer.User == nil {
+				continue
+			}
+
+			if actor := request.RequestedReviewer.User.ToActor(); !actors.Has(actor) {
+				actors.Add(actor)
+			}
+		}
+	}
+
+	if c.PullRequest.ResponseLatestReviews != nil {
+		for _, review := range c.PullRequest.ResponseLatestReviews.Nodes {
+			if review.Author == nil {
+				continue
+			}
+
+			if actor := review.Author.ToActor(); !actors.Has(actor) {
+				actors.Add(actor)
+			}
+		}
+	}
+
+	return actors
 }
 
 func (c *Context) GetAuthor() scm.Actor {
-	// unimplemented
-	return scm.Actor{}
+	if c.PullRequest.Author == nil {
+		return scm.Actor{}
+	}
+
+	return c.PullRequest.Author.ToActor()
 }
 
 func (c *Context) GetLabels() []string {
@@ -150,3 +220,41 @@ func (c *Context) GetLabels() []string {
 
 	return labels
 }
+
+// ToActor converts a GitHub user to a SCM agnostic actor.
+//
+// GitHub users are identified by their login, which is also what the review request API uses.
+func (u ContextUser) ToActor() scm.Actor {
+	return scm.Actor{
+		Username: u.Login,
+		IsBot:    u.isBot(),
+	}
+}
+
+// isBot returns whether the user is a GitHub App acting on its own behalf
+func (u ContextUser) isBot() bool {
+	return u.Typename != nil && *u.Typename == "Bot"
+}
+
+// event returns the event of the timeline item, regardless of its type
+func (item ContextTimelineItem) event() *ContextTimelineEvent {
+	for _, event := range []*ContextTimelineEvent{
+		item.LabeledEvent,
+		item.UnlabeledEvent,
+		item.AssignedEvent,
+		item.UnassignedEvent,
+		item.ReviewRequestedEvent,
+		item.ReadyForReviewEvent,
+		item.ConvertToDraftEvent,
+		item.HeadRefForcePushedEvent,
+		item.RenamedTitleEvent,
+		item.ClosedEvent,
+		item.ReopenedEvent,
+	} {
+		if event != nil {
+			return event
+		}
+	}
+
+	return nil
+}
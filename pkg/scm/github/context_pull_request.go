@@ -1,11 +1,46 @@
 package github
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/jippi/scm-engine/pkg/config"
 	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/stdlib"
+	slogctx "github.com/veqryn/slog-context"
 )
 
+func withFunction(in string) slog.Attr {
+	return slog.String("function_name", in)
+}
+
+func withResult(in bool) slog.Attr {
+	return slog.Bool("function_result", in)
+}
+
+func withInput(in any) slog.Attr {
+	return slog.Any("function_argument", in)
+}
+
+func withComparisonValue(in any) slog.Attr {
+	return slog.Any("function_comparison_value", in)
+}
+
+func withSubCondition(in string) slog.Attr {
+	return slog.String("function_sub_condition_that_matched", in)
+}
+
+const defaultScriptEvalResult = "script function eval result"
+
+// activity is a single comment, review, review comment or timeline event on a Pull Request
+type activity struct {
+	kind   string
+	author *ContextUser
+	at     time.Time
+}
+
 func (e ContextPullRequest) IsApproved() bool {
 	return e.ReviewDecision == PullRequestReviewDecisionApproved
 }
@@ -38,6 +73,170 @@ func (e ContextPullRequest) HasNoLabel(in string) bool {
 	return !e.HasLabel(in)
 }
 
+// has_no_activity_within
+func (e ContextPullRequest) HasNoActivityWithin(ctx context.Context, input any) bool {
+	val := !e.HasAnyActivityWithin(ctx, input)
+
+	slogctx.Debug(ctx, defaultScriptEvalResult,
+		withFunction("pull_request.has_no_activity_within"),
+		withResult(val),
+	)
+
+	return val
+}
+
+// has_activity_within (alias)
+func (e ContextPullRequest) HasActivityWithin(ctx context.Context, input any) bool {
+	val := e.HasAnyActivityWithin(ctx, input)
+
+	slogctx.Debug(ctx, defaultScriptEvalResult,
+		withFunction("pull_request.has_activity_within"),
+		withResult(val),
+	)
+
+	return val
+}
+
+// has_any_activity_within
+func (e ContextPullRequest) HasAnyActivityWithin(ctx context.Context, input any) bool {
+	dur := stdlib.ToDuration(input)
+	now := time.Now()
+	cfg := config.FromContext(ctx)
+
+	ctx = slogctx.With(ctx,
+		withFunction("pull_request.has_any_activity_within"),
+		withInput(dur),
+	)
+
+	// If the PR UpdatedAt has been updated within the duration, then we got some kind of activity
+	if now.Sub(e.UpdatedAt) < dur {
+		slogctx.Debug(ctx, defaultScriptEvalResult,
+			withResult(true),
+			withSubCondition("updated_with_duration"),
+			withComparisonValue(e.UpdatedAt),
+		)
+
+		return true
+	}
+
+	// If we have a recent commit, check if its within the duration
+	if e.LastCommit != nil && now.Sub(e.LastCommit.CommittedDate) < dur {
+		slogctx.Debug(ctx, defaultScriptEvalResult,
+			withResult(true),
+			withSubCondition("last_commit_created_at"),
+			withComparisonValue(e.LastCommit.CommittedDate),
+		)
+
+		return true
+	}
+
+	for _, activity := range e.activities() {
+		// Check if we should ignore the actor (user) activity
+		if activity.author != nil && cfg.IgnoreActivityFrom.Matches(activity.author.ToActor()) {
+			continue
+		}
+
+		// Check is within the configured duration
+		if now.Sub(activity.at) < dur {
+			slogctx.Debug(ctx, defaultScriptEvalResult,
+				withResult(true),
+				withSubCondition(activity.kind),
+				withComparisonValue(activity.at),
+			)
+
+			return true
+		}
+	}
+
+	slogctx.Debug(ctx, defaultScriptEvalResult,
+		withResult(false),
+		withSubCondition("default"),
+	)
+
+	// No positive matches, so we conclude there was no activity
+	return false
+}
+
+// has_no_user_activity_within
+func (e ContextPullRequest) HasNoUserActivityWithin(ctx context.Context, input any) bool {
+	val := !e.HasUserActivityWithin(ctx, input)
+
+	slogctx.Debug(ctx, defaultScriptEvalResult,
+		withFunction("pull_request.has_no_user_activity_within"),
+		withResult(val),
+	)
+
+	return val
+}
+
+// has_user_activity_within
+func (e ContextPullRequest) HasUserActivityWithin(ctx context.Context, input any) bool {
+	dur := stdlib.ToDuration(input)
+	now := time.Now()
+	cfg := config.FromContext(ctx)
+
+	ctx = slogctx.With(ctx,
+		withFunction("pull_request.has_user_activity_within"),
+		withInput(dur),
+	)
+
+	for _, activity := range e.activities() {
+		// Activity by deleted ("ghost") users can't be attributed to anyone
+		if activity.author == nil {
+			continue
+		}
+
+		// Check if we should ignore the actor (user) activity
+		if cfg.IgnoreActivityFrom.Matches(activity.author.ToActor()) {
+			continue
+		}
+
+		// Ignore all bots when considering 'user' activity
+		if activity.author.isBot() {
+			continue
+		}
+
+		// Ignore "scm-engine" activity since we shouldn't consider ourself a user.
+		if e.CurrentUser != nil && e.CurrentUser.Login == activity.author.Login {
+			continue
+		}
+
+		// Check if the activity is within the duration
+		if now.Sub(activity.at) < dur {
+			slogctx.Debug(ctx, defaultScriptEvalResult,
+				withResult(true),
+				withSubCondition(activity.kind),
+				withComparisonValue(activity.at),
+			)
+
+			return true
+		}
+	}
+
+	// NOTE: we can't use the "UpdatedAt" timestamp on the PullRequest because we
+	//       can't guarantee it was a user activity change that bumped the timestamp;
+	//       use the "has_any_activity_within" function instead for that
+
+	// If we have a recent commit, check if its within the duration
+	if e.LastCommit != nil && now.Sub(e.LastCommit.CommittedDate) < dur {
+		slogctx.Debug(ctx, defaultScriptEvalResult,
+			withResult(true),
+			withSubCondition("last_commit_created_at"),
+			withComparisonValue(e.LastCommit.CommittedDate),
+		)
+
+		return true
+	}
+
+	slogctx.Debug(ctx, defaultScriptEvalResult,
+		withResult(false),
+		withSubCondition("default"),
+	)
+
+	// No positive matches, so we conclude there was no activity
+	return false
+}
+
 func (e ContextPullRequest) ModifiedFilesList(patterns ...string) []string {
 	return e.findModifiedFiles(patterns...)
 }
@@ -55,3 +254,31 @@ func (e ContextPullRequest) findModifiedFiles(patterns ...string) []string {
 
 	return scm.FindModifiedFiles(files, patterns...)
 }
+
+// activities returns the comments, reviews, review comments and timeline events on the Pull Request
+func (e ContextPullRequest) activities() []activity {
+	activities := make([]activity, 0, len(e.Comments)+len(e.Reviews)+len(e.ReviewComments)+len(e.TimelineEvents))
+
+	for _, comment := range e.Comments {
+		activities = append(activities, activity{kind: "comment_updated_at", author: comment.Author, at: comment.UpdatedAt})
+	}
+
+	for _, review := range e.Reviews {
+		// Pending reviews are only visible to their author, and not activity until submitted
+		if review.SubmittedAt == nil {
+			continue
+		}
+
+		activities = append(activities, activity{kind: "review_updated_at", author: review.Author, at: review.UpdatedAt})
+	}
+
+	for _, comment := range e.ReviewComments {
+		activities = append(activities, activity{kind: "review_comment_updated_at", author: comment.Author, at: comment.UpdatedAt})
+	}
+
+	for _, event := range e.TimelineEvents {
+		activities = append(activities, activity{kind: "timeline_event_created_at", author: event.Actor, at: event.CreatedAt})
+	}
+
+	return activities
+}
@@ -0,0 +1,214 @@
+package github_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm/github"
+	"github.com/stretchr/testify/require"
+)
+
+// activityContext returns a context carrying the configuration the activity
+// helpers read to decide whose activity should be ignored.
+func activityContext(t *testing.T, ignore config.IgnoreActivityFrom) context.Context {
+	t.Helper()
+
+	return config.WithConfig(t.Context(), &config.Config{IgnoreActivityFrom: ignore})
+}
+
+func user(login string) *github.ContextUser {
+	return &github.ContextUser{Login: login}
+}
+
+func bot(login string) *github.ContextUser {
+	typename := "Bot"
+
+	return &github.ContextUser{Login: login, Typename: &typename}
+}
+
+func TestHasAnyActivityWithin(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now    = time.Now()
+		recent = now.Add(-1 * time.Hour)
+		old    = now.Add(-30 * 24 * time.Hour)
+	)
+
+	tests := []struct {
+		name string
+		pr   github.ContextPullRequest
+		want bool
+	}{
+		{
+			name: "pull request itself was updated recently",
+			pr:   github.ContextPullRequest{UpdatedAt: recent},
+			want: true,
+		},
+		{
+			name: "nothing happened at all",
+			pr:   github.ContextPullRequest{UpdatedAt: old},
+			want: false,
+		},
+		{
+			name: "a recent commit counts as activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, LastCommit: &github.ContextCommit{CommittedDate: recent}},
+			want: true,
+		},
+		{
+			name: "an old commit does not",
+			pr:   github.ContextPullRequest{UpdatedAt: old, LastCommit: &github.ContextCommit{CommittedDate: old}},
+			want: false,
+		},
+		{
+			name: "a recent comment from a bot counts as activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Comments: []github.ContextComment{{UpdatedAt: recent, Author: bot("renovate")}}},
+			want: true,
+		},
+		{
+			name: "a recent review counts as activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Reviews: []github.ContextPullRequestReview{{UpdatedAt: recent, SubmittedAt: &recent, Author: user("human")}}},
+			want: true,
+		},
+		{
+			name: "a pending review does not",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Reviews: []github.ContextPullRequestReview{{UpdatedAt: recent, Author: user("human")}}},
+			want: false,
+		},
+		{
+			name: "a recent review comment counts as activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, ReviewComments: []github.ContextComment{{UpdatedAt: recent, Author: user("human")}}},
+			want: true,
+		},
+		{
+			name: "a recent timeline event counts as activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, TimelineEvents: []github.ContextTimelineEvent{{CreatedAt: recent, Actor: user("human")}}},
+			want: true,
+		},
+		{
+			name: "old comments and events do not",
+			pr: github.ContextPullRequest{
+				UpdatedAt:      old,
+				Comments:       []github.ContextComment{{UpdatedAt: old, Author: user("human")}},
+				TimelineEvents: []github.ContextTimelineEvent{{CreatedAt: old, Actor: user("human")}},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := activityContext(t, config.IgnoreActivityFrom{})
+
+			require.Equal(t, tt.want, tt.pr.HasAnyActivityWithin(ctx, "7d"))
+			require.Equal(t, tt.want, tt.pr.HasActivityWithin(ctx, "7d"), "has_activity_within is an alias")
+			require.Equal(t, !tt.want, tt.pr.HasNoActivityWithin(ctx, "7d"), "has_no_activity_within is the inverse")
+		})
+	}
+}
+
+// ignore_activity_from is applied to every kind of activity, so an ignored actor
+// must not keep a Pull Request looking alive.
+func TestHasAnyActivityWithin_respectsIgnoreActivityFrom(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now    = time.Now()
+		recent = now.Add(-1 * time.Hour)
+		old    = now.Add(-30 * 24 * time.Hour)
+	)
+
+	pr := github.ContextPullRequest{
+		UpdatedAt:      old,
+		Comments:       []github.ContextComment{{UpdatedAt: recent, Author: bot("renovate")}},
+		TimelineEvents: []github.ContextTimelineEvent{{CreatedAt: recent, Actor: bot("renovate")}},
+	}
+
+	require.True(t, pr.HasAnyActivityWithin(activityContext(t, config.IgnoreActivityFrom{}), "7d"))
+
+	ignored := activityContext(t, config.IgnoreActivityFrom{Usernames: []string{"renovate"}})
+	require.False(t, pr.HasAnyActivityWithin(ignored, "7d"))
+
+	ignoredBots := activityContext(t, config.IgnoreActivityFrom{IsBot: true})
+	require.False(t, pr.HasAnyActivityWithin(ignoredBots, "7d"))
+}
+
+func TestHasUserActivityWithin(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now    = time.Now()
+		recent = now.Add(-1 * time.Hour)
+		old    = now.Add(-30 * 24 * time.Hour)
+	)
+
+	tests := []struct {
+		name string
+		pr   github.ContextPullRequest
+		want bool
+	}{
+		{
+			name: "a recent comment from a human",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Comments: []github.ContextComment{{UpdatedAt: recent, Author: user("human")}}},
+			want: true,
+		},
+		{
+			name: "a recent comment from a bot is not user activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Comments: []github.ContextComment{{UpdatedAt: recent, Author: bot("renovate")}}},
+			want: false,
+		},
+		{
+			name: "a recent comment from scm-engine itself is not user activity",
+			pr: github.ContextPullRequest{
+				UpdatedAt:   old,
+				CurrentUser: user("scm-engine"),
+				Comments:    []github.ContextComment{{UpdatedAt: recent, Author: user("scm-engine")}},
+			},
+			want: false,
+		},
+		{
+			name: "a recent label added by scm-engine itself is not user activity",
+			pr: github.ContextPullRequest{
+				UpdatedAt:      old,
+				CurrentUser:    user("scm-engine"),
+				TimelineEvents: []github.ContextTimelineEvent{{CreatedAt: recent, Actor: user("scm-engine")}},
+			},
+			want: false,
+		},
+		{
+			name: "a recent comment from a deleted user is not user activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, Comments: []github.ContextComment{{UpdatedAt: recent}}},
+			want: false,
+		},
+		{
+			name: "a recent review comment from a human",
+			pr:   github.ContextPullRequest{UpdatedAt: old, ReviewComments: []github.ContextComment{{UpdatedAt: recent, Author: user("human")}}},
+			want: true,
+		},
+		{
+			name: "the pull request being updated is not user activity",
+			pr:   github.ContextPullRequest{UpdatedAt: recent},
+			want: false,
+		},
+		{
+			name: "a recent commit counts as user activity",
+			pr:   github.ContextPullRequest{UpdatedAt: old, LastCommit: &github.ContextCommit{CommittedDate: recent}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := activityContext(t, config.IgnoreActivityFrom{})
+
+			require.Equal(t, tt.want, tt.pr.HasUserActivityWithin(ctx, "7d"))
+			require.Equal(t, !tt.want, tt.pr.HasNoUserActivityWithin(ctx, "7d"), "has_no_user_activity_within is the inverse")
+		})
+	}
+}
@@ -249,14 +249,50 @@ func TestContext_ActionGroupTracking_ignoresUngrouped(t *testing.T) {
 	require.False(t, evalContext.HasExecutedActionGroup(""))
 }
 
-// These are documented as unimplemented on GitHub; assert the contract so a
-// future implementation has to update the tests deliberately.
-func TestContext_unimplementedAccessors(t *testing.T) {
+func TestContext_GetCodeOwners(t *testing.T) {
 	t.Parallel()
 
-	evalContext := &github.Context{}
+	evalContext := &github.Context{PullRequest: &github.ContextPullRequest{
+		CodeOwners: []github.ContextUser{{Login: "alice"}, {Login: "bob"}},
+	}}
+
+	require.Equal(t, scm.Actors{{Username: "alice"}, {Username: "bob"}}, evalContext.GetCodeOwners())
+	require.Empty(t, (&github.Context{PullRequest: &github.ContextPullRequest{}}).GetCodeOwners())
+}
+
+// Reviewers drop out of the review requests once they have submitted a review, so
+// both requested reviewers and reviews count as assigned.
+func TestContext_GetReviewers(t *testing.T) {
+	t.Parallel()
+
+	evalContext := &github.Context{PullRequest: &github.ContextPullRequest{
+		ResponseReviewRequests: &github.ContextReviewRequestConnection{
+			Nodes: []github.ContextReviewRequest{
+				{RequestedReviewer: &github.ContextRequestedReviewer{User: &github.ContextUser{Login: "alice"}}},
+				// A requested team
+				{RequestedReviewer: &github.ContextRequestedReviewer{}},
+			},
+		},
+		ResponseLatestReviews: &github.ContextPullRequestReviewConnection{
+			Nodes: []github.ContextPullRequestReview{
+				{Author: &github.ContextUser{Login: "bob"}},
+				{Author: &github.ContextUser{Login: "alice"}},
+				{Author: nil},
+			},
+		},
+	}}
+
+	require.Equal(t, scm.Actors{{Username: "alice"}, {Username: "bob"}}, evalContext.GetReviewers())
+	require.Empty(t, (&github.Context{PullRequest: &github.ContextPullRequest{}}).GetReviewers())
+}
+
+func TestContext_GetAuthor(t *testing.T) {
+	t.Parallel()
+
+	evalContext := &github.Context{PullRequest: &github.ContextPullRequest{Author: &github.ContextUser{Login: "alice"}}}
+
+	require.Equal(t, scm.Actor{Username: "alice"}, evalContext.GetAuthor())
 
-	require.Empty(t, evalContext.GetCodeOwners())
-	require.Empty(t, evalContext.GetReviewers())
-	require.Equal(t, scm.Actor{}, evalContext.GetAuthor())
+	// The author is null when the account has been deleted
+	require.Equal(t, scm.Actor{}, (&github.Context{PullRequest: &github.ContextPullRequest{}}).GetAuthor())
 }
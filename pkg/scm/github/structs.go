@@ -0,0 +1,273 @@
+package github
+
+// RepositoryAffiliation is the GraphQL enum used to filter the repositories of a user.
+//
+// The Go type name is used as the GraphQL variable type, so it must match the schema.
+type RepositoryAffiliation string
+
+const (
+	RepositoryAffiliationOwner              RepositoryAffiliation = "OWNER"
+	RepositoryAffiliationCollaborator       RepositoryAffiliation = "COLLABORATOR"
+	RepositoryAffiliationOrganizationMember RepositoryAffiliation = "ORGANIZATION_MEMBER"
+)
+
+// PeriodicEvaluationResult structs maps to the GraphQL query used to find Pull Requests
+// that should be periodically evaluated.
+//
+// GraphQL query:
+//
+//	query (
+//	  $cursor: String,
+//	  $affiliations: [RepositoryAffiliation!]!,
+//	  $scm_config_file_expression: String!
+//	) {
+//	  viewer {
+//	    repositories(
+//	      first: 25,
+//	      after: $cursor,
+//	      affiliations: $affiliations,
+//	      ownerAffiliations: $affiliations,
+//	      isArchived: false
+//	    ) {
+//	      pageInfo {
+//	        hasNextPage
+//	        endCursor
+//	      }
+//	      nodes {
+//	        nameWithOwner
+//	        repositoryTopics(first: 20) {
+//	          nodes {
+//	            topic {
+//	              name
+//	            }
+//	          }
+//	        }
+//	        config: object(expression: $scm_config_file_expression) {
+//	          ... on Blob {
+//	            text
+//	          }
+//	        }
+//	        pullRequests(first: 100, states: OPEN, orderBy: {field: UPDATED_AT, direction: ASC}) {
+//	          pageInfo {
+//	            hasNextPage
+//	            endCursor
+//	          }
+//	          nodes {
+//	            number
+//	            headRefOid
+//	            labels(first: 50) {
+//	              nodes {
+//	                name
+//	              }
+//	            }
+//	            commits(last: 1) {
+//	              nodes {
+//	                commit {
+//	                  statusCheckRollup {
+//	                    state
+//	                  }
+//	                }
+//	              }
+//	            }
+//	          }
+//	        }
+//	      }
+//	    }
+//	  }
+//	}
+//
+// Query Variables
+//
+//	{
+//	  "cursor": null,
+//	  "affiliations": ["OWNER", "COLLABORATOR"],
+//	  "scm_config_file_expression": "HEAD:.scm-engine.yml"
+//	}
+type PeriodicEvaluationResult struct {
+	Viewer PeriodicEvaluationViewer `graphql:"viewer"`
+}
+
+type PeriodicEvaluationViewer struct {
+	// Repositories contains up to 25 repositories (per page) the token has access to
+	Repositories PeriodicEvaluationRepositoryConnection `graphql:"repositories(first: 25, after: $cursor, affiliations: $affiliations, ownerAffiliations: $affiliations, isArchived: false)"`
+}
+
+// PeriodicEvaluationRepositoryResult maps to the GraphQL query used to find Pull Requests
+// that should be periodically evaluated in a single repository, used when authenticated as a GitHub App.
+//
+// GraphQL query:
+//
+//	query ($owner: String!, $repo: String!, $scm_config_file_expression: String!) {
+//	  repository(owner: $owner, name: $repo) {
+//	    # same fields as the "repositories" nodes above
+//	  }
+//	}
+type PeriodicEvaluationRepositoryResult struct {
+	Repository *PeriodicEvaluationRepositoryNode `graphql:"repository(owner: $owner, name: $repo)"`
+}
+
+type PeriodicEvaluationRepositoryConnection struct {
+	PageInfo PageInfo                           `graphql:"pageInfo"`
+	Nodes    []PeriodicEvaluationRepositoryNode `graphql:"nodes"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `graphql:"hasNextPage"`
+	EndCursor   *string `graphql:"endCursor"`
+}
+
+type PeriodicEvaluationRepositoryNode struct {
+	// NameWithOwner is the complete owner + repository slug / project identifier for a Repository in GitHub
+	NameWithOwner string `graphql:"nameWithOwner"`
+
+	// RepositoryTopics contains the topics the repository is tagged with
+	RepositoryTopics graphqlNodesOf[RepositoryTopicNode] `graphql:"repositoryTopics(first: 20)"`
+
+	// Config contains the (optional) content of the ".scm-config.yml" file
+	// read from the repository default branch at the time of reading
+	Config *BlobObject `graphql:"config: object(expression: $scm_config_file_expression)"`
+
+	// PullRequests contains the first 100 Pull Requests, sorted by oldest update/last change first.
+	// The remaining ones are read with [PeriodicEvaluationPullRequestsResult]
+	PullRequests PeriodicEvaluationPullRequestConnection `graphql:"pullRequests(first: 100, states: OPEN, orderBy: {field: UPDATED_AT, direction: ASC})"`
+}
+
+type PeriodicEvaluationPullRequestConnection struct {
+	PageInfo PageInfo                            `graphql:"pageInfo"`
+	Nodes    []PeriodicEvaluationPullRequestNode `graphql:"nodes"`
+}
+
+// PeriodicEvaluationPullRequestsResult maps to the GraphQL query used to read the Pull Requests of a
+// repository that did not fit in the first page of [PeriodicEvaluationRepositoryNode.PullRequests].
+//
+// GraphQL query:
+//
+//	query ($owner: String!, $repo: String!, $cursor: String) {
+//	  repository(owner: $owner, name: $repo) {
+//	    pullRequests(first: 100, after: $cursor, states: OPEN, orderBy: {field: UPDATED_AT, direction: ASC}) {
+//	      # same fields as the "pullRequests" of the repository nodes above
+//	    }
+//	  }
+//	}
+type PeriodicEvaluationPullRequestsResult struct {
+	Repository *PeriodicEvaluationPullRequestsRepository `graphql:"repository(owner: $owner, name: $repo)"`
+}
+
+type PeriodicEvaluationPullRequestsRepository struct {
+	PullRequests PeriodicEvaluationPullRequestConnection `graphql:"pullRequests(first: 100, after: $cursor, states: OPEN, orderBy: {field: UPDATED_AT, direction: ASC})"`
+}
+
+type RepositoryTopicNode struct {
+	Topic TopicNode `graphql:"topic"`
+}
+
+type TopicNode struct {
+	Name string `graphql:"name"`
+}
+
+type BlobObject struct {
+	Blob BlobNode `graphql:"... on Blob"`
+}
+
+type BlobNode struct {
+	Text *string `graphql:"text"`
+}
+
+type PeriodicEvaluationPullRequestNode struct {
+	Number     int                                   `graphql:"number"`
+	HeadRefOid string                                `graphql:"headRefOid"`
+	Labels     graphqlNodesOf[LabelNode]             `graphql:"labels(first: 50)"`
+	Commits    graphqlNodesOf[StatusCheckRollupNode] `graphql:"commits(last: 1)"`
+}
+
+type LabelNode struct {
+	Name string `graphql:"name"`
+}
+
+type StatusCheckRollupNode struct {
+	Commit StatusCheckRollupCommit `graphql:"commit"`
+}
+
+type StatusCheckRollupCommit struct {
+	StatusCheckRollup *StatusCheckRollup `graphql:"statusCheckRollup"`
+}
+
+type StatusCheckRollup struct {
+	State string `graphql:"state"`
+}
+
+type graphqlNodesOf[T any] struct {
+	Nodes []T `graphql:"nodes"`
+}
+
+// CodeOwnersResult structs maps to the GraphQL query used to read the CODEOWNERS file
+// from each of the locations GitHub supports.
+//
+// GraphQL query:
+//
+//	query ($owner: String!, $repo: String!, $github: String!, $root: String!, $docs: String!) {
+//	  repository(owner: $owner, name: $repo) {
+//	    github: object(expression: $github) {
+//	      ... on Blob {
+//	        text
+//	      }
+//	    }
+//	    root: object(expression: $root) {
+//	      ... on Blob {
+//	        text
+//	      }
+//	    }
+//	    docs: object(expression: $docs) {
+//	      ... on Blob {
+//	        text
+//	      }
+//	    }
+//	  }
+//	}
+//
+// Query Variables
+//
+//	{
+//	  "owner": "jippi",
+//	  "repo": "scm-engine",
+//	  "github": "main:.github/CODEOWNERS",
+//	  "root": "main:CODEOWNERS",
+//	  "docs": "main:docs/CODEOWNERS"
+//	}
+type CodeOwnersResult struct {
+	Repository *CodeOwnersRepository `graphql:"repository(owner: $owner, name: $repo)"`
+}
+
+type CodeOwnersRepository struct {
+	GitHub *BlobObject `graphql:"github: object(expression: $github)"`
+	Root   *BlobObject `graphql:"root: object(expression: $root)"`
+	Docs   *BlobObject `graphql:"docs: object(expression: $docs)"`
+}
+
+// TeamMembersResult structs maps to the GraphQL query used to resolve a team code owner
+// into its members.
+//
+// GraphQL query:
+//
+//	query ($org: String!, $slug: String!) {
+//	  organization(login: $org) {
+//	    team(slug: $slug) {
+//	      members(first: 100) {
+//	        nodes {
+//	          login
+//	        }
+//	      }
+//	    }
+//	  }
+//	}
+type TeamMembersResult struct {
+	Organization *TeamMembersOrganization `graphql:"organization(login: $org)"`
+}
+
+type TeamMembersOrganization struct {
+	Team *TeamMembersTeam `graphql:"team(slug: $slug)"`
+}
+
+type TeamMembersTeam struct {
+	Members graphqlNodesOf[ContextUser] `graphql:"members(first: 100)"`
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/aquilax/truncate"
 	"github.com/hasura/go-graphql-client"
 	"github.com/jippi/scm-engine/pkg/integration/backstage"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
@@ -70,7 +71,11 @@ type Client struct {
 
 // NewClient creates a new GitLab client with an optional backstage client
 func NewClient(ctx context.Context, backstageClient *backstage.Client) (*Client, error) {
-	client, err := go_gitlab.NewClient(state.Token(ctx), go_gitlab.WithBaseURL(state.BaseURL(ctx)))
+	client, err := go_gitlab.NewClient(
+		state.Token(ctx),
+		go_gitlab.WithBaseURL(state.BaseURL(ctx)),
+		go_gitlab.WithHTTPClient(&http.Client{Transport: metrics.Transport("gitlab", http.DefaultTransport)}),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +196,42 @@ func (client *Client) GetProjectFiles(ctx context.Context, project string, ref *
 	return fileContents, nil
 }
 
+// IsSignedTag returns whether tag in project has a verified X.509 signature
+//
+// GitLab only exposes X.509 tag signatures through its API, so GPG signed tags are reported as unsigned
+func (client *Client) IsSignedTag(ctx context.Context, project, tag string) (bool, error) {
+	signature, response, err := client.wrapped.Tags.GetTagSignature(project, tag, go_gitlab.WithContext(ctx))
+	if err != nil {
+		// Tags that are not signed are answered with 404, like tags that do not exist
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return signature.VerificationStatus == "verified", nil
+}
+
+// HeadCommitSHA returns the HEAD commit of the Merge Request in the context
+func (client *Client) HeadCommitSHA(ctx context.Context) (string, error) {
+	mergeRequest, _, err := client.wrapped.MergeRequests.GetMergeRequest(state.ProjectID(ctx), state.MergeRequestIDInt(ctx), nil, go_gitlab.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	return mergeRequest.SHA, nil
+}
+
+// Ping verifies the token with a cheap authenticated API call
+func (client *Client) Ping(ctx context.Context) error {
+	if _, _, err := client.wrapped.Users.CurrentUser(go_gitlab.WithContext(ctx)); err != nil {
+		return fmt.Errorf("could not verify the GitLab token: %w", err)
+	}
+
+	return nil
+}
+
 // Start pipeline
 func (client *Client) Start(ctx context.Context) error {
 	ok, pattern := state.ShouldUpdatePipeline(ctx)
@@ -313,15 +354,18 @@ func graphqlBaseURL(inputURL *url.URL) string {
 	return buf.String()
 }
 
+// newHTTPClient returns an HTTP client authenticating with token, for the GraphQL API
+func newHTTPClient(token string) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+			Base:   metrics.Transport("gitlab", http.DefaultTransport),
+		},
+	}
+}
+
 func (client Client) newGraphQLClient(ctx context.Context) *graphql.Client {
-	httpClient := oauth2.NewClient(
-		ctx,
-		oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: state.Token(ctx),
-			},
-		),
-	)
+	httpClient := newHTTPClient(state.Token(ctx))
 
 	return graphql.NewClient(
 		graphqlBaseURL(client.wrapped.BaseURL())+"/api/graphql",
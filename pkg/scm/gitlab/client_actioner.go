@@ -5,15 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"reflect"
-	"strings"
 
-	"github.com/expr-lang/expr"
-	"github.com/expr-lang/expr/patcher"
 	"github.com/jippi/scm-engine/pkg/config"
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
-	"github.com/jippi/scm-engine/pkg/stdlib"
 	slogctx "github.com/veqryn/slog-context"
 	"gitlab.com/gitlab-org/api/client-go"
 )
@@ -26,66 +21,7 @@ func (c *Client) ApplyStep(ctx context.Context, evalContext scm.EvalContext, upd
 
 	switch action {
 	case "update_description":
-		// Use the raw MR description
-		body := evalContext.GetDescription()
-
-		// Unless something else already updated the description in the Update struct
-		if update.Description != nil {
-			body = *update.Description
-		}
-
-		replacements, err := step.Get("replace")
-		if err != nil {
-			return err
-		}
-
-		replacementSlice, ok := replacements.(config.ActionStep)
-		if !ok {
-			return fmt.Errorf(`step field 'replace' must be a dictionary with string key and string values ("key": "value"), got: %T`, replacements)
-		}
-
-		replacedAnything := false
-
-		for key, script := range replacementSlice {
-			// If the replacement key do not exist; we can skip the replacement logic entirely!
-			if !strings.Contains(body, key) {
-				continue
-			}
-
-			replacedAnything = true
-
-			// Build the ExprLang VM program
-			// TODO(jippi): make this something generic/shared somewhere more central so we keep settings in sync
-			opts := make([]expr.Option, 0, len(stdlib.Functions)+5)
-			opts = append(opts, expr.AsKind(reflect.TypeFor[string]().Kind()), expr.Env(evalContext), stdlib.FunctionRenamer)
-			opts = append(opts, stdlib.Functions...)
-			opts = append(opts, expr.Patch(patcher.WithContext{Name: "ctx"}))
-
-			program, err := expr.Compile(fmt.Sprintf("%s", script), opts...)
-			if err != nil {
-				return fmt.Errorf("could not evaluate value for 'replace' key '%s': %w", key, err)
-			}
-
-			output, err := expr.Run(program, evalContext)
-			if err != nil {
-				return err
-			}
-
-			switch val := output.(type) {
-			case string:
-				body = strings.ReplaceAll(body, key, val)
-
-			default:
-				return fmt.Errorf("'replace' value for key '%s' did not return a string: %w", key, err)
-			}
-		}
-
-		// Don't update the body if there were no replacements
-		if !replacedAnything {
-			return nil
-		}
-
-		update.Description = &body
+		return config.UpdateDescription(evalContext, update, step, config.DefinitionsFromContext(ctx)...)
 
 	case "add_label":
 		name, err := step.RequiredString("label")
@@ -11,7 +11,6 @@ import (
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	go_gitlab "gitlab.com/gitlab-org/api/client-go"
-	"golang.org/x/oauth2"
 )
 
 var _ scm.MergeRequestClient = (*MergeRequestClient)(nil)
@@ -69,14 +68,7 @@ func (client *MergeRequestClient) GetRemoteConfig(ctx context.Context, filename,
 }
 
 func (client *MergeRequestClient) List(ctx context.Context, options *scm.ListMergeRequestsOptions) ([]scm.ListMergeRequest, error) {
-	httpClient := oauth2.NewClient(
-		ctx,
-		oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: state.Token(ctx),
-			},
-		),
-	)
+	httpClient := newHTTPClient(state.Token(ctx))
 
 	graphqlClient := graphql.NewClient(graphqlBaseURL(client.client.wrapped.BaseURL())+"/api/graphql", httpClient)
 
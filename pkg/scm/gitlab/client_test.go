@@ -0,0 +1,129 @@
+package gitlab_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/scm/gitlab"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Ping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "valid token", status: http.StatusOK},
+		{name: "invalid token", status: http.StatusUnauthorized, wantErr: "could not verify the GitLab token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v4/user" || r.Header.Get("Private-Token") != "token" {
+					w.WriteHeader(http.StatusNotFound)
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"id":1,"username":"scm-engine"}`))
+			}))
+			t.Cleanup(server.Close)
+
+			ctx := state.WithToken(t.Context(), "token")
+			ctx = state.WithBaseURL(ctx, server.URL)
+
+			client, err := gitlab.NewClient(ctx, nil)
+			require.NoError(t, err)
+
+			err = client.Ping(ctx)
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_HeadCommitSHA(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/jippi%2Fscm-engine/merge_requests/42" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"iid":42,"sha":"abc123"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL)
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "42")
+
+	client, err := gitlab.NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	sha, err := client.HeadCommitSHA(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", sha)
+}
+
+func TestClient_IsSignedTag(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/platform%2Flibrary/repository/tags/v1.0.0/signature":
+			w.Write([]byte(`{"signature_type":"X509","verification_status":"verified"}`))
+
+		case "/api/v4/projects/platform%2Flibrary/repository/tags/v1.0.1/signature":
+			w.Write([]byte(`{"signature_type":"X509","verification_status":"unverified"}`))
+
+		case "/api/v4/projects/platform%2Flibrary/repository/tags/broken/signature":
+			w.WriteHeader(http.StatusInternalServerError)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 GPG Signature Not Found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := state.WithToken(t.Context(), "token")
+	ctx = state.WithBaseURL(ctx, server.URL)
+
+	client, err := gitlab.NewClient(ctx, nil)
+	require.NoError(t, err)
+
+	signed, err := client.IsSignedTag(ctx, "platform/library", "v1.0.0")
+	require.NoError(t, err)
+	require.True(t, signed)
+
+	signed, err = client.IsSignedTag(ctx, "platform/library", "v1.0.1")
+	require.NoError(t, err)
+	require.False(t, signed, "the signature is not verified")
+
+	signed, err = client.IsSignedTag(ctx, "platform/library", "unsigned")
+	require.NoError(t, err)
+	require.False(t, signed)
+
+	_, err = client.IsSignedTag(ctx, "platform/library", "broken")
+	require.Error(t, err)
+}
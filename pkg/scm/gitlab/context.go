@@ -8,20 +8,12 @@ import (
 	"github.com/jippi/scm-engine/pkg/scm"
 	"github.com/jippi/scm-engine/pkg/state"
 	slogctx "github.com/veqryn/slog-context"
-	"golang.org/x/oauth2"
 )
 
 var _ scm.EvalContext = (*Context)(nil)
 
 func NewContext(ctx context.Context, baseURL, token string) (*Context, error) {
-	httpClient := oauth2.NewClient(
-		ctx,
-		oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: token,
-			},
-		),
-	)
+	httpClient := newHTTPClient(token)
 
 	client := graphql.NewClient(baseURL+"/api/graphql", httpClient)
 
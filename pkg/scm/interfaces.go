@@ -10,8 +10,10 @@ type Client interface {
 	EvalContext(ctx context.Context) (EvalContext, error)
 	FindMergeRequestsForPeriodicEvaluation(ctx context.Context, filters MergeRequestListFilters) ([]PeriodicEvaluationMergeRequest, error)
 	GetProjectFiles(ctx context.Context, project string, ref *string, files []string) (map[string]string, error)
+	IsSignedTag(ctx context.Context, project, tag string) (bool, error)
 	Labels() LabelClient
 	MergeRequests() MergeRequestClient
+	Ping(ctx context.Context) error
 	Start(ctx context.Context) error
 	Stop(ctx context.Context, err error, allowPipelineFailure bool) error
 }
@@ -43,6 +45,18 @@ type EvalContext interface {
 	GetLabels() []string
 }
 
+// ReviewerSources are the provider specific parts of [SelectReviewers]
+type ReviewerSources interface {
+	// CodeOwners returns the code owners eligible to review the Merge Request
+	CodeOwners(ctx context.Context, evalContext EvalContext) Actors
+	// Backstage returns the owners of the project in the Backstage catalog
+	Backstage(ctx context.Context) (Actors, error)
+	// StaticReviewer returns the reviewer listed in the "user_ids" step field
+	StaticReviewer(id string) Actor
+	// ReviewerKey returns what identifies the actor to the provider, or an empty string when it can't be a reviewer
+	ReviewerKey(actor Actor) string
+}
+
 type ActionStep interface {
 	RequiredInt(name string) (int, error)
 	RequiredString(name string) (string, error)
@@ -0,0 +1,157 @@
+package scm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/jippi/scm-engine/pkg/state"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// ReviewerSelection is the outcome of [SelectReviewers]
+type ReviewerSelection struct {
+	Source string
+	Mode   string
+	Limit  int
+
+	// Reviewers are the newly selected reviewers, which never includes the ones already assigned
+	Reviewers Actors
+}
+
+// SelectReviewers picks the reviewers to request for an "assign_reviewers" action step.
+//
+// The "source", "limit" and "mode" step fields are handled the same way for every provider, while
+// sources provides how the provider identifies reviewers and looks them up.
+func SelectReviewers(ctx context.Context, evalContext EvalContext, step ActionStep, sources ReviewerSources) (ReviewerSelection, error) {
+	var (
+		selection ReviewerSelection
+		err       error
+	)
+
+	selection.Source, err = step.OptionalStringEnum("source", "codeowners", "codeowners", "backstage", "static")
+	if err != nil {
+		return selection, err
+	}
+
+	selection.Limit, err = step.OptionalInt("limit", 1)
+	if err != nil {
+		return selection, err
+	}
+
+	selection.Mode, err = step.OptionalStringEnum("mode", "random", "random", "static")
+	if err != nil {
+		return selection, err
+	}
+
+	// "static" mode assigns an explicitly listed set of reviewers, so it is only
+	// meaningful together with an explicit "static" user list.
+	if selection.Mode == "static" && selection.Source != "static" {
+		return selection, errors.New("step field 'mode: static' is only supported with 'source: static'")
+	}
+
+	// Look up which reviewers are already assigned (or have already reviewed). Both modes
+	// use this to avoid requesting reviews from the same people again.
+	alreadyAssigned := make(map[string]struct{})
+	for _, reviewer := range evalContext.GetReviewers() {
+		if key := sources.ReviewerKey(reviewer); len(key) > 0 {
+			alreadyAssigned[key] = struct{}{}
+		}
+	}
+
+	var eligibleReviewers Actors
+
+	switch selection.Source {
+	case "codeowners":
+		eligibleReviewers = sources.CodeOwners(ctx, evalContext)
+
+	case "backstage":
+		owners, err := sources.Backstage(ctx)
+		if err != nil {
+			return selection, err
+		}
+
+		// The author can't review their own changes
+		author := sources.ReviewerKey(evalContext.GetAuthor())
+		for _, owner := range owners {
+			if sources.ReviewerKey(owner) != author {
+				eligibleReviewers = append(eligibleReviewers, owner)
+			}
+		}
+
+	case "static":
+		userIDs, err := step.RequiredStringSlice("user_ids")
+		if err != nil {
+			return selection, err
+		}
+
+		for _, id := range userIDs {
+			eligibleReviewers = append(eligibleReviewers, sources.StaticReviewer(id))
+		}
+	}
+
+	if len(eligibleReviewers) == 0 {
+		slogctx.Debug(ctx, "No eligible reviewers found")
+
+		return selection, nil
+	}
+
+	// Only the eligible reviewers that are not already assigned are candidates, duplicates
+	// and actors the provider can't identify are skipped.
+	var candidates Actors
+
+	satisfied := 0
+	seen := make(map[string]struct{})
+
+	for _, actor := range eligibleReviewers {
+		key := sources.ReviewerKey(actor)
+		if len(key) == 0 {
+			slogctx.Warn(ctx, "Invalid reviewer, skipping it", slog.Any("reviewer", actor))
+
+			continue
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		if _, ok := alreadyAssigned[key]; ok {
+			satisfied++
+
+			continue
+		}
+
+		candidates = append(candidates, actor)
+	}
+
+	switch selection.Mode {
+	case "random":
+		// The eligible reviewers already assigned count towards the limit. This "tops
+		// up" reviewers from the list until the limit is satisfied, rather than skipping
+		// entirely when reviewers already exist or endlessly adding on repeat runs.
+		needed := min(max(selection.Limit-satisfied, 0), len(candidates))
+
+		selection.Reviewers = make(Actors, needed)
+
+		rand := state.RandomSeed(ctx)
+		perm := rand.Perm(len(candidates))
+
+		for i := 0; i < needed; i++ {
+			selection.Reviewers[i] = candidates[perm[i]]
+		}
+
+	case "static":
+		// Assign every explicitly listed reviewer; "limit" is ignored in this mode.
+		selection.Reviewers = candidates
+	}
+
+	// If there are no new reviewers to add, the update should be skipped to avoid needless churn.
+	// This makes both modes idempotent across repeated evaluations.
+	if len(selection.Reviewers) == 0 {
+		slogctx.Debug(ctx, "No new reviewers to assign")
+	}
+
+	return selection, nil
+}
@@ -0,0 +1,114 @@
+package scm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/config"
+	"github.com/jippi/scm-engine/pkg/scm"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// reviewersContext is a minimal [scm.EvalContext] exposing the reviewer related accessors
+type reviewersContext struct {
+	scm.EvalContext
+
+	author     scm.Actor
+	codeOwners scm.Actors
+	reviewers  scm.Actors
+}
+
+func (c *reviewersContext) GetAuthor() scm.Actor      { return c.author }
+func (c *reviewersContext) GetCodeOwners() scm.Actors { return c.codeOwners }
+func (c *reviewersContext) GetReviewers() scm.Actors  { return c.reviewers }
+
+// usernameSources identifies reviewers by their username, like GitHub does
+type usernameSources struct {
+	backstage scm.Actors
+}
+
+func (s usernameSources) CodeOwners(_ context.Context, evalContext scm.EvalContext) scm.Actors {
+	return evalContext.GetCodeOwners()
+}
+
+func (s usernameSources) Backstage(context.Context) (scm.Actors, error) {
+	return s.backstage, nil
+}
+
+func (s usernameSources) StaticReviewer(id string) scm.Actor {
+	return scm.Actor{Username: id}
+}
+
+func (s usernameSources) ReviewerKey(actor scm.Actor) string {
+	return actor.Username
+}
+
+func TestSelectReviewers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		step        config.ActionStep
+		evalContext *reviewersContext
+		backstage   scm.Actors
+		want        []string
+		wantErr     string
+	}{
+		{
+			name:        "tops up the code owners already reviewing",
+			step:        config.ActionStep{"limit": 2},
+			evalContext: &reviewersContext{codeOwners: scm.Actors{{Username: "user1"}, {Username: "user2"}}, reviewers: scm.Actors{{Username: "user2"}}},
+			want:        []string{"user1"},
+		},
+		{
+			name:        "skips duplicates and actors without a key",
+			step:        config.ActionStep{"limit": 5},
+			evalContext: &reviewersContext{codeOwners: scm.Actors{{Username: "user1"}, {ID: "1"}, {Username: "user1"}}},
+			want:        []string{"user1"},
+		},
+		{
+			name:        "excludes the author from the Backstage owners",
+			step:        config.ActionStep{"source": "backstage", "limit": 5},
+			evalContext: &reviewersContext{author: scm.Actor{Username: "author"}},
+			backstage:   scm.Actors{{Username: "author"}, {Username: "owner"}},
+			want:        []string{"owner"},
+		},
+		{
+			name:        "static mode ignores the limit",
+			step:        config.ActionStep{"source": "static", "mode": "static", "user_ids": []string{"user1", "user2", "user3"}},
+			evalContext: &reviewersContext{reviewers: scm.Actors{{Username: "user3"}}},
+			want:        []string{"user1", "user2"},
+		},
+		{
+			name:        "static mode requires the static source",
+			step:        config.ActionStep{"mode": "static"},
+			evalContext: &reviewersContext{},
+			wantErr:     "step field 'mode: static' is only supported with 'source: static'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := state.WithRandomSeed(t.Context(), 1)
+
+			selection, err := scm.SelectReviewers(ctx, tt.evalContext, tt.step, usernameSources{backstage: tt.backstage})
+			if len(tt.wantErr) > 0 {
+				require.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			usernames := make([]string, 0, len(selection.Reviewers))
+			for _, reviewer := range selection.Reviewers {
+				usernames = append(usernames, reviewer.Username)
+			}
+
+			require.ElementsMatch(t, tt.want, usernames)
+		})
+	}
+}
@@ -93,6 +93,7 @@ type UpdateMergeRequestOptions struct {
 	AssigneeID         *int          `json:"assignee_id,omitempty"          url:"assignee_id,omitempty"`
 	AssigneeIDs        *[]int        `json:"assignee_ids,omitempty"         url:"assignee_ids,omitempty"`
 	ReviewerIDs        *[]int        `json:"reviewer_ids,omitempty"         url:"reviewer_ids,omitempty"`
+	Reviewers          *[]string     `json:"reviewers,omitempty"            url:"reviewers,omitempty"`
 	Labels             *LabelOptions `json:"labels,omitempty"               url:"labels,comma,omitempty"`
 	AddLabels          *LabelOptions `json:"add_labels,omitempty"           url:"add_labels,comma,omitempty"`
 	RemoveLabels       *LabelOptions `json:"remove_labels,omitempty"        url:"remove_labels,comma,omitempty"`
@@ -112,6 +113,16 @@ func (o *UpdateMergeRequestOptions) AppendReviewerIDs(reviewerIDs []int) {
 	}
 }
 
+// AppendReviewers adds reviewers identified by their username, for providers (like GitHub)
+// where reviewers are requested by username rather than ID
+func (o *UpdateMergeRequestOptions) AppendReviewers(usernames []string) {
+	if o.Reviewers == nil {
+		o.Reviewers = &usernames
+	} else {
+		*o.Reviewers = append(*o.Reviewers, usernames...)
+	}
+}
+
 // ListLabelsOptions represents the available ListLabels() options.
 //
 // GitLab API docs: https://docs.gitlab.com/ee/api/labels.html#list-labels
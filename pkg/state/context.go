@@ -30,12 +30,26 @@ const (
 	backstageURL
 	backstageToken
 	globalConfigFilePath
+	githubAppID
+	githubAppPrivateKey
+	locker
+	dryRunForced
+	trigger
+	includeMaxDepth
 )
 
 func ProjectID(ctx context.Context) string {
 	return ctx.Value(projectID).(string) //nolint:forcetypeassert
 }
 
+// LookupProjectID returns the project ID, and if it has been set at all; unlike [ProjectID],
+// it's safe to use from code that runs both with and without a project in scope
+func LookupProjectID(ctx context.Context) (string, bool) {
+	value, ok := ctx.Value(projectID).(string)
+
+	return value, ok
+}
+
 func EvaluationID(ctx context.Context) string {
 	return ctx.Value(evaluationID).(string) //nolint:forcetypeassert
 }
@@ -110,6 +124,15 @@ func WithDryRun(ctx context.Context, dry bool) context.Context {
 	return ctx
 }
 
+// WithForcedDryRun enables dry-run mode for good; unlike [WithDryRun], the 'dry_run'
+// setting of the configuration file can not turn it off again
+func WithForcedDryRun(ctx context.Context) context.Context {
+	ctx = WithDryRun(ctx, true)
+	ctx = context.WithValue(ctx, dryRunForced, true)
+
+	return ctx
+}
+
 func WithUpdatePipeline(ctx context.Context, update bool, pattern string) context.Context {
 	ctx = slogctx.With(ctx, slog.Bool("update_pipeline", update))
 	ctx = context.WithValue(ctx, updatePipeline, update)
@@ -136,6 +159,36 @@ func IsDryRun(ctx context.Context) bool {
 	return ctx.Value(dryRun).(bool) //nolint:forcetypeassert
 }
 
+// IsDryRunForced returns whether dry-run mode was enabled with [WithForcedDryRun]
+func IsDryRunForced(ctx context.Context) bool {
+	value, _ := ctx.Value(dryRunForced).(bool)
+
+	return value
+}
+
+// Trigger returns what started the evaluation, like the webhook event type or "periodic_evaluation";
+// empty when not set
+func Trigger(ctx context.Context) string {
+	value, _ := ctx.Value(trigger).(string)
+
+	return value
+}
+
+func WithTrigger(ctx context.Context, value string) context.Context {
+	return context.WithValue(ctx, trigger, value)
+}
+
+// IncludeMaxDepth returns how deep includes may be nested; zero when not set
+func IncludeMaxDepth(ctx context.Context) int {
+	value, _ := ctx.Value(includeMaxDepth).(int)
+
+	return value
+}
+
+func WithIncludeMaxDepth(ctx context.Context, value int) context.Context {
+	return context.WithValue(ctx, includeMaxDepth, value)
+}
+
 func ShouldUpdatePipeline(ctx context.Context) (bool, string) {
 	shouldUpdatePipeline := ctx.Value(updatePipeline).(bool)         //nolint:forcetypeassert
 	shouldUpdatePipelineURL := ctx.Value(updatePipelineURL).(string) //nolint:forcetypeassert
@@ -208,3 +261,26 @@ func WithGlobalConfigFilePath(ctx context.Context, value string) context.Context
 
 	return ctx
 }
+
+// GitHubAppID returns the GitHub App ID, or zero when not authenticating as a GitHub App
+func GitHubAppID(ctx context.Context) int64 {
+	value, _ := ctx.Value(githubAppID).(int64)
+
+	return value
+}
+
+// GitHubAppPrivateKey returns the PEM encoded private key of the GitHub App, or an empty
+// string when not authenticating as a GitHub App
+func GitHubAppPrivateKey(ctx context.Context) string {
+	value, _ := ctx.Value(githubAppPrivateKey).(string)
+
+	return value
+}
+
+func WithGitHubApp(ctx context.Context, appID int64, privateKey string) context.Context {
+	ctx = slogctx.With(ctx, slog.Int64("github_app_id", appID))
+	ctx = context.WithValue(ctx, githubAppID, appID)
+	ctx = context.WithValue(ctx, githubAppPrivateKey, privateKey)
+
+	return ctx
+}
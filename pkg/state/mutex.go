@@ -2,26 +2,80 @@ package state
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
-	"sync"
 	"time"
 
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/jippi/scm-engine/pkg/metrics"
 	slogctx "github.com/veqryn/slog-context"
 )
 
-var processingMutex sync.Map // Zero value is empty and ready for use
+// How often to tell that we are still waiting for a lock, e.g. because another replica holds it
+const lockWaitLogInterval = 10 * time.Second
+
+// Used when no other lock backend has been configured
+var defaultLocker = lock.NewMemory()
+
+// Locker returns the lock backend for Merge Request processing; the in-process
+// backend unless another one has been configured with [WithLocker]
+func Locker(ctx context.Context) lock.Locker {
+	if value, ok := ctx.Value(locker).(lock.Locker); ok {
+		return value
+	}
+
+	return defaultLocker
+}
+
+func WithLocker(ctx context.Context, value lock.Locker) context.Context {
+	return context.WithValue(ctx, locker, value)
+}
+
+// LockForProcessing blocks until no one else is processing the Merge Request in the context,
+// and returns the function releasing the lock again
+func LockForProcessing(ctx context.Context) (func(), error) {
+	backend := Locker(ctx)
+	ctx = slogctx.With(ctx, slog.String("lock_backend", backend.Name()))
 
-func LockForProcessing(ctx context.Context) func() {
 	slogctx.Debug(ctx, "Waiting for lock")
 
 	key := Provider(ctx) + "/" + ProjectID(ctx) + "/" + MergeRequestID(ctx)
-
 	start := time.Now()
-	value, _ := processingMutex.LoadOrStore(key, &sync.Mutex{})
-	mtx := value.(*sync.Mutex) //nolint
-	mtx.Lock()
 
-	slogctx.Debug(ctx, "Lock acquired", slog.Duration("waited_for_lock_duration", time.Since(start)))
+	waiting := make(chan struct{})
+	defer close(waiting)
+
+	go func() {
+		ticker := time.NewTicker(lockWaitLogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-waiting:
+				return
+
+			case <-ticker.C:
+				slogctx.Info(ctx, "Still waiting for lock", slog.Duration("waited_for_lock_duration", time.Since(start)))
+			}
+		}
+	}()
+
+	unlock, err := backend.Lock(ctx, key)
+
+	waited := time.Since(start)
+	metrics.LockWaitDuration.WithLabelValues(backend.Name()).Observe(waited.Seconds())
+
+	if err != nil {
+		return nil, fmt.Errorf("could not lock the Merge Request for processing: %w", err)
+	}
+
+	// Waiting for more than a moment means someone else was processing the Merge Request, which is worth telling
+	level := slog.LevelDebug
+	if waited > time.Second {
+		level = slog.LevelInfo
+	}
+
+	slogctx.Log(ctx, level, "Lock acquired", slog.Duration("waited_for_lock_duration", waited))
 
-	return func() { mtx.Unlock() }
+	return unlock, nil
 }
@@ -0,0 +1,66 @@
+package state_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jippi/scm-engine/pkg/lock"
+	"github.com/jippi/scm-engine/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLocker remembers the keys it was asked to lock
+type recordingLocker struct {
+	keys []string
+	err  error
+}
+
+func (l *recordingLocker) Name() string {
+	return "recording"
+}
+
+func (l *recordingLocker) Held(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (l *recordingLocker) Lock(_ context.Context, key string) (func(), error) {
+	l.keys = append(l.keys, key)
+
+	return func() {}, l.err
+}
+
+func mergeRequestContext(ctx context.Context) context.Context {
+	ctx = state.WithProvider(ctx, "gitlab")
+	ctx = state.WithProjectID(ctx, "jippi/scm-engine")
+	ctx = state.WithMergeRequestID(ctx, "42")
+
+	return ctx
+}
+
+func TestLocker_defaultsToMemory(t *testing.T) {
+	t.Parallel()
+
+	require.IsType(t, &lock.Memory{}, state.Locker(t.Context()))
+}
+
+func TestLockForProcessing_usesConfiguredLocker(t *testing.T) {
+	t.Parallel()
+
+	locker := &recordingLocker{}
+
+	unlock, err := state.LockForProcessing(state.WithLocker(mergeRequestContext(t.Context()), locker))
+	require.NoError(t, err)
+	unlock()
+
+	require.Equal(t, []string{"gitlab/jippi/scm-engine/42"}, locker.keys)
+}
+
+func TestLockForProcessing_error(t *testing.T) {
+	t.Parallel()
+
+	locker := &recordingLocker{err: errors.New("connection refused")}
+
+	_, err := state.LockForProcessing(state.WithLocker(mergeRequestContext(t.Context()), locker))
+	require.ErrorContains(t, err, "could not lock the Merge Request for processing: connection refused")
+}
@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jippi/scm-engine/pkg/tracing"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_exportsToCollector(t *testing.T) { //nolint:paralleltest // Setup replaces the global tracer provider
+	var exported atomic.Int64
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exported.Add(1)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(collector.Close)
+
+	shutdown, err := tracing.Setup(t.Context(), collector.URL+"/", "test")
+	require.NoError(t, err)
+
+	_, span := tracing.Start(t.Context(), "ProcessMR")
+	tracing.End(span, errors.New("boom"))
+
+	// Shutting down flushes the spans
+	require.NoError(t, shutdown(t.Context()))
+	require.Equal(t, int64(1), exported.Load())
+}
+
+func TestSetup_disabledWithoutEndpoint(t *testing.T) { //nolint:paralleltest // Setup replaces the global tracer provider
+	shutdown, err := tracing.Setup(t.Context(), "", "test")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(t.Context()))
+}
+
+func TestExtractTraceSpanID(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, tracing.ExtractTraceSpanID(t.Context(), time.Now(), slog.LevelInfo, "no span"))
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tracetest.NewSpanRecorder()))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	ctx, span := provider.Tracer("test").Start(t.Context(), "ProcessMR")
+	defer span.End()
+
+	require.Equal(t, []slog.Attr{
+		slog.String("trace_id", span.SpanContext().TraceID().String()),
+		slog.String("span_id", span.SpanContext().SpanID().String()),
+	}, tracing.ExtractTraceSpanID(ctx, time.Now(), slog.LevelInfo, "with span"))
+}
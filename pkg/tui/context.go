@@ -6,6 +6,7 @@ import (
 	"log/slog"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/jippi/scm-engine/pkg/tracing"
 	"github.com/muesli/termenv"
 	slogmulti "github.com/samber/slog-multi"
 	slogctx "github.com/veqryn/slog-context"
@@ -33,7 +34,12 @@ func NewContext(ctx context.Context, stdout, stderr io.Writer) context.Context {
 		slog.New(
 			slogmulti.
 				Pipe(
-					slogctx.NewMiddleware(&slogctx.HandlerOptions{}),
+					slogctx.NewMiddleware(&slogctx.HandlerOptions{
+						Appenders: []slogctx.AttrExtractor{
+							slogctx.ExtractAppended,
+							tracing.ExtractTraceSpanID,
+						},
+					}),
 				).
 				Pipe(
 					slogdedup.NewOverwriteMiddleware(&slogdedup.OverwriteHandlerOptions{